@@ -1,9 +1,5 @@
 package zipkintracer
 
-import (
-	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
-)
-
 // AgnosticCollector represents a Zipkin trace collector, which is probably a set of
 // remote endpoints.
 type AgnosticCollector interface {
@@ -11,11 +7,18 @@ type AgnosticCollector interface {
 	Close() error
 }
 
-// NopAgnosticCollector implements Collector but performs no work.
+// AgnosticBatchCollector is implemented by AgnosticCollectors able to send a
+// group of spans together, e.g. in a single request.
+type AgnosticBatchCollector interface {
+	AgnosticCollector
+	CollectBatch([]*CoreSpan) error
+}
+
+// NopAgnosticCollector implements AgnosticCollector but performs no work.
 type NopAgnosticCollector struct{}
 
-// Collect implements Collector.
-func (NopAgnosticCollector) Collect(*zipkincore.Span) error { return nil }
+// Collect implements AgnosticCollector.
+func (NopAgnosticCollector) Collect(*CoreSpan) error { return nil }
 
-// Close implements Collector.
+// Close implements AgnosticCollector.
 func (NopAgnosticCollector) Close() error { return nil }
@@ -30,9 +30,9 @@ func executeOps(sp opentracing.Span, numEvent, numTag, numItems int) {
 	}
 }
 
-func benchmarkWithOps(b *testing.B, numEvent, numTag, numItems int) {
+func benchmarkWithOps(b *testing.B, numEvent, numTag, numItems int, options ...TracerOption) {
 	var r CountingRecorder
-	t, err := NewTracer(&r)
+	t, err := NewTracer(&r, options...)
 	if err != nil {
 		b.Fatalf("Unable to create Tracer: %+v", err)
 	}
@@ -59,6 +59,10 @@ func BenchmarkSpan_Empty(b *testing.B) {
 	benchmarkWithOps(b, 0, 0, 0)
 }
 
+func BenchmarkSpan_Empty_SpanPool(b *testing.B) {
+	benchmarkWithOps(b, 0, 0, 0, EnableSpanPool(true))
+}
+
 func BenchmarkSpan_100Events(b *testing.B) {
 	benchmarkWithOps(b, 100, 0, 0)
 }
@@ -71,6 +75,10 @@ func BenchmarkSpan_100Tags(b *testing.B) {
 	benchmarkWithOps(b, 0, 100, 0)
 }
 
+func BenchmarkSpan_100Tags_SpanPool(b *testing.B) {
+	benchmarkWithOps(b, 0, 100, 0, EnableSpanPool(true))
+}
+
 func BenchmarkSpan_1000Tags(b *testing.B) {
 	benchmarkWithOps(b, 0, 1000, 0)
 }
@@ -99,6 +107,25 @@ func BenchmarkTrimmedSpan_100Events_100Tags_100BaggageItems(b *testing.B) {
 	}
 }
 
+func BenchmarkUntrimmedSpan_100Events_100Tags_100BaggageItems(b *testing.B) {
+	var r CountingRecorder
+	t, err := NewTracer(
+		&r,
+		WithSampler(neverSample),
+		TraceID128Bit(true),
+	)
+	if err != nil {
+		b.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	benchmarkWithOpsAndCB(b, func() opentracing.Span {
+		sp := t.StartSpan("test")
+		return sp
+	}, 100, 100, 100)
+	if int(r) != b.N {
+		b.Fatalf("missing traces: expected %d, got %d", b.N, r)
+	}
+}
+
 func benchmarkInject(b *testing.B, format opentracing.BuiltinFormat, numItems int) {
 	var r CountingRecorder
 	tracer, err := NewTracer(&r)
@@ -0,0 +1,216 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+// defaultCloudTraceEndpoint is the Cloud Trace REST API.
+const defaultCloudTraceEndpoint = "https://cloudtrace.googleapis.com"
+
+// TokenSource returns an OAuth2 access token to authenticate requests with,
+// e.g. backed by a golang.org/x/oauth2.TokenSource:
+//  func() (string, error) {
+//  	t, err := ts.Token()
+//  	if err != nil {
+//  		return "", err
+//  	}
+//  	return t.AccessToken, nil
+//  }
+type TokenSource func() (string, error)
+
+// cloudTraceOptions holds the options of NewCloudTraceCollector.
+type cloudTraceOptions struct {
+	endpoint         string
+	tokenSource      TokenSource
+	collectorOptions []JSONHTTPOption
+}
+
+// CloudTraceOption sets a parameter for NewCloudTraceCollector.
+type CloudTraceOption func(o *cloudTraceOptions)
+
+// CloudTraceTokenSource sets the source of the access tokens sent with every
+// request. Without token source requests are not authenticated, which is only
+// useful with a proxy adding credentials.
+func CloudTraceTokenSource(ts TokenSource) CloudTraceOption {
+	return func(o *cloudTraceOptions) { o.tokenSource = ts }
+}
+
+// CloudTraceEndpoint replaces the Cloud Trace API endpoint, by default
+// "https://cloudtrace.googleapis.com".
+func CloudTraceEndpoint(endpoint string) CloudTraceOption {
+	return func(o *cloudTraceOptions) { o.endpoint = endpoint }
+}
+
+// CloudTraceCollectorOptions passes options through to the underlying JSON
+// HTTP collector, e.g. JSONHTTPBatchSize.
+func CloudTraceCollectorOptions(options ...JSONHTTPOption) CloudTraceOption {
+	return func(o *cloudTraceOptions) {
+		o.collectorOptions = append(o.collectorOptions, options...)
+	}
+}
+
+// NewCloudTraceCollector returns a new Collector sending spans to Google Cloud
+// Trace through the batchWrite method of its v2 REST API for the project
+// projectID.
+//
+// Spans are named projects/<projectID>/traces/<trace id>/spans/<span id>, with
+// 64-bit trace IDs padded to 128 bits. Binary annotations become attributes,
+// except for the remote endpoints, which map onto the peer.service attribute,
+// and the error annotation which sets the span status.
+// The span kind is derived from the core annotations, the remaining
+// timestamped annotations become time events.
+func NewCloudTraceCollector(projectID string, options ...CloudTraceOption) (AgnosticCollector, error) {
+	o := &cloudTraceOptions{endpoint: defaultCloudTraceEndpoint}
+	for _, option := range options {
+		option(o)
+	}
+	collectorOptions := append([]JSONHTTPOption{func(c *JSONHTTPCollector) {
+		c.encode = cloudTraceEncoder(projectID)
+		if o.tokenSource != nil {
+			c.authorize = func(req *http.Request) error {
+				token, err := o.tokenSource()
+				if err != nil {
+					return err
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+				return nil
+			}
+		}
+	}}, o.collectorOptions...)
+	url := fmt.Sprintf("%s/v2/projects/%s/traces:batchWrite", strings.TrimSuffix(o.endpoint, "/"), projectID)
+	return NewJSONHTTPCollector(url, collectorOptions...)
+}
+
+// The Cloud Trace v2 JSON encoding of a BatchWriteSpansRequest.
+type cloudTraceBatch struct {
+	Spans []*cloudTraceSpan `json:"spans"`
+}
+
+type cloudTraceSpan struct {
+	Name         string                `json:"name"`
+	SpanID       string                `json:"spanId"`
+	ParentSpanID string                `json:"parentSpanId,omitempty"`
+	DisplayName  cloudTraceString      `json:"displayName"`
+	StartTime    string                `json:"startTime"`
+	EndTime      string                `json:"endTime"`
+	SpanKind     string                `json:"spanKind"`
+	Attributes   *cloudTraceAttributes `json:"attributes,omitempty"`
+	TimeEvents   *cloudTraceTimeEvents `json:"timeEvents,omitempty"`
+	Status       *cloudTraceStatus     `json:"status,omitempty"`
+}
+
+type cloudTraceString struct {
+	Value string `json:"value"`
+}
+
+type cloudTraceAttributes struct {
+	AttributeMap map[string]cloudTraceAttributeValue `json:"attributeMap"`
+}
+
+type cloudTraceAttributeValue struct {
+	StringValue cloudTraceString `json:"stringValue"`
+}
+
+type cloudTraceTimeEvents struct {
+	TimeEvent []cloudTraceTimeEvent `json:"timeEvent"`
+}
+
+type cloudTraceTimeEvent struct {
+	Time       string               `json:"time"`
+	Annotation cloudTraceAnnotation `json:"annotation"`
+}
+
+type cloudTraceAnnotation struct {
+	Description cloudTraceString `json:"description"`
+}
+
+type cloudTraceStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// cloudTraceStatusUnknown is the google.rpc.Code of failed spans.
+const cloudTraceStatusUnknown = 2
+
+// cloudTraceEncoder returns an encoder of BatchWriteSpansRequests for the
+// project projectID.
+func cloudTraceEncoder(projectID string) func(w io.Writer, spans []*CoreSpan) error {
+	return func(w io.Writer, spans []*CoreSpan) error {
+		batch := cloudTraceBatch{Spans: make([]*cloudTraceSpan, 0, len(spans))}
+		for _, s := range spans {
+			batch.Spans = append(batch.Spans, toCloudTraceSpan(projectID, s))
+		}
+		return json.NewEncoder(w).Encode(batch)
+	}
+}
+
+// toCloudTraceSpan maps a span onto a Cloud Trace span.
+func toCloudTraceSpan(projectID string, s *CoreSpan) *cloudTraceSpan {
+	start := coreSpanStart(s)
+	span := &cloudTraceSpan{
+		Name:         fmt.Sprintf("projects/%s/traces/%s/spans/%s", projectID, coreSpanTraceID128(s), s.ID),
+		SpanID:       s.ID,
+		ParentSpanID: s.ParentID,
+		DisplayName:  cloudTraceString{Value: s.Name},
+		StartTime:    cloudTraceTime(start),
+		EndTime:      cloudTraceTime(start + s.Duration),
+		SpanKind:     "INTERNAL",
+	}
+
+	for _, a := range s.Annotations {
+		switch a.Value {
+		case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV:
+			span.SpanKind = "CLIENT"
+		case zipkincore.SERVER_RECV, zipkincore.SERVER_SEND:
+			span.SpanKind = "SERVER"
+		case MessageSend:
+			span.SpanKind = "PRODUCER"
+		case MessageRecv:
+			span.SpanKind = "CONSUMER"
+		default:
+			if span.TimeEvents == nil {
+				span.TimeEvents = &cloudTraceTimeEvents{}
+			}
+			span.TimeEvents.TimeEvent = append(span.TimeEvents.TimeEvent, cloudTraceTimeEvent{
+				Time:       cloudTraceTime(a.Timestamp),
+				Annotation: cloudTraceAnnotation{Description: cloudTraceString{Value: a.Value}},
+			})
+		}
+	}
+
+	for _, ba := range s.BinaryAnnotations {
+		switch ba.Key {
+		case zipkincore.SERVER_ADDR, zipkincore.CLIENT_ADDR:
+			if ba.Endpoint.ServiceName != "" {
+				span.addAttribute("peer.service", ba.Endpoint.ServiceName)
+			}
+		case zipkincore.ERROR:
+			span.Status = &cloudTraceStatus{Code: cloudTraceStatusUnknown}
+			if ba.Value != "true" {
+				span.Status.Message = ba.Value
+			}
+		default:
+			span.addAttribute(ba.Key, ba.Value)
+		}
+	}
+	return span
+}
+
+func (span *cloudTraceSpan) addAttribute(key, value string) {
+	if span.Attributes == nil {
+		span.Attributes = &cloudTraceAttributes{AttributeMap: make(map[string]cloudTraceAttributeValue)}
+	}
+	span.Attributes.AttributeMap[key] = cloudTraceAttributeValue{StringValue: cloudTraceString{Value: value}}
+}
+
+// cloudTraceTime formats a timestamp in epoch microseconds as RFC 3339.
+func cloudTraceTime(timestamp int64) string {
+	return time.Unix(0, timestamp*1e3).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,145 @@
+package zipkintracer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
+)
+
+func TestCloudTraceCollector(t *testing.T) {
+	type request struct {
+		path          string
+		authorization string
+		body          map[string]interface{}
+		err           error
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		req.path = r.URL.Path
+		req.authorization = r.Header.Get("Authorization")
+		req.err = json.NewDecoder(r.Body).Decode(&req.body)
+		requests <- req
+	}))
+	defer server.Close()
+
+	c, err := NewCloudTraceCollector(
+		"my-project",
+		CloudTraceEndpoint(server.URL+"/"),
+		CloudTraceTokenSource(func() (string, error) { return "secret", nil }),
+		CloudTraceCollectorOptions(JSONHTTPSynchronous()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	host := &CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "cloudtrace-service"}
+	err = c.Collect(&CoreSpan{
+		TraceID:   "0123456789abcdef",
+		Name:      "get",
+		ID:        "00000000000000bb",
+		ParentID:  "00000000000000aa",
+		Timestamp: 1500000000000000,
+		Duration:  250000,
+		Annotations: []*CoreAnnotation{
+			{Timestamp: 1500000000000000, Value: zipkincore.SERVER_RECV, Host: host},
+			{Timestamp: 1500000000100000, Value: "cache miss", Host: host},
+			{Timestamp: 1500000000250000, Value: zipkincore.SERVER_SEND, Host: host},
+		},
+		BinaryAnnotations: []*CoreBinaryAnnotation{
+			{Key: zipkincore.CLIENT_ADDR, Value: "true", Endpoint: CoreEndpoint{ServiceName: "frontend"}},
+			{Key: "http.method", Value: "GET", Endpoint: *host},
+			{Key: zipkincore.ERROR, Value: "timeout", Endpoint: *host},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if req.err != nil {
+		t.Fatalf("unable to decode request: %+v", req.err)
+	}
+	if want, have := "/v2/projects/my-project/traces:batchWrite", req.path; want != have {
+		t.Errorf("path: want %q, have %q", want, have)
+	}
+	if want, have := "Bearer secret", req.authorization; want != have {
+		t.Errorf("authorization: want %q, have %q", want, have)
+	}
+
+	want := map[string]interface{}{
+		"spans": []interface{}{map[string]interface{}{
+			"name":         "projects/my-project/traces/00000000000000000123456789abcdef/spans/00000000000000bb",
+			"spanId":       "00000000000000bb",
+			"parentSpanId": "00000000000000aa",
+			"displayName":  map[string]interface{}{"value": "get"},
+			"startTime":    "2017-07-14T02:40:00Z",
+			"endTime":      "2017-07-14T02:40:00.25Z",
+			"spanKind":     "SERVER",
+			"attributes": map[string]interface{}{"attributeMap": map[string]interface{}{
+				"peer.service": map[string]interface{}{"stringValue": map[string]interface{}{"value": "frontend"}},
+				"http.method":  map[string]interface{}{"stringValue": map[string]interface{}{"value": "GET"}},
+			}},
+			"timeEvents": map[string]interface{}{"timeEvent": []interface{}{map[string]interface{}{
+				"time":       "2017-07-14T02:40:00.1Z",
+				"annotation": map[string]interface{}{"description": map[string]interface{}{"value": "cache miss"}},
+			}}},
+			"status": map[string]interface{}{"code": 2.0, "message": "timeout"},
+		}},
+	}
+	if !reflect.DeepEqual(want, req.body) {
+		t.Errorf("body:\nwant %v\nhave %v", want, req.body)
+	}
+}
+
+func TestCloudTraceCollectorTokenError(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	tokenErr := errors.New("no credentials")
+	c, err := NewCloudTraceCollector(
+		"my-project",
+		CloudTraceEndpoint(server.URL),
+		CloudTraceTokenSource(func() (string, error) { return "", tokenErr }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if want, have := tokenErr, c.(Pinger).Ping(context.Background()); want != have {
+		t.Errorf("ping: want %v, have %v", want, have)
+	}
+	if requests != 0 {
+		t.Errorf("requests: want 0, have %d", requests)
+	}
+}
+
+func TestCloudTraceTraceID128Bit(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc").RecordSpan(RawSpan{
+		Context: SpanContext{
+			TraceID: types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a},
+			SpanID:  1,
+			Sampled: true,
+		},
+		Operation: "get",
+		Start:     time.Unix(1500000000, 0),
+	})
+	span := toCloudTraceSpan("my-project", c.spans[0])
+	if want, have := "projects/my-project/traces/5759e988bd862e3fe1be023e8ff6d22a/spans/0000000000000001", span.Name; want != have {
+		t.Errorf("name: want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,124 @@
+package zipkintracer
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+// defaultDedupMaxEntries is the default number of span IDs remembered by the
+// DedupCollector.
+const defaultDedupMaxEntries = 10000
+
+// DedupCollector is an AgnosticCollector which transparently wraps another
+// AgnosticCollector and drops spans whose trace and span ID were collected
+// within the deduplication window, e.g. spans recorded twice by retrying
+// instrumentation. The IDs are remembered in a bounded LRU cache; once it is
+// full the least recently seen IDs are forgotten early.
+type DedupCollector struct {
+	next       AgnosticCollector
+	window     time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mtx     sync.Mutex
+	lru     *list.List
+	entries map[dedupKey]*list.Element
+}
+
+// dedupKey identifies a span within the DedupCollector. With
+// ClientServerSameSpan the client and server side of an RPC share the span
+// ID, the side tells them apart.
+type dedupKey struct {
+	traceIDHigh, traceID, id string
+	side                     string
+}
+
+// dedupEntry is an element of the DedupCollector's LRU list.
+type dedupEntry struct {
+	key  dedupKey
+	seen time.Time
+}
+
+// DedupOption sets a parameter for the DedupCollector
+type DedupOption func(c *DedupCollector)
+
+// DedupMaxEntries sets the maximum number of span IDs remembered. The default
+// is 10000.
+func DedupMaxEntries(n int) DedupOption {
+	return func(c *DedupCollector) { c.maxEntries = n }
+}
+
+// NewDedupCollector returns a DedupCollector wrapping next, dropping spans
+// already collected within window.
+func NewDedupCollector(next AgnosticCollector, window time.Duration, options ...DedupOption) *DedupCollector {
+	c := &DedupCollector{
+		next:       next,
+		window:     window,
+		maxEntries: defaultDedupMaxEntries,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[dedupKey]*list.Element),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Collect implements AgnosticCollector. Duplicate spans are dropped without
+// error. In-progress reports of spans, see Flusher, are always passed on
+// and do not mark the span as seen, so its final report is kept.
+func (c *DedupCollector) Collect(s *CoreSpan) error {
+	key := dedupKey{traceIDHigh: s.TraceIDHigh, traceID: s.TraceID, id: s.ID, side: coreSpanSide(s)}
+	if !s.partial && c.seen(key) {
+		return nil
+	}
+	return c.next.Collect(s)
+}
+
+// coreSpanSide returns "client" or "server" for spans annotated as either side
+// of an RPC, and "" for other spans.
+func coreSpanSide(s *CoreSpan) string {
+	for _, a := range s.Annotations {
+		switch a.Value {
+		case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV:
+			return "client"
+		case zipkincore.SERVER_RECV, zipkincore.SERVER_SEND:
+			return "server"
+		}
+	}
+	return ""
+}
+
+// Close implements AgnosticCollector.
+func (c *DedupCollector) Close() error {
+	return c.next.Close()
+}
+
+// seen reports whether key was seen within the window and marks it as seen
+// now.
+func (c *DedupCollector) seen(key dedupKey) bool {
+	now := c.now()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*dedupEntry)
+		if now.Sub(entry.seen) < c.window {
+			c.lru.MoveToFront(el)
+			return true
+		}
+		entry.seen = now
+		c.lru.MoveToFront(el)
+		return false
+	}
+	c.entries[key] = c.lru.PushFront(&dedupEntry{key: key, seen: now})
+	for c.lru.Len() > c.maxEntries {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*dedupEntry).key)
+	}
+	return false
+}
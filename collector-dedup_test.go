@@ -0,0 +1,110 @@
+package zipkintracer
+
+import (
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func TestDedupCollector(t *testing.T) {
+	stub := &stubAgnosticCollector{}
+	now := time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+	c := NewDedupCollector(stub, time.Minute)
+	c.now = func() time.Time { return now }
+
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+	for i := 0; i < 2; i++ {
+		if err := c.Collect(span); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if want, have := 1, len(stub.spans); want != have {
+		t.Fatalf("duplicate: spans passed on: want %d, have %d", want, have)
+	}
+
+	// a different span of the same trace is kept
+	c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 3, 0, nil, false))
+	if want, have := 2, len(stub.spans); want != have {
+		t.Errorf("other span: spans passed on: want %d, have %d", want, have)
+	}
+
+	// once the window passed the span is collected again
+	now = now.Add(time.Minute)
+	c.Collect(span)
+	if want, have := 3, len(stub.spans); want != have {
+		t.Errorf("window passed: spans passed on: want %d, have %d", want, have)
+	}
+}
+
+func TestDedupCollectorMaxEntries(t *testing.T) {
+	stub := &stubAgnosticCollector{}
+	c := NewDedupCollector(stub, time.Minute, DedupMaxEntries(2))
+
+	for _, id := range []uint64{1, 2, 3, 1} {
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, id, 0, nil, false))
+	}
+	// span 1 was evicted by span 3 and is passed on again
+	if want, have := 4, len(stub.spans); want != have {
+		t.Errorf("spans passed on: want %d, have %d", want, have)
+	}
+	if want, have := 2, len(c.entries); want != have {
+		t.Errorf("entries: want %d, have %d", want, have)
+	}
+}
+
+func TestDedupCollectorFlushedSpans(t *testing.T) {
+	stub := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(NewDedupCollector(stub, time.Minute), false, "0.0.0.0:0", "svc"),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	span := tracer.StartSpan("long running")
+	span.(Flusher).Flush()
+	span.(Flusher).Flush()
+	span.Finish()
+
+	if want, have := 3, len(stub.spans); want != have {
+		t.Fatalf("spans passed on: want %d, have %d", want, have)
+	}
+	if final := stub.spans[2]; final.Timestamp == 0 || final.Duration == 0 {
+		t.Errorf("want final report with timestamp and duration, have %+v", final)
+	}
+}
+
+func TestDedupCollectorSharedSpan(t *testing.T) {
+	stub := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(NewDedupCollector(stub, time.Minute), false, "0.0.0.0:0", "svc"),
+		ClientServerSameSpan(true),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	// the client and server side of an RPC within one process share the span
+	client := tracer.StartSpan("call", ext.SpanKindRPCClient)
+	carrier := opentracing.TextMapCarrier{}
+	if err := tracer.Inject(client.Context(), opentracing.TextMap, carrier); err != nil {
+		t.Fatal(err)
+	}
+	wire, err := tracer.Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := tracer.StartSpan("call", ext.RPCServerOption(wire))
+	server.Finish()
+	client.Finish()
+
+	if want, have := 2, len(stub.spans); want != have {
+		t.Fatalf("spans passed on: want %d, have %d", want, have)
+	}
+	if want, have := stub.spans[0].ID, stub.spans[1].ID; want != have {
+		t.Errorf("span ids: want %s, have %s", want, have)
+	}
+}
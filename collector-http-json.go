@@ -2,23 +2,89 @@ package zipkintracer
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrQueueFull is returned by Collect if the span was disposed because the
+// collector's backlog is full.
+var ErrQueueFull = errors.New("queue full, span disposed")
+
+// ErrCircuitOpen is reported for batches disposed without sending them because
+// the collector's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open, spans disposed")
+
+// ErrProcessChanged is returned for spans disposed without sending them because
+// the collector was created by another process, e.g. before the service forked
+// or daemonized. The new process must create its own collector.
+var ErrProcessChanged = errors.New("collector owned by another process, spans disposed")
+
+// JSONDropPolicy decides which span is disposed if a span is collected while
+// the backlog of the JSONHTTPCollector is full.
+type JSONDropPolicy int
+
+// Available drop policies.
+const (
+	// JSONDropNewest disposes the span being collected. Collect returns
+	// ErrQueueFull.
+	JSONDropNewest JSONDropPolicy = iota
+	// JSONDropOldest disposes the oldest span in the backlog to make room for
+	// the span being collected.
+	JSONDropOldest
+)
+
 // JSONHTTPCollector implements Collector by forwarding spans to a http server.
 type JSONHTTPCollector struct {
+	// dropped and highWater are accessed atomically and kept first for
+	// 64-bit alignment.
+	dropped       uint64
+	highWater     uint64
 	logger        Logger
 	url           string
 	client        *http.Client
 	batchInterval time.Duration
 	batchSize     int
 	maxBacklog    int
+	contentType   string
+	dropPolicy    JSONDropPolicy
 	spanc         chan *CoreSpan
 	quit          chan struct{}
 	shutdown      chan error
 	reqCallback   RequestCallback
+	batchCallback JSONBatchCallback
+	synchronous   bool
+	concurrency   int
+	batchc        chan []*CoreSpan
+	workers       sync.WaitGroup
+	encode        func(w io.Writer, spans []*CoreSpan) error
+	roundTripHook JSONRoundTripHook
+	authorize     func(*http.Request) error
+	hmacKey       []byte
+	hmacHeader    string
+	failoverURLs  []string
+	gzip          bool
+	gzipLevel     int
+	gzipWriters   sync.Pool
+	pid           int
+	getpid        func() int
+	// circuit breaker state, guarded by cbMu.
+	cbThreshold int
+	cbCooldown  time.Duration
+	cbMu        sync.Mutex
+	cbFailures  int
+	cbOpenUntil time.Time
 }
 
 // JSONRequestCallback receives the initialized request from the Collector before
@@ -26,6 +92,16 @@ type JSONHTTPCollector struct {
 // do other customization.
 type JSONRequestCallback func(*http.Request)
 
+// JSONBatchCallback receives the size and send result of every batch the
+// Collector tried to send.
+type JSONBatchCallback func(size int, err error)
+
+// JSONRoundTripHook receives every request the Collector sent to Zipkin along
+// with the response or the error of the round trip. The bodies of both are
+// already consumed and must not be read; the request and response must not be
+// modified.
+type JSONRoundTripHook func(req *http.Request, resp *http.Response, err error)
+
 // JSONHTTPOption sets a parameter for the HttpCollector
 type JSONHTTPOption func(c *JSONHTTPCollector)
 
@@ -48,12 +124,18 @@ func JSONHTTPBatchSize(n int) JSONHTTPOption {
 }
 
 // JSONHTTPMaxBacklog sets the maximum backlog size,
-// when batch size reaches this threshold, spans from the
-// beginning of the batch will be disposed
+// when the backlog reaches this threshold, spans are
+// disposed as decided by the JSONHTTPDropPolicy
 func JSONHTTPMaxBacklog(n int) JSONHTTPOption {
 	return func(c *JSONHTTPCollector) { c.maxBacklog = n }
 }
 
+// JSONHTTPDropPolicy sets which span is disposed if the backlog is full. The
+// default is JSONDropNewest.
+func JSONHTTPDropPolicy(p JSONDropPolicy) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.dropPolicy = p }
+}
+
 // JSONHTTPBatchInterval sets the maximum duration we will buffer traces before
 // emitting them to the collector. The default batch interval is 1 second.
 func JSONHTTPBatchInterval(d time.Duration) JSONHTTPOption {
@@ -65,12 +147,92 @@ func JSONHTTPClient(client *http.Client) JSONHTTPOption {
 	return func(c *JSONHTTPCollector) { c.client = client }
 }
 
+// JSONHTTPContentType sets the Content-Type header of the requests sent to
+// Zipkin. The default is "application/json".
+func JSONHTTPContentType(contentType string) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.contentType = contentType }
+}
+
 // JSONHTTPRequestCallback registers a callback function to adjust the collector
 // *http.Request before it sends the request to Zipkin.
 func JSONHTTPRequestCallback(rc RequestCallback) JSONHTTPOption {
 	return func(c *JSONHTTPCollector) { c.reqCallback = rc }
 }
 
+// JSONHTTPBatchCallback registers a callback function which is called after
+// every attempt to send a batch of spans to Zipkin. With JSONHTTPConcurrency
+// the callback may be called concurrently.
+func JSONHTTPBatchCallback(bc JSONBatchCallback) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.batchCallback = bc }
+}
+
+// JSONHTTPRoundTripHook registers a hook which is called after every attempt
+// to send a batch of spans to Zipkin, e.g. to debug delivery issues. It is
+// called as soon as the response arrived, so together with a
+// JSONHTTPRequestCallback it allows timing the requests. With
+// JSONHTTPConcurrency the hook may be called concurrently.
+func JSONHTTPRoundTripHook(hook JSONRoundTripHook) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.roundTripHook = hook }
+}
+
+// JSONHTTPCircuitBreaker makes the collector stop sending to Zipkin for the
+// cooldown period after threshold consecutive batches failed to send. Batches
+// collected while the circuit breaker is open are disposed. After the cooldown
+// period a single batch is sent to probe Zipkin; if it fails the circuit
+// breaker opens again. A threshold of 0 (the default) disables the breaker.
+func JSONHTTPCircuitBreaker(threshold int, cooldown time.Duration) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) {
+		c.cbThreshold = threshold
+		c.cbCooldown = cooldown
+	}
+}
+
+// JSONHTTPSynchronous makes Collect send every span immediately in its own
+// request, blocking until it is sent and returning the send error. Batching
+// options are ignored in this mode. It is mostly useful for tests asserting on
+// the outcome of a send.
+func JSONHTTPSynchronous() JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.synchronous = true }
+}
+
+// JSONHTTPConcurrency sets the number of batches sent to Zipkin in parallel.
+// Batches are sent in no particular order, the spans of a batch are always
+// sent together. The default is 1.
+func JSONHTTPConcurrency(n int) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.concurrency = n }
+}
+
+// JSONHTTPHMAC signs every request by setting header to the hex encoded
+// HMAC-SHA256 of the request body, keyed by key. The signature is computed
+// over the exact bytes sent to Zipkin.
+func JSONHTTPHMAC(key []byte, header string) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) {
+		c.hmacKey = key
+		c.hmacHeader = header
+	}
+}
+
+// JSONHTTPFailoverURLs sets secondary URLs batches are sent to if posting to
+// the collector's URL fails, i.e. the request fails or Zipkin responds with a
+// non 2xx status code. They are tried in order until one of them accepts the
+// batch, which is disposed if all of them fail. Every batch is sent to the
+// primary URL first.
+func JSONHTTPFailoverURLs(urls []string) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) { c.failoverURLs = urls }
+}
+
+// JSONHTTPGzipLevel compresses the batches with gzip at the given level, one
+// of gzip.DefaultCompression, gzip.BestSpeed through gzip.BestCompression or
+// gzip.HuffmanOnly. Lower levels save CPU, higher levels bandwidth. Requests
+// carry the "Content-Encoding: gzip" header. NewJSONHTTPCollector returns an
+// error for other levels.
+func JSONHTTPGzipLevel(level int) JSONHTTPOption {
+	return func(c *JSONHTTPCollector) {
+		c.gzip = true
+		c.gzipLevel = level
+	}
+}
+
 // NewJSONHTTPCollector returns a new HTTP-backend Collector. url should be a http
 // url for handle post request. timeout is passed to http client. queueSize control
 // the maximum size of buffer of async queue. The logger is used to log errors,
@@ -83,6 +245,10 @@ func NewJSONHTTPCollector(url string, options ...JSONHTTPOption) (AgnosticCollec
 		batchInterval: defaultHTTPBatchInterval * time.Second,
 		batchSize:     defaultHTTPBatchSize,
 		maxBacklog:    defaultHTTPMaxBacklog,
+		contentType:   "application/json",
+		encode:        encodeJSONBatch,
+		pid:           os.Getpid(),
+		getpid:        os.Getpid,
 		quit:          make(chan struct{}, 1),
 		shutdown:      make(chan error, 1),
 	}
@@ -91,29 +257,127 @@ func NewJSONHTTPCollector(url string, options ...JSONHTTPOption) (AgnosticCollec
 		option(c)
 	}
 
+	if c.gzip {
+		if c.gzipLevel < gzip.HuffmanOnly || c.gzipLevel > gzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip level %d. Should be between %d and %d", c.gzipLevel, gzip.HuffmanOnly, gzip.BestCompression)
+		}
+		level := c.gzipLevel
+		c.gzipWriters.New = func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, level)
+			return w
+		}
+	}
+
+	if c.synchronous {
+		return c, nil
+	}
+
 	// spanc can immediately accept maxBacklog spans and everything else is dropped.
 	c.spanc = make(chan *CoreSpan, c.maxBacklog)
 
+	if c.concurrency > 1 {
+		c.batchc = make(chan []*CoreSpan)
+		c.workers.Add(c.concurrency)
+		for i := 0; i < c.concurrency; i++ {
+			go c.worker()
+		}
+	}
+
 	go c.loop()
 	return c, nil
 }
 
 // Collect implements Collector.
-// attempts a non blocking send on the channel.
+// attempts a non blocking send on the channel. If the backlog is full and the
+// span is disposed, ErrQueueFull is returned; earlier versions returned nil.
+// Callers treating any Collect error as fatal should ignore ErrQueueFull, the
+// collector keeps working and counts the span in DroppedSpans.
 func (c *JSONHTTPCollector) Collect(s *CoreSpan) error {
-	select {
-	case c.spanc <- s:
-		// Accepted.
-	case <-c.quit:
-		// Collector concurrently closed.
-	default:
-		c.logger.Log("msg", "queue full, disposing spans.", "size", len(c.spanc))
+	if c.processChanged() {
+		atomic.AddUint64(&c.dropped, 1)
+		return ErrProcessChanged
 	}
-	return nil
+	if c.synchronous {
+		return c.send([]*CoreSpan{s})
+	}
+	for {
+		select {
+		case c.spanc <- s:
+			// Accepted.
+			c.updateHighWater(len(c.spanc))
+			return nil
+		case <-c.quit:
+			// Collector concurrently closed.
+			return nil
+		default:
+		}
+		if c.dropPolicy != JSONDropOldest || cap(c.spanc) == 0 {
+			atomic.AddUint64(&c.dropped, 1)
+			c.logger.Log("msg", "queue full, disposing spans.", "size", len(c.spanc))
+			return ErrQueueFull
+		}
+		// make room by disposing the oldest span and try again.
+		select {
+		case <-c.spanc:
+			atomic.AddUint64(&c.dropped, 1)
+			c.logger.Log("msg", "queue full, disposing oldest span.", "size", len(c.spanc))
+		default:
+		}
+	}
+}
+
+// CollectBatch implements AgnosticBatchCollector. The spans are sent
+// immediately in a single request, bypassing the backlog, and the send error is
+// returned.
+func (c *JSONHTTPCollector) CollectBatch(spans []*CoreSpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	return c.send(spans)
+}
+
+// DroppedSpans returns the number of spans disposed because the backlog was
+// full.
+func (c *JSONHTTPCollector) DroppedSpans() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// QueueDepth returns the number of spans in the backlog waiting to be batched
+// and sent. A synchronous collector has no backlog and always reports 0.
+func (c *JSONHTTPCollector) QueueDepth() int {
+	return len(c.spanc)
+}
+
+// QueueHighWaterMark returns the largest QueueDepth observed since the
+// collector was created. Compared with the JSONHTTPMaxBacklog it allows for
+// alerting before spans are being disposed.
+func (c *JSONHTTPCollector) QueueHighWaterMark() int {
+	return int(atomic.LoadUint64(&c.highWater))
+}
+
+// updateHighWater raises the high-water mark of the backlog to depth.
+func (c *JSONHTTPCollector) updateHighWater(depth int) {
+	for {
+		mark := atomic.LoadUint64(&c.highWater)
+		if uint64(depth) <= mark || atomic.CompareAndSwapUint64(&c.highWater, mark, uint64(depth)) {
+			return
+		}
+	}
+}
+
+// Saturation returns the fill level of the backlog between 0 (empty) and 1
+// (full, spans are being disposed). It allows samplers to back off while Zipkin
+// can't keep up, see AdaptiveSamplerBackpressure. A synchronous collector has
+// no backlog and always reports 0.
+func (c *JSONHTTPCollector) Saturation() float64 {
+	return saturation(len(c.spanc), cap(c.spanc))
 }
 
 // Close implements Collector.
 func (c *JSONHTTPCollector) Close() error {
+	if c.synchronous {
+		return nil
+	}
 	close(c.quit)
 	return <-c.shutdown
 }
@@ -135,53 +399,283 @@ func (c *JSONHTTPCollector) loop() {
 		case span := <-c.spanc:
 			batch = append(batch, span)
 			if len(batch) == c.batchSize {
-				c.send(batch)
-				batch = batch[0:0]
+				batch = c.dispatch(batch)
 				nextSend = time.Now().Add(c.batchInterval)
 			}
 		case <-tickc:
 			if time.Now().After(nextSend) {
 				if len(batch) > 0 {
-					c.send(batch)
-					batch = batch[0:0]
+					batch = c.dispatch(batch)
 				}
 				nextSend = time.Now().Add(c.batchInterval)
 			}
 		case <-c.quit:
-			c.shutdown <- c.send(batch)
+			// flush the backlog and wait for the workers to finish.
+		Drain:
+			for {
+				select {
+				case span := <-c.spanc:
+					batch = append(batch, span)
+					if len(batch) == c.batchSize {
+						batch = c.dispatch(batch)
+					}
+				default:
+					break Drain
+				}
+			}
+			if c.batchc != nil {
+				close(c.batchc)
+				c.workers.Wait()
+			}
+			var err error
+			if len(batch) > 0 {
+				err = c.send(batch)
+			}
+			c.shutdown <- err
 			return
 		}
 	}
 }
 
+// dispatch sends the batch, either directly or through the workers, and returns
+// an empty batch to continue with.
+func (c *JSONHTTPCollector) dispatch(batch []*CoreSpan) []*CoreSpan {
+	if c.batchc == nil {
+		c.send(batch)
+		return batch[0:0]
+	}
+	c.batchc <- batch
+	return make([]*CoreSpan, 0, c.batchSize)
+}
+
+func (c *JSONHTTPCollector) worker() {
+	defer c.workers.Done()
+	for batch := range c.batchc {
+		c.send(batch)
+	}
+}
+
 func (c *JSONHTTPCollector) send(sendBatch []*CoreSpan) error {
+	var err error
+	if c.processChanged() {
+		c.logger.Log("msg", "collector owned by another process, disposing spans.", "size", len(sendBatch))
+		err = ErrProcessChanged
+	} else if c.circuitOpen() {
+		c.logger.Log("msg", "circuit breaker open, disposing spans.", "size", len(sendBatch))
+		err = ErrCircuitOpen
+	} else {
+		err = c.doSend(sendBatch)
+		c.recordSendResult(err)
+	}
+	if c.batchCallback != nil && len(sendBatch) > 0 {
+		c.batchCallback(len(sendBatch), err)
+	}
+	return err
+}
+
+// processChanged returns whether the collector is used by another process than
+// the one which created it.
+func (c *JSONHTTPCollector) processChanged() bool {
+	return c.getpid() != c.pid
+}
 
-	payload, err := json.Marshal(sendBatch)
+// circuitOpen returns whether the circuit breaker is open.
+func (c *JSONHTTPCollector) circuitOpen() bool {
+	if c.cbThreshold <= 0 {
+		return false
+	}
+	c.cbMu.Lock()
+	defer c.cbMu.Unlock()
+	return time.Now().Before(c.cbOpenUntil)
+}
+
+// recordSendResult updates the circuit breaker state.
+func (c *JSONHTTPCollector) recordSendResult(err error) {
+	if c.cbThreshold <= 0 {
+		return
+	}
+	c.cbMu.Lock()
+	defer c.cbMu.Unlock()
+	if err == nil {
+		c.cbFailures = 0
+		return
+	}
+	c.cbFailures++
+	if c.cbFailures >= c.cbThreshold {
+		c.cbOpenUntil = time.Now().Add(c.cbCooldown)
+	}
+}
+
+func (c *JSONHTTPCollector) doSend(sendBatch []*CoreSpan) error {
+
+	buf, err := c.encodeBody(sendBatch)
 	if err != nil {
 		return err
 	}
+	// the buffer is shared by the requests to all URLs and returned to the
+	// pool once the last of them is done with it.
+	refs := int32(1)
+	defer releaseBuffer(buf, &refs)
 
-	req, err := http.NewRequest(
-		"POST",
-		c.url,
-		bytes.NewBuffer(payload))
+	for i, url := range append([]string{c.url}, c.failoverURLs...) {
+		if i > 0 {
+			c.logger.Log("msg", "failing over", "url", url)
+		}
+		var retry bool
+		retry, err = c.post(url, buf, &refs)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends the batch encoded in buf to url. It reports whether sending to
+// another URL might succeed if posting failed.
+func (c *JSONHTTPCollector) post(url string, buf *bytes.Buffer, refs *int32) (retry bool, err error) {
+	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
 		c.logger.Log("err", err.Error())
-		return err
+		return true, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.reqCallback != nil {
-		c.reqCallback(req)
+	// the transport closes the body once it is fully consumed, which releases
+	// the buffer.
+	atomic.AddInt32(refs, 1)
+	req.Body = &pooledBody{Reader: bytes.NewReader(buf.Bytes()), buf: buf, refs: refs}
+	if err := c.prepare(req, buf.Bytes()); err != nil {
+		req.Body.Close()
+		c.logger.Log("err", err.Error())
+		return false, err
 	}
 	resp, err := c.client.Do(req)
 	if err != nil {
 		c.logger.Log("err", err.Error())
-		return err
+		if c.roundTripHook != nil {
+			c.roundTripHook(req, nil, err)
+		}
+		return true, err
 	}
 	resp.Body.Close()
+	if c.roundTripHook != nil {
+		c.roundTripHook(req, resp, nil)
+	}
 	// non 2xx code
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		c.logger.Log("err", "HTTP POST span failed", "code", resp.Status)
+		return true, fmt.Errorf("HTTP POST span failed: %s", resp.Status)
+	}
+	return false, nil
+}
+
+// encodeJSONBatch encodes spans as a Zipkin v1 JSON array.
+func encodeJSONBatch(w io.Writer, spans []*CoreSpan) error {
+	return json.NewEncoder(w).Encode(spans)
+}
+
+// encodeBody returns a buffer from the jsonBufferPool holding the request body
+// of spans.
+func (c *JSONHTTPCollector) encodeBody(spans []*CoreSpan) (*bytes.Buffer, error) {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := c.encode(buf, spans); err != nil {
+		jsonBufferPool.Put(buf)
+		return nil, err
+	}
+	if !c.gzip {
+		return buf, nil
+	}
+	compressed := jsonBufferPool.Get().(*bytes.Buffer)
+	compressed.Reset()
+	defer jsonBufferPool.Put(buf)
+	w := c.gzipWriters.Get().(*gzip.Writer)
+	defer c.gzipWriters.Put(w)
+	w.Reset(compressed)
+	_, err := w.Write(buf.Bytes())
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		jsonBufferPool.Put(compressed)
+		return nil, err
+	}
+	return compressed, nil
+}
+
+// prepare sets the headers of a request sending body to Zipkin.
+func (c *JSONHTTPCollector) prepare(req *http.Request, body []byte) error {
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", c.contentType)
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.hmacHeader != "" {
+		mac := hmac.New(sha256.New, c.hmacKey)
+		mac.Write(body)
+		req.Header.Set(c.hmacHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+	if c.authorize != nil {
+		if err := c.authorize(req); err != nil {
+			return err
+		}
+	}
+	if c.reqCallback != nil {
+		c.reqCallback(req)
 	}
 	return nil
 }
+
+// Ping checks whether Zipkin is reachable and accepts spans by sending an
+// empty batch. It returns an error if the request fails or Zipkin responds
+// with a non 2xx status code, e.g. for use in readiness probes.
+func (c *JSONHTTPCollector) Ping(ctx context.Context) error {
+	body, err := c.encodeBody([]*CoreSpan{})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.url, nil)
+	if err != nil {
+		jsonBufferPool.Put(body)
+		return err
+	}
+	req.Body = &pooledBody{Reader: bytes.NewReader(body.Bytes()), buf: body}
+	if err := c.prepare(req, body.Bytes()); err != nil {
+		req.Body.Close()
+		return err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP POST ping failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// jsonBufferPool holds the buffers batches are encoded into.
+var jsonBufferPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+// pooledBody is a request body releasing its buffer when closed.
+type pooledBody struct {
+	*bytes.Reader
+	buf *bytes.Buffer
+	// refs counts the users of buf shared by several bodies, nil if the
+	// body is the only one.
+	refs *int32
+	once sync.Once
+}
+
+func (b *pooledBody) Close() error {
+	b.once.Do(func() { releaseBuffer(b.buf, b.refs) })
+	return nil
+}
+
+// releaseBuffer returns buf to the jsonBufferPool once it has no more users.
+func releaseBuffer(buf *bytes.Buffer, refs *int32) {
+	if refs == nil || atomic.AddInt32(refs, -1) == 0 {
+		jsonBufferPool.Put(buf)
+	}
+}
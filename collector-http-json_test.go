@@ -1,12 +1,23 @@
 package zipkintracer
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -125,7 +136,7 @@ func newJSONHTTPServer(t *testing.T, port int) *jsonHTTPServer {
 	handler.HandleFunc("/api/v1/spans", func(w http.ResponseWriter, r *http.Request) {
 		contextType := r.Header.Get("Content-Type")
 		if contextType != "application/json" {
-			t.Fatalf("except Content-Type should be application/x-thrift, but is %s", contextType)
+			t.Fatalf("except Content-Type should be application/json, but is %s", contextType)
 		}
 
 		// clone headers from request
@@ -155,8 +166,13 @@ func newJSONHTTPServer(t *testing.T, port int) *jsonHTTPServer {
 		time.Sleep(serverSleep)
 	})
 
+	// listen before returning so collectors don't race the server startup.
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
 	go func() {
-		http.ListenAndServe(fmt.Sprintf(":%d", port), handler)
+		http.Serve(ln, handler)
 	}()
 
 	return server
@@ -182,3 +198,789 @@ func makeNewJSONSpan(hostPort, serviceName, methodName string, traceID, spanID,
 
 	return span
 }
+
+func TestJSONHTTPCollectorCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var (
+		requests int32
+		failing  int32 = 1
+		batches  int32
+		cooldown = 200 * time.Millisecond
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL,
+		JSONHTTPBatchSize(1),
+		JSONHTTPCircuitBreaker(2, cooldown),
+		JSONHTTPBatchCallback(func(int, error) { atomic.AddInt32(&batches, 1) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+	// collect a span and wait for its batch to be handled
+	collect := func() {
+		want := atomic.LoadInt32(&batches) + 1
+		if err := c.Collect(span); err != nil {
+			t.Fatalf("error during collection: %v", err)
+		}
+		if err := eventually(func() bool { return atomic.LoadInt32(&batches) == want }, time.Second); err != nil {
+			t.Fatalf("batch %d never handled", want)
+		}
+	}
+	expectRequests := func(want int32) {
+		if have := atomic.LoadInt32(&requests); want != have {
+			t.Fatalf("requests: want %d, have %d", want, have)
+		}
+	}
+
+	// two consecutive failures open the circuit
+	collect()
+	collect()
+	expectRequests(2)
+	collect()
+	collect()
+	expectRequests(2)
+
+	// after the cooldown a failing probe opens the circuit again
+	time.Sleep(cooldown + 50*time.Millisecond)
+	collect()
+	expectRequests(3)
+	collect()
+	expectRequests(3)
+
+	// after the cooldown a successful probe closes the circuit
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(cooldown + 50*time.Millisecond)
+	collect()
+	collect()
+	expectRequests(5)
+}
+
+func TestJSONHTTPCollectorSynchronous(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		status = http.StatusInternalServerError
+		spans  []*CoreSpan
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []*CoreSpan
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		spans = append(spans, batch...)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL, JSONHTTPSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+	if err := c.Collect(span); err == nil {
+		t.Error("want send error, have nil")
+	}
+
+	mu.Lock()
+	status = http.StatusAccepted
+	mu.Unlock()
+	if err := c.Collect(span); err != nil {
+		t.Errorf("error during collection: %v", err)
+	}
+
+	// both spans were sent before Collect returned
+	mu.Lock()
+	defer mu.Unlock()
+	if want, have := 2, len(spans); want != have {
+		t.Errorf("spans: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONHTTPCollectorProcessChanged(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+	forked := func() int { return os.Getpid() + 1 }
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+
+	c, err := NewJSONHTTPCollector(server.URL, JSONHTTPSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Collect(span); err != nil {
+		t.Errorf("error during collection: %v", err)
+	}
+	c.(*JSONHTTPCollector).getpid = forked
+	if want, have := ErrProcessChanged, c.Collect(span); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&requests); want != have {
+		t.Errorf("requests: want %d, have %d", want, have)
+	}
+
+	// spans collected before the process changed are not sent by the new one
+	batches := make(chan error, 1)
+	c, err = NewJSONHTTPCollector(
+		server.URL,
+		JSONHTTPBatchInterval(time.Hour),
+		JSONHTTPBatchCallback(func(size int, err error) { batches <- err }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(span); err != nil {
+		t.Errorf("error during collection: %v", err)
+	}
+	c.(*JSONHTTPCollector).getpid = forked
+	if want, have := ErrProcessChanged, c.Collect(span); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	c.Close()
+	if want, have := ErrProcessChanged, <-batches; want != have {
+		t.Errorf("batch: want %v, have %v", want, have)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&requests); want != have {
+		t.Errorf("requests: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONHTTPCollectorDropPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []JSONDropPolicy{JSONDropNewest, JSONDropOldest} {
+		var (
+			mu      sync.Mutex
+			names   []string
+			release = make(chan struct{})
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			var batch []*CoreSpan
+			if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, span := range batch {
+				names = append(names, span.Name)
+			}
+		}))
+
+		const (
+			backlog = 5
+			total   = 50
+		)
+		collector, err := NewJSONHTTPCollector(server.URL,
+			JSONHTTPBatchSize(1),
+			JSONHTTPMaxBacklog(backlog),
+			JSONHTTPDropPolicy(policy),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := collector.(*JSONHTTPCollector)
+
+		// the first span blocks the loop in send
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "first", 1, 1, 0, nil, false))
+		if err := eventually(func() bool { return len(c.spanc) == 0 }, time.Second); err != nil {
+			t.Fatal("first span never picked up")
+		}
+		for i := 0; i < total; i++ {
+			err := c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", fmt.Sprint(i), 1, uint64(i+2), 0, nil, false))
+			if policy == JSONDropNewest && i >= backlog && err != ErrQueueFull {
+				t.Errorf("policy %d: want %v, have %v", policy, ErrQueueFull, err)
+			}
+			if policy == JSONDropOldest && err != nil {
+				t.Errorf("policy %d: error during collection: %v", policy, err)
+			}
+			if have := len(c.spanc); have > backlog {
+				t.Fatalf("policy %d: backlog exceeds %d: %d", policy, backlog, have)
+			}
+		}
+		if want, have := uint64(total-backlog), c.DroppedSpans(); want != have {
+			t.Errorf("policy %d: dropped spans: want %d, have %d", policy, want, have)
+		}
+
+		close(release)
+		want := []string{"first", "0", "1", "2", "3", "4"}
+		if policy == JSONDropOldest {
+			want = []string{"first", "45", "46", "47", "48", "49"}
+		}
+		received := func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(names) == len(want)
+		}
+		if err := eventually(received, time.Second); err != nil {
+			t.Errorf("policy %d: never received the backlog", policy)
+		}
+		c.Close()
+		server.Close()
+
+		mu.Lock()
+		if have := names; fmt.Sprint(want) != fmt.Sprint(have) {
+			t.Errorf("policy %d: spans: want %v, have %v", policy, want, have)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestJSONHTTPCollectorContentType(t *testing.T) {
+	t.Parallel()
+
+	contentType := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType <- r.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL,
+		JSONHTTPSynchronous(),
+		JSONHTTPContentType("application/json; charset=utf-8"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)); err != nil {
+		t.Fatalf("error during collection: %v", err)
+	}
+	if want, have := "application/json; charset=utf-8", <-contentType; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestJSONHTTPCollectorHMAC(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("secret")
+	signatures := make(chan [2]string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		signatures <- [2]string{hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Signature")}
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL,
+		JSONHTTPSynchronous(),
+		JSONHTTPHMAC(key, "X-Signature"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)); err != nil {
+		t.Fatalf("error during collection: %v", err)
+	}
+	sig := <-signatures
+	if want, have := sig[0], sig[1]; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestJSONHTTPCollectorFailoverURLs(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		*httptest.Server
+		status int32
+		spans  chan []*CoreSpan
+	}
+	newServer := func(status int) *server {
+		s := &server{status: int32(status), spans: make(chan []*CoreSpan, 10)}
+		s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var spans []*CoreSpan
+			if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+				t.Error(err)
+			}
+			s.spans <- spans
+			w.WriteHeader(int(atomic.LoadInt32(&s.status)))
+		}))
+		return s
+	}
+	primary := newServer(http.StatusInternalServerError)
+	defer primary.Close()
+	secondary := newServer(http.StatusOK)
+	defer secondary.Close()
+	tertiary := newServer(http.StatusOK)
+	defer tertiary.Close()
+
+	c, err := NewJSONHTTPCollector(primary.URL,
+		JSONHTTPSynchronous(),
+		JSONHTTPFailoverURLs([]string{secondary.URL, tertiary.URL}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	received := func(s *server) int {
+		n := 0
+		for {
+			select {
+			case spans := <-s.spans:
+				if want, have := "00000002", spans[0].ID; want != have {
+					t.Errorf("span id: want %q, have %q", want, have)
+				}
+				n++
+			default:
+				return n
+			}
+		}
+	}
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+
+	// the batch lands on the secondary
+	if err := c.Collect(span); err != nil {
+		t.Errorf("error during collection: %v", err)
+	}
+	for _, test := range []struct {
+		name string
+		s    *server
+		want int
+	}{{"primary", primary, 1}, {"secondary", secondary, 1}, {"tertiary", tertiary, 0}} {
+		if have := received(test.s); test.want != have {
+			t.Errorf("%s: batches: want %d, have %d", test.name, test.want, have)
+		}
+	}
+
+	// all URLs fail
+	atomic.StoreInt32(&secondary.status, http.StatusServiceUnavailable)
+	atomic.StoreInt32(&tertiary.status, http.StatusServiceUnavailable)
+	if err := c.Collect(span); err == nil {
+		t.Error("want send error, have nil")
+	}
+	for name, s := range map[string]*server{"primary": primary, "secondary": secondary, "tertiary": tertiary} {
+		if want, have := 1, received(s); want != have {
+			t.Errorf("%s: batches: want %d, have %d", name, want, have)
+		}
+	}
+
+	// the primary is tried first again once it recovers
+	atomic.StoreInt32(&primary.status, http.StatusAccepted)
+	if err := c.Collect(span); err != nil {
+		t.Errorf("error during collection: %v", err)
+	}
+	if want, have := 1, received(primary); want != have {
+		t.Errorf("primary: batches: want %d, have %d", want, have)
+	}
+	if want, have := 0, received(secondary); want != have {
+		t.Errorf("secondary: batches: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONHTTPCollectorQueueDepth(t *testing.T) {
+	t.Parallel()
+
+	var (
+		received = make(chan struct{}, 1)
+		release  = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL, JSONHTTPBatchSize(1), JSONHTTPMaxBacklog(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	collector := c.(*JSONHTTPCollector)
+
+	// the first span blocks the send loop on the server, the rest queue up.
+	collector.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 1, 0, nil, false))
+	<-received
+	id := uint64(2)
+	for _, depth := range []int{5, 8} {
+		for collector.QueueDepth() < depth {
+			collector.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, id, 0, nil, false))
+			id++
+		}
+		if want, have := depth, collector.QueueDepth(); want != have {
+			t.Errorf("queue depth: want %d, have %d", want, have)
+		}
+		if want, have := depth, collector.QueueHighWaterMark(); want != have {
+			t.Errorf("high-water mark: want %d, have %d", want, have)
+		}
+	}
+
+	// the high-water mark remains once the backlog drains
+	close(release)
+	if err := eventually(func() bool { return collector.QueueDepth() == 0 }, time.Second); err != nil {
+		t.Errorf("queue depth: want 0, have %d", collector.QueueDepth())
+	}
+	if want, have := 8, collector.QueueHighWaterMark(); want != have {
+		t.Errorf("high-water mark: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONHTTPCollectorGzipLevel(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("secret")
+	type request struct {
+		encoding string
+		signed   bool
+		spans    []*CoreSpan
+		err      error
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		defer func() { requests <- req }()
+		req.encoding = r.Header.Get("Content-Encoding")
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			req.err = err
+			return
+		}
+		// the signature covers the compressed body
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		req.signed = hex.EncodeToString(mac.Sum(nil)) == r.Header.Get("X-Signature")
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			req.err = err
+			return
+		}
+		req.err = json.NewDecoder(zr).Decode(&req.spans)
+	}))
+	defer server.Close()
+
+	for _, level := range []int{
+		gzip.DefaultCompression,
+		gzip.HuffmanOnly,
+		gzip.BestSpeed, 2, 3, 4, 5, 6, 7, 8,
+		gzip.BestCompression,
+	} {
+		c, err := NewJSONHTTPCollector(server.URL,
+			JSONHTTPSynchronous(),
+			JSONHTTPGzipLevel(level),
+			JSONHTTPHMAC(key, "X-Signature"),
+		)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if err := c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)); err != nil {
+			t.Fatalf("level %d: error during collection: %v", level, err)
+		}
+		req := <-requests
+		if req.err != nil {
+			t.Fatalf("level %d: unable to decode body: %v", level, req.err)
+		}
+		if want, have := "gzip", req.encoding; want != have {
+			t.Errorf("level %d: content encoding: want %q, have %q", level, want, have)
+		}
+		if !req.signed {
+			t.Errorf("level %d: want valid signature", level)
+		}
+		if want, have := 1, len(req.spans); want != have {
+			t.Fatalf("level %d: spans: want %d, have %d", level, want, have)
+		}
+		if want, have := "00000002", req.spans[0].ID; want != have {
+			t.Errorf("level %d: span id: want %q, have %q", level, want, have)
+		}
+		c.Close()
+	}
+
+	for _, level := range []int{gzip.HuffmanOnly - 1, gzip.BestCompression + 1} {
+		if _, err := NewJSONHTTPCollector(server.URL, JSONHTTPGzipLevel(level)); err == nil {
+			t.Errorf("level %d: want error, have nil", level)
+		}
+	}
+}
+
+func TestJSONHTTPCollectorRoundTripHook(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid span", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	type roundTrip struct {
+		req  *http.Request
+		resp *http.Response
+		err  error
+	}
+	roundTrips := make(chan roundTrip, 1)
+	c, err := NewJSONHTTPCollector(server.URL,
+		JSONHTTPSynchronous(),
+		JSONHTTPRoundTripHook(func(req *http.Request, resp *http.Response, err error) {
+			roundTrips <- roundTrip{req, resp, err}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)); err == nil {
+		t.Error("want error for 400 response, have nil")
+	}
+	rt := <-roundTrips
+	if rt.err != nil {
+		t.Fatalf("want no round trip error, have %v", rt.err)
+	}
+	if want, have := server.URL, rt.req.URL.String(); want != have {
+		t.Errorf("request url: want %q, have %q", want, have)
+	}
+	if want, have := "POST", rt.req.Method; want != have {
+		t.Errorf("request method: want %q, have %q", want, have)
+	}
+	if want, have := http.StatusBadRequest, rt.resp.StatusCode; want != have {
+		t.Errorf("response status: want %d, have %d", want, have)
+	}
+
+	// transport errors are passed on as well
+	c, err = NewJSONHTTPCollector("http://127.0.0.1:0",
+		JSONHTTPSynchronous(),
+		JSONHTTPRoundTripHook(func(req *http.Request, resp *http.Response, err error) {
+			roundTrips <- roundTrip{req, resp, err}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false))
+	if rt := <-roundTrips; rt.err == nil || rt.resp != nil {
+		t.Errorf("transport error: want error and no response, have %v, %v", rt.resp, rt.err)
+	}
+}
+
+func TestJSONHTTPCollectorPayload(t *testing.T) {
+	t.Parallel()
+
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		bodies <- body
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL, JSONHTTPSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// the second span is smaller, a reused buffer must not leak the first
+	for _, span := range []*CoreSpan{
+		makeNewJSONSpan("1.2.3.4:1234", "a-rather-long-service-name", "method", 1, 2, 0, nil, true),
+		makeNewJSONSpan("1.2.3.4:1234", "svc", "m", 3, 4, 0, nil, false),
+	} {
+		if err := c.Collect(span); err != nil {
+			t.Fatalf("error during collection: %v", err)
+		}
+		want, err := json.Marshal([]*CoreSpan{span})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := <-bodies; string(want)+"\n" != string(have) {
+			t.Errorf("want %s, have %s", want, have)
+		}
+	}
+}
+
+func makeJSONBatch(n int) []*CoreSpan {
+	batch := make([]*CoreSpan, n)
+	for i := range batch {
+		batch[i] = makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, uint64(i+1), 0, nil, false)
+	}
+	return batch
+}
+
+func BenchmarkJSONBatchEncoding(b *testing.B) {
+	batch := makeJSONBatch(100)
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(batch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("PooledBuffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := jsonBufferPool.Get().(*bytes.Buffer)
+			buf.Reset()
+			if err := json.NewEncoder(buf).Encode(batch); err != nil {
+				b.Fatal(err)
+			}
+			jsonBufferPool.Put(buf)
+		}
+	})
+}
+
+func BenchmarkJSONHTTPCollectorSend(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	collector, err := NewJSONHTTPCollector(server.URL, JSONHTTPSynchronous())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer collector.Close()
+	c := collector.(*JSONHTTPCollector)
+	batch := makeJSONBatch(100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.doSend(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestJSONHTTPCollectorConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const (
+		spans     = 200
+		batchSize = 10
+		latency   = 50 * time.Millisecond
+	)
+	var (
+		received int32
+		inFlight int32
+		maxIn    int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxIn)
+			if n <= max || atomic.CompareAndSwapInt32(&maxIn, max, n) {
+				break
+			}
+		}
+		var batch []*CoreSpan
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		if want, have := batchSize, len(batch); want != have {
+			t.Errorf("batch size: want %d, have %d", want, have)
+		}
+		time.Sleep(latency)
+		atomic.AddInt32(&received, int32(len(batch)))
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL,
+		JSONHTTPBatchSize(batchSize),
+		JSONHTTPMaxBacklog(spans),
+		JSONHTTPConcurrency(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < spans; i++ {
+		if err := c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, uint64(i+1), 0, nil, false)); err != nil {
+			t.Fatalf("error during collection: %v", err)
+		}
+	}
+	// Close waits for the backlog to be sent by all workers
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	if want, have := int32(spans), atomic.LoadInt32(&received); want != have {
+		t.Errorf("received spans: want %d, have %d", want, have)
+	}
+	if have := atomic.LoadInt32(&maxIn); have < 2 {
+		t.Errorf("want concurrent requests, have at most %d", have)
+	}
+	// sequential sending takes spans/batchSize * latency
+	if sequential := spans / batchSize * latency; elapsed >= sequential/2 {
+		t.Errorf("want less than %s, have %s", sequential/2, elapsed)
+	}
+}
+
+func TestHTTPCollectorsPing(t *testing.T) {
+	t.Parallel()
+
+	for _, status := range []int{http.StatusOK, http.StatusAccepted, http.StatusServiceUnavailable} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				t.Errorf("method: want POST, have %s", r.Method)
+			}
+			w.WriteHeader(status)
+		}))
+
+		jsonCollector, err := NewJSONHTTPCollector(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thriftCollector, err := NewHTTPCollector(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, p := range map[string]interface{}{
+			"json":   jsonCollector,
+			"thrift": thriftCollector,
+		} {
+			err := p.(Pinger).Ping(context.Background())
+			if want, have := status >= 300, err != nil; want != have {
+				t.Errorf("%s: status %d: want error %t, have %v", name, status, want, err)
+			}
+		}
+		jsonCollector.Close()
+		thriftCollector.Close()
+		server.Close()
+	}
+
+	// ping honors the context
+	c, err := NewJSONHTTPCollector("http://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.(Pinger).Ping(ctx); err == nil {
+		t.Error("canceled context: want error, have nil")
+	}
+}
@@ -2,6 +2,8 @@ package zipkintracer
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -125,6 +127,12 @@ func (c *HTTPCollector) Collect(s *zipkincore.Span) error {
 	return nil
 }
 
+// Saturation returns the fill level of the backlog between 0 (empty) and 1
+// (full, spans are being disposed), see AdaptiveSamplerBackpressure.
+func (c *HTTPCollector) Saturation() float64 {
+	return saturation(len(c.spanc), cap(c.spanc))
+}
+
 // Close implements Collector.
 func (c *HTTPCollector) Close() error {
 	close(c.quit)
@@ -209,3 +217,26 @@ func (c *HTTPCollector) send(sendBatch []*zipkincore.Span) error {
 	}
 	return nil
 }
+
+// Ping checks whether Zipkin is reachable and accepts spans by sending an
+// empty batch. It returns an error if the request fails or Zipkin responds
+// with a non 2xx status code, e.g. for use in readiness probes.
+func (c *HTTPCollector) Ping(ctx context.Context) error {
+	req, err := http.NewRequest("POST", c.url, httpSerialize(nil))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-thrift")
+	if c.reqCallback != nil {
+		c.reqCallback(req)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP POST ping failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package zipkintracer
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -363,8 +364,13 @@ func newHTTPServer(t *testing.T, port int) *httpServer {
 		time.Sleep(serverSleep)
 	})
 
+	// listen before returning so collectors don't race the server startup.
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
 	go func() {
-		http.ListenAndServe(fmt.Sprintf(":%d", port), handler)
+		http.Serve(ln, handler)
 	}()
 
 	return server
@@ -1,6 +1,8 @@
 package zipkintracer
 
 import (
+	"fmt"
+
 	"github.com/Shopify/sarama"
 	"github.com/apache/thrift/lib/go/thrift"
 
@@ -18,6 +20,7 @@ type KafkaCollector struct {
 	producer sarama.AsyncProducer
 	logger   Logger
 	topic    string
+	key      func(*zipkincore.Span) []byte
 }
 
 // KafkaOption sets a parameter for the KafkaCollector
@@ -40,6 +43,39 @@ func KafkaTopic(t string) KafkaOption {
 	return func(c *KafkaCollector) { c.topic = t }
 }
 
+// KafkaPartitionKey sets the function deriving the message key of a span, which
+// determines the partition it is produced to. Use KafkaTraceIDKey to keep all
+// spans of a trace on one partition or KafkaServiceNameKey to group them by
+// service. A nil key, returned by the function or as default, leaves the
+// partitioning to the producer, e.g. round-robin.
+func KafkaPartitionKey(key func(*zipkincore.Span) []byte) KafkaOption {
+	return func(c *KafkaCollector) { c.key = key }
+}
+
+// KafkaTraceIDKey keys a span by its hex encoded trace ID.
+func KafkaTraceIDKey(s *zipkincore.Span) []byte {
+	if s.TraceIDHigh != nil && *s.TraceIDHigh != 0 {
+		return []byte(fmt.Sprintf("%016x%016x", uint64(*s.TraceIDHigh), uint64(s.TraceID)))
+	}
+	return []byte(fmt.Sprintf("%016x", uint64(s.TraceID)))
+}
+
+// KafkaServiceNameKey keys a span by the service name of its first annotation
+// carrying an endpoint. Spans without service name are not keyed.
+func KafkaServiceNameKey(s *zipkincore.Span) []byte {
+	for _, a := range s.Annotations {
+		if a.Host != nil && a.Host.ServiceName != "" {
+			return []byte(a.Host.ServiceName)
+		}
+	}
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Host != nil && ba.Host.ServiceName != "" {
+			return []byte(ba.Host.ServiceName)
+		}
+	}
+	return nil
+}
+
 // NewKafkaCollector returns a new Kafka-backed Collector. addrs should be a
 // slice of TCP endpoints of the form "host:port".
 func NewKafkaCollector(addrs []string, options ...KafkaOption) (Collector, error) {
@@ -72,11 +108,17 @@ func (c *KafkaCollector) logErrors() {
 
 // Collect implements Collector.
 func (c *KafkaCollector) Collect(s *zipkincore.Span) error {
-	c.producer.Input() <- &sarama.ProducerMessage{
+	m := &sarama.ProducerMessage{
 		Topic: c.topic,
 		Key:   nil,
 		Value: sarama.ByteEncoder(kafkaSerialize(s)),
 	}
+	if c.key != nil {
+		if key := c.key(s); key != nil {
+			m.Key = sarama.ByteEncoder(key)
+		}
+	}
+	c.producer.Input() <- m
 	return nil
 }
 
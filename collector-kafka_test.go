@@ -63,6 +63,59 @@ func TestKafkaProduce(t *testing.T) {
 	}
 }
 
+func TestKafkaPartitionKey(t *testing.T) {
+	high := int64(0x5759e988bd862e3f)
+	span128 := makeNewSpan("203.0.113.10:1234", "service1", "avg", 123, 456, 0, true)
+	span128.TraceIDHigh = &high
+	spanWithService := makeNewSpan("203.0.113.10:1234", "service2", "sum", 123, 789, 456, true)
+	spanWithService.Annotations = []*zipkincore.Annotation{
+		{Value: zipkincore.SERVER_RECV, Host: &zipkincore.Endpoint{ServiceName: "service2"}},
+	}
+
+	for _, test := range []struct {
+		name string
+		key  func(*zipkincore.Span) []byte
+		span *zipkincore.Span
+		want string
+	}{
+		{"trace id", KafkaTraceIDKey, spans[0], "000000000000007b"},
+		{"128 bit trace id", KafkaTraceIDKey, span128, "5759e988bd862e3f000000000000007b"},
+		{"service name", KafkaServiceNameKey, spanWithService, "service2"},
+		{"custom", func(*zipkincore.Span) []byte { return []byte("custom") }, spans[2], "custom"},
+	} {
+		p := newStubProducer(false)
+		c, err := NewKafkaCollector(
+			[]string{"192.0.2.10:9092"}, KafkaProducer(p), KafkaPartitionKey(test.key),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := collectSpan(t, c, p, test.span)
+		if m.Key == nil {
+			t.Fatalf("%s: want key %q, have nil", test.name, test.want)
+		}
+		key, err := m.Key.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := test.want, string(key); want != have {
+			t.Errorf("%s: key: want %q, have %q", test.name, want, have)
+		}
+	}
+
+	// a nil key leaves partitioning to the producer
+	p := newStubProducer(false)
+	c, err := NewKafkaCollector(
+		[]string{"192.0.2.10:9092"},
+		KafkaProducer(p),
+		KafkaPartitionKey(func(*zipkincore.Span) []byte { return nil }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMetadata(t, collectSpan(t, c, p, spans[0]))
+}
+
 func TestKafkaClose(t *testing.T) {
 	p := newStubProducer(false)
 	c, err := NewKafkaCollector(
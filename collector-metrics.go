@@ -0,0 +1,97 @@
+package zipkintracer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MetricsCollector is an AgnosticCollector which transparently wraps another
+// AgnosticCollector and counts its activity. The counters can be read through
+// its accessor methods, allowing them to be bridged to any metrics system.
+//
+// Batches are internal to the wrapped collector. To record batch sizes and
+// send errors, register ObserveBatch with the wrapped collector, e.g.:
+//  var m *MetricsCollector
+//  c, _ := NewJSONHTTPCollector(url, JSONHTTPBatchCallback(func(size int, err error) {
+//  	m.ObserveBatch(size, err)
+//  }))
+//  m = NewMetricsCollector(c)
+type MetricsCollector struct {
+	// 64 bit fields first for atomic alignment on 32 bit platforms.
+	submitted   uint64
+	dropped     uint64
+	batches     uint64
+	batchErrors uint64
+
+	next       AgnosticCollector
+	mtx        sync.Mutex
+	batchSizes map[int]uint64
+}
+
+// NewMetricsCollector returns a MetricsCollector wrapping next.
+func NewMetricsCollector(next AgnosticCollector) *MetricsCollector {
+	return &MetricsCollector{
+		next:       next,
+		batchSizes: make(map[int]uint64),
+	}
+}
+
+// Collect implements AgnosticCollector. Spans rejected by the wrapped
+// collector are counted as dropped.
+func (m *MetricsCollector) Collect(s *CoreSpan) error {
+	atomic.AddUint64(&m.submitted, 1)
+	err := m.next.Collect(s)
+	if err != nil {
+		atomic.AddUint64(&m.dropped, 1)
+	}
+	return err
+}
+
+// Close implements AgnosticCollector.
+func (m *MetricsCollector) Close() error {
+	return m.next.Close()
+}
+
+// ObserveBatch records a batch of size spans sent by the wrapped collector. A
+// non nil err marks the batch as failed.
+func (m *MetricsCollector) ObserveBatch(size int, err error) {
+	atomic.AddUint64(&m.batches, 1)
+	if err != nil {
+		atomic.AddUint64(&m.batchErrors, 1)
+	}
+	m.mtx.Lock()
+	m.batchSizes[size]++
+	m.mtx.Unlock()
+}
+
+// SpansSubmitted returns the number of spans submitted to the collector.
+func (m *MetricsCollector) SpansSubmitted() uint64 {
+	return atomic.LoadUint64(&m.submitted)
+}
+
+// SpansDropped returns the number of spans rejected by the wrapped collector.
+func (m *MetricsCollector) SpansDropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// Batches returns the number of batches observed.
+func (m *MetricsCollector) Batches() uint64 {
+	return atomic.LoadUint64(&m.batches)
+}
+
+// BatchErrors returns the number of batches which failed to send.
+func (m *MetricsCollector) BatchErrors() uint64 {
+	return atomic.LoadUint64(&m.batchErrors)
+}
+
+// BatchSizes returns a histogram of the observed batch sizes, mapping batch
+// size to the number of batches of that size.
+func (m *MetricsCollector) BatchSizes() map[int]uint64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	sizes := make(map[int]uint64, len(m.batchSizes))
+	for size, n := range m.batchSizes {
+		sizes[size] = n
+	}
+	return sizes
+}
@@ -0,0 +1,87 @@
+package zipkintracer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	stub := &stubAgnosticCollector{}
+	m := NewMetricsCollector(stub)
+
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+	for i := 0; i < 3; i++ {
+		if err := m.Collect(span); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	stub.err = ErrQueueFull
+	if want, have := ErrQueueFull, m.Collect(span); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	if want, have := uint64(4), m.SpansSubmitted(); want != have {
+		t.Errorf("spans submitted: want %d, have %d", want, have)
+	}
+	if want, have := uint64(1), m.SpansDropped(); want != have {
+		t.Errorf("spans dropped: want %d, have %d", want, have)
+	}
+	if want, have := 3, len(stub.spans); want != have {
+		t.Errorf("spans passed on: want %d, have %d", want, have)
+	}
+}
+
+func TestMetricsCollectorBatches(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the second batch
+		if atomic.AddInt32(&requests, 1) == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var m *MetricsCollector
+	c, err := NewJSONHTTPCollector(server.URL,
+		JSONHTTPBatchSize(2),
+		JSONHTTPBatchCallback(func(size int, err error) { m.ObserveBatch(size, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewMetricsCollector(c)
+
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+	for i := 0; i < 5; i++ {
+		if err := m.Collect(span); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if err = eventually(func() bool { return m.Batches() == 2 }, time.Second); err != nil {
+		t.Fatalf("want 2 batches, have %d", m.Batches())
+	}
+	// the remaining span is sent on close
+	if err := m.Close(); err != nil {
+		t.Errorf("unexpected error on close: %+v", err)
+	}
+
+	if want, have := uint64(5), m.SpansSubmitted(); want != have {
+		t.Errorf("spans submitted: want %d, have %d", want, have)
+	}
+	if want, have := uint64(0), m.SpansDropped(); want != have {
+		t.Errorf("spans dropped: want %d, have %d", want, have)
+	}
+	if want, have := uint64(3), m.Batches(); want != have {
+		t.Errorf("batches: want %d, have %d", want, have)
+	}
+	if want, have := uint64(1), m.BatchErrors(); want != have {
+		t.Errorf("batch errors: want %d, have %d", want, have)
+	}
+	if want, have := map[int]uint64{2: 2, 1: 1}, m.BatchSizes(); !reflect.DeepEqual(want, have) {
+		t.Errorf("batch sizes: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,180 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+// otlpScopeName is the instrumentation scope reported for all spans.
+const otlpScopeName = "zipkin-go-opentracing"
+
+// OTLP span kinds.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+	otlpSpanKindProducer = 4
+	otlpSpanKindConsumer = 5
+)
+
+// otlpStatusCodeError is the OTLP status code of failed spans.
+const otlpStatusCodeError = 2
+
+// otlpTraceFlagSampled is the W3C sampled trace flag. Only sampled spans are
+// recorded.
+const otlpTraceFlagSampled = 1
+
+// NewOTLPHTTPCollector returns a new HTTP-backend Collector sending spans in
+// the OpenTelemetry OTLP/HTTP JSON encoding to the /v1/traces path of
+// endpoint, e.g. "http://otel-collector:4318". It supports the options of the
+// JSONHTTPCollector.
+//
+// Spans are grouped into resources by service name. Binary annotations become
+// attributes, except for the local component and remote endpoints which map
+// onto the resource and the peer.service attribute, and the error annotation
+// which sets the span status. The span kind is derived from the core
+// annotations, the remaining timestamped annotations become events.
+func NewOTLPHTTPCollector(endpoint string, options ...JSONHTTPOption) (AgnosticCollector, error) {
+	options = append([]JSONHTTPOption{func(c *JSONHTTPCollector) { c.encode = encodeOTLPBatch }}, options...)
+	return NewJSONHTTPCollector(strings.TrimSuffix(endpoint, "/")+"/v1/traces", options...)
+}
+
+// The OTLP JSON encoding of an ExportTraceServiceRequest. 64-bit integers are
+// encoded as strings as the protobuf JSON mapping requires.
+type otlpTracesData struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Flags             uint32         `json:"flags"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string `json:"timeUnixNano"`
+	Name         string `json:"name"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// encodeOTLPBatch encodes spans as an OTLP JSON ExportTraceServiceRequest.
+func encodeOTLPBatch(w io.Writer, spans []*CoreSpan) error {
+	data := otlpTracesData{ResourceSpans: []*otlpResourceSpans{}}
+	resources := make(map[string]*otlpResourceSpans)
+	for _, s := range spans {
+		serviceName := coreSpanServiceName(s)
+		rs, ok := resources[serviceName]
+		if !ok {
+			rs = &otlpResourceSpans{
+				Resource: otlpResource{Attributes: []otlpKeyValue{
+					otlpAttribute("service.name", serviceName),
+				}},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otlpScopeName}}},
+			}
+			resources[serviceName] = rs
+			data.ResourceSpans = append(data.ResourceSpans, rs)
+		}
+		rs.ScopeSpans[0].Spans = append(rs.ScopeSpans[0].Spans, toOTLPSpan(s))
+	}
+	return json.NewEncoder(w).Encode(data)
+}
+
+// toOTLPSpan maps a span onto an OTLP span.
+func toOTLPSpan(s *CoreSpan) *otlpSpan {
+	start := coreSpanStart(s)
+
+	span := &otlpSpan{
+		TraceID:           coreSpanTraceID128(s),
+		SpanID:            s.ID,
+		ParentSpanID:      s.ParentID,
+		Flags:             otlpTraceFlagSampled,
+		Name:              s.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(start*1e3, 10),
+		EndTimeUnixNano:   strconv.FormatInt((start+s.Duration)*1e3, 10),
+	}
+
+	for _, a := range s.Annotations {
+		switch a.Value {
+		case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV:
+			span.Kind = otlpSpanKindClient
+		case zipkincore.SERVER_RECV, zipkincore.SERVER_SEND:
+			span.Kind = otlpSpanKindServer
+		case MessageSend:
+			span.Kind = otlpSpanKindProducer
+		case MessageRecv:
+			span.Kind = otlpSpanKindConsumer
+		default:
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(a.Timestamp*1e3, 10),
+				Name:         a.Value,
+			})
+		}
+	}
+
+	for _, ba := range s.BinaryAnnotations {
+		switch ba.Key {
+		case zipkincore.LOCAL_COMPONENT:
+			// the local service is reflected in the resource
+		case zipkincore.SERVER_ADDR, zipkincore.CLIENT_ADDR:
+			if ba.Endpoint.ServiceName != "" {
+				span.Attributes = append(span.Attributes, otlpAttribute("peer.service", ba.Endpoint.ServiceName))
+			}
+		case zipkincore.ERROR:
+			span.Status = &otlpStatus{Code: otlpStatusCodeError}
+			if ba.Value != "true" {
+				span.Status.Message = ba.Value
+			}
+		default:
+			span.Attributes = append(span.Attributes, otlpAttribute(ba.Key, ba.Value))
+		}
+	}
+	return span
+}
+
+func otlpAttribute(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
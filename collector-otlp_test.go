@@ -0,0 +1,127 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
+)
+
+func TestOTLPHTTPCollector(t *testing.T) {
+	type request struct {
+		path string
+		body otlpTracesData
+		err  error
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		req.path = r.URL.Path
+		req.err = json.NewDecoder(r.Body).Decode(&req.body)
+		requests <- req
+	}))
+	defer server.Close()
+
+	c, err := NewOTLPHTTPCollector(server.URL+"/", JSONHTTPSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	host := &CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "otlp-service"}
+	err = c.Collect(&CoreSpan{
+		TraceID:   "0123456789abcdef",
+		Name:      "get",
+		ID:        "00000000000000bb",
+		ParentID:  "00000000000000aa",
+		Timestamp: 1500000000000000,
+		Duration:  250000,
+		Annotations: []*CoreAnnotation{
+			{Timestamp: 1500000000000000, Value: zipkincore.CLIENT_SEND, Host: host},
+			{Timestamp: 1500000000100000, Value: "retry", Host: host},
+			{Timestamp: 1500000000250000, Value: zipkincore.CLIENT_RECV, Host: host},
+		},
+		BinaryAnnotations: []*CoreBinaryAnnotation{
+			{Key: zipkincore.SERVER_ADDR, Value: "true", Endpoint: CoreEndpoint{ServiceName: "backend"}},
+			{Key: "http.method", Value: "GET", Endpoint: *host},
+			{Key: zipkincore.ERROR, Value: "timeout", Endpoint: *host},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if req.err != nil {
+		t.Fatalf("unable to decode request: %+v", req.err)
+	}
+	if want, have := "/v1/traces", req.path; want != have {
+		t.Errorf("path: want %q, have %q", want, have)
+	}
+	if want, have := 1, len(req.body.ResourceSpans); want != have {
+		t.Fatalf("resource spans: want %d, have %d", want, have)
+	}
+	rs := req.body.ResourceSpans[0]
+	if want, have := []otlpKeyValue{otlpAttribute("service.name", "otlp-service")}, rs.Resource.Attributes; !reflect.DeepEqual(want, have) {
+		t.Errorf("resource attributes: want %v, have %v", want, have)
+	}
+	if want, have := 1, len(rs.ScopeSpans); want != have {
+		t.Fatalf("scope spans: want %d, have %d", want, have)
+	}
+	if want, have := 1, len(rs.ScopeSpans[0].Spans); want != have {
+		t.Fatalf("spans: want %d, have %d", want, have)
+	}
+
+	span := rs.ScopeSpans[0].Spans[0]
+	for _, test := range []struct {
+		name       string
+		want, have interface{}
+	}{
+		{"trace id", "00000000000000000123456789abcdef", span.TraceID},
+		{"span id", "00000000000000bb", span.SpanID},
+		{"parent span id", "00000000000000aa", span.ParentSpanID},
+		{"flags", uint32(otlpTraceFlagSampled), span.Flags},
+		{"name", "get", span.Name},
+		{"kind", otlpSpanKindClient, span.Kind},
+		{"start", "1500000000000000000", span.StartTimeUnixNano},
+		{"end", "1500000000250000000", span.EndTimeUnixNano},
+	} {
+		if test.want != test.have {
+			t.Errorf("%s: want %v, have %v", test.name, test.want, test.have)
+		}
+	}
+	attributes := map[string]string{}
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value.StringValue
+	}
+	if want, have := map[string]string{"peer.service": "backend", "http.method": "GET"}, attributes; !reflect.DeepEqual(want, have) {
+		t.Errorf("attributes: want %v, have %v", want, have)
+	}
+	if want, have := []otlpEvent{{TimeUnixNano: "1500000000100000000", Name: "retry"}}, span.Events; !reflect.DeepEqual(want, have) {
+		t.Errorf("events: want %v, have %v", want, have)
+	}
+	if span.Status == nil || *span.Status != (otlpStatus{Code: otlpStatusCodeError, Message: "timeout"}) {
+		t.Errorf("status: want error, have %+v", span.Status)
+	}
+}
+
+func TestOTLPTraceID128Bit(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc").RecordSpan(RawSpan{
+		Context: SpanContext{
+			TraceID: types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a},
+			SpanID:  1,
+			Sampled: true,
+		},
+		Operation: "get",
+		Start:     time.Unix(1500000000, 0),
+	})
+	if want, have := "5759e988bd862e3fe1be023e8ff6d22a", toOTLPSpan(c.spans[0]).TraceID; want != have {
+		t.Errorf("trace id: want %q, have %q", want, have)
+	}
+}
@@ -3,6 +3,7 @@ package zipkintracer
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -23,13 +24,17 @@ const defaultScribeBatchSize = 100
 
 const defaultScribeMaxBacklog = 1000
 
+// errScribeReconnectBackoff is returned by send while waiting to reconnect.
+var errScribeReconnectBackoff = errors.New("waiting to reconnect")
+
 // ScribeCollector implements Collector by forwarding spans to a Scribe
 // service, in batches.
 type ScribeCollector struct {
 	logger        Logger
 	category      string
-	factory       func() (scribe.Scribe, error)
+	factory       func() (scribe.Scribe, thrift.TTransport, error)
 	client        scribe.Scribe
+	transport     thrift.TTransport
 	batchInterval time.Duration
 	batchSize     int
 	maxBacklog    int
@@ -39,6 +44,9 @@ type ScribeCollector struct {
 	shutdown      chan error
 	sendMutex     *sync.Mutex
 	batchMutex    *sync.Mutex
+	// reconnect state, guarded by sendMutex.
+	reconnectBackoff time.Duration
+	nextReconnect    time.Time
 }
 
 // ScribeOption sets a parameter for the StdlibAdapter.
@@ -59,7 +67,8 @@ func ScribeBatchSize(n int) ScribeOption {
 
 // ScribeMaxBacklog sets the maximum backlog size,
 // when batch size reaches this threshold, spans from the
-// beginning of the batch will be disposed
+// beginning of the batch will be disposed. Spans which could
+// not be sent, e.g. while reconnecting, remain in the backlog.
 func ScribeMaxBacklog(n int) ScribeOption {
 	return func(c *ScribeCollector) { c.maxBacklog = n }
 }
@@ -70,6 +79,13 @@ func ScribeBatchInterval(d time.Duration) ScribeOption {
 	return func(s *ScribeCollector) { s.batchInterval = d }
 }
 
+// ScribeReconnectBackoff sets the minimum duration between attempts to
+// reconnect to Scribe after the connection broke. Spans collected meanwhile are
+// kept in the backlog. By default a reconnect is attempted on every send.
+func ScribeReconnectBackoff(d time.Duration) ScribeOption {
+	return func(s *ScribeCollector) { s.reconnectBackoff = d }
+}
+
 // ScribeCategory sets the Scribe category used to transmit the spans.
 func ScribeCategory(category string) ScribeOption {
 	return func(s *ScribeCollector) { s.category = category }
@@ -83,7 +99,7 @@ func ScribeCategory(category string) ScribeOption {
 // send failures; users should provide an appropriate context, if desired.
 func NewScribeCollector(addr string, timeout time.Duration, options ...ScribeOption) (Collector, error) {
 	factory := scribeClientFactory(addr, timeout)
-	client, err := factory()
+	client, transport, err := factory()
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +108,7 @@ func NewScribeCollector(addr string, timeout time.Duration, options ...ScribeOpt
 		category:      defaultScribeCategory,
 		factory:       factory,
 		client:        client,
+		transport:     transport,
 		batchInterval: defaultScribeBatchInterval * time.Second,
 		batchSize:     defaultScribeBatchSize,
 		maxBacklog:    defaultScribeMaxBacklog,
@@ -198,14 +215,22 @@ func (c *ScribeCollector) send() error {
 	}
 
 	if c.client == nil {
+		if time.Now().Before(c.nextReconnect) {
+			return errScribeReconnectBackoff
+		}
 		var err error
-		if c.client, err = c.factory(); err != nil {
+		if c.client, c.transport, err = c.factory(); err != nil {
+			c.nextReconnect = time.Now().Add(c.reconnectBackoff)
 			_ = c.logger.Log("err", fmt.Sprintf("during reconnect: %v", err))
 			return err
 		}
 	}
 	if rc, err := c.client.Log(context.Background(), sendBatch); err != nil {
-		c.client = nil
+		// the connection is likely broken; release it and back off before
+		// reconnecting, as after a failed reconnect
+		_ = c.transport.Close()
+		c.client, c.transport = nil, nil
+		c.nextReconnect = time.Now().Add(c.reconnectBackoff)
 		_ = c.logger.Log("err", fmt.Sprintf("during Log: %v", err))
 		return err
 	} else if rc != scribe.ResultCode_OK {
@@ -221,20 +246,20 @@ func (c *ScribeCollector) send() error {
 	return nil
 }
 
-func scribeClientFactory(addr string, timeout time.Duration) func() (scribe.Scribe, error) {
-	return func() (scribe.Scribe, error) {
+func scribeClientFactory(addr string, timeout time.Duration) func() (scribe.Scribe, thrift.TTransport, error) {
+	return func() (scribe.Scribe, thrift.TTransport, error) {
 		a, err := net.ResolveTCPAddr("tcp", addr)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		socket := thrift.NewTSocketFromAddrTimeout(a, timeout)
 		transport := thrift.NewTFramedTransport(socket)
 		if err := transport.Open(); err != nil {
 			_ = socket.Close()
-			return nil, err
+			return nil, nil, err
 		}
 		proto := thrift.NewTBinaryProtocolTransport(transport)
 		client := scribe.NewScribeClientProtocol(transport, proto, proto)
-		return client, nil
+		return client, transport, nil
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"sync"
@@ -71,6 +72,165 @@ func TestScribeCollector(t *testing.T) {
 	}
 }
 
+func TestScribeCollectorReconnect(t *testing.T) {
+	server := newScribeServer(t)
+	proxy := newTCPProxy(t, server.addr())
+
+	c, err := NewScribeCollector(proxy.addr, time.Second,
+		ScribeBatchSize(0),
+		ScribeBatchInterval(time.Millisecond),
+		ScribeMaxBacklog(3),
+		ScribeReconnectBackoff(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	collect := func(spanID int64) {
+		span := makeNewSpan("1.2.3.4:1234", "service", "method", 123, spanID, 0, false)
+		if err := c.Collect(span); err != nil {
+			t.Errorf("error during collection: %v", err)
+		}
+	}
+
+	collect(1)
+	if err := eventually(func() bool { return len(server.spans()) == 1 }, time.Second); err != nil {
+		t.Fatal("never received the first span")
+	}
+
+	// spans collected during the outage are kept in the bounded backlog
+	proxy.kill()
+	for spanID := int64(2); spanID <= 6; spanID++ {
+		collect(spanID)
+	}
+	time.Sleep(50 * time.Millisecond)
+	proxy.restore()
+
+	if err := eventually(func() bool { return len(server.spans()) == 4 }, time.Second); err != nil {
+		t.Fatalf("want 4 spans, have %d", len(server.spans()))
+	}
+	for i, span := range server.spans()[1:] {
+		if want, have := int64(i+4), span.ID; want != have {
+			t.Errorf("want span %d, have %d", want, have)
+		}
+	}
+}
+
+func TestScribeCollectorLogFailure(t *testing.T) {
+	var (
+		transport = &closeRecordingTransport{TMemoryBuffer: thrift.NewTMemoryBuffer()}
+		dials     int
+	)
+	c := &ScribeCollector{
+		logger: NewNopLogger(),
+		factory: func() (scribe.Scribe, thrift.TTransport, error) {
+			dials++
+			return failingScribeClient{}, thrift.NewTMemoryBuffer(), nil
+		},
+		client:           failingScribeClient{},
+		transport:        transport,
+		batch:            []*scribe.LogEntry{{Category: "zipkin"}},
+		sendMutex:        &sync.Mutex{},
+		batchMutex:       &sync.Mutex{},
+		reconnectBackoff: time.Hour,
+	}
+
+	if err := c.send(); err == nil {
+		t.Fatal("want error, have nil")
+	}
+	if want, have := 1, transport.closed; want != have {
+		t.Errorf("want %d transport close, have %d", want, have)
+	}
+
+	// the next batch waits for the backoff instead of reconnecting right away
+	if want, have := errScribeReconnectBackoff, c.send(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 0, dials; want != have {
+		t.Errorf("want %d reconnects, have %d", want, have)
+	}
+}
+
+type failingScribeClient struct{}
+
+func (failingScribeClient) Log(context.Context, []*scribe.LogEntry) (scribe.ResultCode, error) {
+	return scribe.ResultCode_TRY_LATER, io.ErrUnexpectedEOF
+}
+
+type closeRecordingTransport struct {
+	*thrift.TMemoryBuffer
+	closed int
+}
+
+func (t *closeRecordingTransport) Close() error {
+	t.closed++
+	return t.TMemoryBuffer.Close()
+}
+
+// tcpProxy forwards connections to a backend and allows to simulate an outage
+// by closing its listener and all connections.
+type tcpProxy struct {
+	t       *testing.T
+	addr    string
+	backend string
+	mu      sync.Mutex
+	ln      net.Listener
+	conns   []net.Conn
+}
+
+func newTCPProxy(t *testing.T, backend string) *tcpProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &tcpProxy{t: t, addr: ln.Addr().String(), backend: backend}
+	p.serve(ln)
+	return p
+}
+
+func (p *tcpProxy) serve(ln net.Listener) {
+	p.mu.Lock()
+	p.ln = ln
+	p.mu.Unlock()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", p.backend)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, conn, upstream)
+			p.mu.Unlock()
+			go io.Copy(upstream, conn)
+			go io.Copy(conn, upstream)
+		}
+	}()
+}
+
+func (p *tcpProxy) kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ln.Close()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+func (p *tcpProxy) restore() {
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.serve(ln)
+}
+
 type scribeServer struct {
 	t         *testing.T
 	transport *thrift.TServerSocket
@@ -0,0 +1,261 @@
+package zipkintracer
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultTraceBatchingMaxTraces is the default number of traces buffered by
+// the TraceBatchingCollector.
+const defaultTraceBatchingMaxTraces = 1000
+
+// defaultTraceBatchingMaxSpans is the default number of spans buffered per
+// trace by the TraceBatchingCollector.
+const defaultTraceBatchingMaxSpans = 1000
+
+// TraceBatchingCollector is an AgnosticCollector which buffers spans by trace
+// and passes all spans of a trace on to the wrapped AgnosticCollector together
+// once no span of the trace arrived for the idle timeout, or the trace reached
+// its maximum age. If the wrapped collector implements AgnosticBatchCollector,
+// the spans of a trace are passed on in a single CollectBatch call.
+//
+// At most a configurable number of traces is buffered; if a span of another
+// trace arrives the oldest trace is passed on early, as is a trace reaching
+// the maximum number of spans. Traces are always passed on from a background
+// goroutine, so Collect never waits for the wrapped collector. If the wrapped
+// collector falls behind by more than the maximum number of traces, the
+// oldest traces waiting to be passed on are dropped, see DroppedSpans.
+type TraceBatchingCollector struct {
+	next        AgnosticCollector
+	idleTimeout time.Duration
+	maxAge      time.Duration
+	maxTraces   int
+	maxSpans    int
+	now         func() time.Time
+	quit        chan struct{}
+	done        chan struct{}
+	evict       chan struct{}
+
+	mtx     sync.Mutex
+	order   *list.List // of *pendingTrace, oldest first
+	traces  map[traceKey]*list.Element
+	evicted []*pendingTrace // removed to make room, not yet passed on
+	dropped uint64
+}
+
+// traceKey identifies a trace within the TraceBatchingCollector.
+type traceKey struct {
+	traceIDHigh, traceID string
+}
+
+// pendingTrace holds the buffered spans of a trace.
+type pendingTrace struct {
+	key         traceKey
+	spans       []*CoreSpan
+	first, last time.Time
+}
+
+// TraceBatchingOption sets a parameter for the TraceBatchingCollector
+type TraceBatchingOption func(c *TraceBatchingCollector)
+
+// TraceBatchingMaxAge sets the longest time the spans of a trace are buffered,
+// even if spans keep arriving. By default there is no maximum age.
+func TraceBatchingMaxAge(d time.Duration) TraceBatchingOption {
+	return func(c *TraceBatchingCollector) { c.maxAge = d }
+}
+
+// TraceBatchingMaxTraces sets the maximum number of traces buffered. The
+// default is 1000, values below 1 are ignored.
+func TraceBatchingMaxTraces(n int) TraceBatchingOption {
+	return func(c *TraceBatchingCollector) {
+		if n > 0 {
+			c.maxTraces = n
+		}
+	}
+}
+
+// TraceBatchingMaxSpans sets the maximum number of spans buffered per trace.
+// The default is 1000, values below 1 are ignored.
+func TraceBatchingMaxSpans(n int) TraceBatchingOption {
+	return func(c *TraceBatchingCollector) {
+		if n > 0 {
+			c.maxSpans = n
+		}
+	}
+}
+
+// NewTraceBatchingCollector returns a TraceBatchingCollector wrapping next,
+// passing traces on once idle for idleTimeout.
+func NewTraceBatchingCollector(next AgnosticCollector, idleTimeout time.Duration, options ...TraceBatchingOption) *TraceBatchingCollector {
+	c := &TraceBatchingCollector{
+		next:        next,
+		idleTimeout: idleTimeout,
+		maxTraces:   defaultTraceBatchingMaxTraces,
+		maxSpans:    defaultTraceBatchingMaxSpans,
+		now:         time.Now,
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+		evict:       make(chan struct{}, 1),
+		order:       list.New(),
+		traces:      make(map[traceKey]*list.Element),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	go c.loop()
+	return c
+}
+
+// Collect implements AgnosticCollector.
+func (c *TraceBatchingCollector) Collect(s *CoreSpan) error {
+	key := traceKey{traceIDHigh: s.TraceIDHigh, traceID: s.TraceID}
+	now := c.now()
+
+	c.mtx.Lock()
+	evicted := false
+	if el, ok := c.traces[key]; ok {
+		trace := el.Value.(*pendingTrace)
+		trace.spans = append(trace.spans, s)
+		trace.last = now
+		if len(trace.spans) >= c.maxSpans {
+			c.evictLocked(c.remove(el))
+			evicted = true
+		}
+	} else {
+		if c.order.Len() >= c.maxTraces {
+			c.evictLocked(c.remove(c.order.Front()))
+			evicted = true
+		}
+		c.traces[key] = c.order.PushBack(&pendingTrace{
+			key:   key,
+			spans: []*CoreSpan{s},
+			first: now,
+			last:  now,
+		})
+	}
+	c.mtx.Unlock()
+
+	if evicted {
+		// wake up the loop, unless it is already due to pass evicted
+		// traces on
+		select {
+		case c.evict <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close implements AgnosticCollector. All buffered traces are passed on
+// before the wrapped collector is closed.
+func (c *TraceBatchingCollector) Close() error {
+	close(c.quit)
+	<-c.done
+
+	c.mtx.Lock()
+	traces := c.takeEvicted()
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		traces = append(traces, c.remove(el))
+	}
+	c.mtx.Unlock()
+
+	for _, trace := range traces {
+		c.flush(trace)
+	}
+	return c.next.Close()
+}
+
+// remove removes a trace from the buffer, the caller must hold mtx.
+func (c *TraceBatchingCollector) remove(el *list.Element) *pendingTrace {
+	trace := c.order.Remove(el).(*pendingTrace)
+	delete(c.traces, trace.key)
+	return trace
+}
+
+// DroppedSpans returns the number of spans dropped because the wrapped
+// collector fell behind.
+func (c *TraceBatchingCollector) DroppedSpans() uint64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.dropped
+}
+
+// evictLocked queues a trace removed from the buffer to be passed on by the
+// loop, dropping the oldest queued trace if the queue is full. The caller must
+// hold mtx.
+func (c *TraceBatchingCollector) evictLocked(trace *pendingTrace) {
+	if len(c.evicted) >= c.maxTraces {
+		c.dropped += uint64(len(c.evicted[0].spans))
+		c.evicted[0] = nil
+		c.evicted = c.evicted[1:]
+	}
+	c.evicted = append(c.evicted, trace)
+}
+
+// takeEvicted returns and clears the evicted traces, the caller must hold mtx.
+func (c *TraceBatchingCollector) takeEvicted() []*pendingTrace {
+	evicted := c.evicted
+	c.evicted = nil
+	return evicted
+}
+
+// flush passes the spans of a trace on to the wrapped collector.
+func (c *TraceBatchingCollector) flush(trace *pendingTrace) {
+	if bc, ok := c.next.(AgnosticBatchCollector); ok {
+		_ = bc.CollectBatch(trace.spans)
+		return
+	}
+	for _, s := range trace.spans {
+		_ = c.next.Collect(s)
+	}
+}
+
+func (c *TraceBatchingCollector) loop() {
+	defer close(c.done)
+	interval := c.idleTimeout
+	if c.maxAge > 0 && c.maxAge < interval {
+		interval = c.maxAge
+	}
+	interval /= 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, trace := range c.expired() {
+				c.flush(trace)
+			}
+		case <-c.evict:
+			c.mtx.Lock()
+			evicted := c.takeEvicted()
+			c.mtx.Unlock()
+			for _, trace := range evicted {
+				c.flush(trace)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// expired removes and returns the traces which are idle or exceeded their
+// maximum age.
+func (c *TraceBatchingCollector) expired() []*pendingTrace {
+	now := c.now()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var expired []*pendingTrace
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		trace := el.Value.(*pendingTrace)
+		if now.Sub(trace.last) >= c.idleTimeout || (c.maxAge > 0 && now.Sub(trace.first) >= c.maxAge) {
+			expired = append(expired, c.remove(el))
+		}
+		el = next
+	}
+	return expired
+}
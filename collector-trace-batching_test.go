@@ -0,0 +1,182 @@
+package zipkintracer
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubBatchCollector records the batches passed to CollectBatch.
+type stubBatchCollector struct {
+	stubAgnosticCollector
+	mtx     sync.Mutex
+	batches [][]*CoreSpan
+}
+
+func (c *stubBatchCollector) CollectBatch(spans []*CoreSpan) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.batches = append(c.batches, spans)
+	return nil
+}
+
+// spanIDs returns the span ids of each batch.
+func (c *stubBatchCollector) spanIDs() [][]string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	ids := make([][]string, 0, len(c.batches))
+	for _, batch := range c.batches {
+		var batchIDs []string
+		for _, span := range batch {
+			batchIDs = append(batchIDs, span.ID)
+		}
+		ids = append(ids, batchIDs)
+	}
+	return ids
+}
+
+func TestTraceBatchingCollector(t *testing.T) {
+	stub := &stubBatchCollector{}
+	c := NewTraceBatchingCollector(stub, 50*time.Millisecond)
+	defer c.Close()
+
+	for _, ids := range [][2]uint64{{1, 1}, {2, 2}, {1, 3}, {2, 4}, {1, 5}} {
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", ids[0], ids[1], 0, nil, false))
+	}
+	if err := eventually(func() bool { return len(stub.spanIDs()) == 2 }, time.Second); err != nil {
+		t.Fatalf("want 2 batches, have %v", stub.spanIDs())
+	}
+	want := [][]string{
+		{"00000001", "00000003", "00000005"},
+		{"00000002", "00000004"},
+	}
+	if have := stub.spanIDs(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 0, len(stub.spans); want != have {
+		t.Errorf("spans collected individually: want %d, have %d", want, have)
+	}
+}
+
+func TestTraceBatchingCollectorLimits(t *testing.T) {
+	stub := &stubBatchCollector{}
+	c := NewTraceBatchingCollector(stub, time.Hour, TraceBatchingMaxTraces(2), TraceBatchingMaxAge(50*time.Millisecond))
+
+	for _, traceID := range []uint64{1, 2, 3} {
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", traceID, traceID, 0, nil, false))
+	}
+	// the oldest trace makes room for the third one
+	if err := eventually(func() bool { return len(stub.spanIDs()) > 0 }, time.Second); err != nil {
+		t.Fatal("max traces: oldest trace not passed on")
+	}
+	if want, have := [][]string{{"00000001"}}, stub.spanIDs(); !reflect.DeepEqual(want, have) {
+		t.Errorf("max traces: want %v, have %v", want, have)
+	}
+	// the remaining traces are flushed once they reach their maximum age
+	if err := eventually(func() bool { return len(stub.spanIDs()) == 3 }, time.Second); err != nil {
+		t.Errorf("max age: want 3 batches, have %v", stub.spanIDs())
+	}
+	c.Close()
+}
+
+// blockingBatchCollector blocks in CollectBatch until release is closed.
+type blockingBatchCollector struct {
+	stubBatchCollector
+	release chan struct{}
+}
+
+func (c *blockingBatchCollector) CollectBatch(spans []*CoreSpan) error {
+	<-c.release
+	return c.stubBatchCollector.CollectBatch(spans)
+}
+
+func TestTraceBatchingCollectorEvictionDoesNotBlock(t *testing.T) {
+	stub := &blockingBatchCollector{release: make(chan struct{})}
+	c := NewTraceBatchingCollector(stub, time.Hour, TraceBatchingMaxTraces(2))
+
+	collected := make(chan struct{})
+	go func() {
+		for _, traceID := range []uint64{1, 2, 3} {
+			c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", traceID, traceID, 0, nil, false))
+		}
+		close(collected)
+	}()
+	select {
+	case <-collected:
+	case <-time.After(time.Second):
+		t.Fatal("Collect blocked on the wrapped collector")
+	}
+	close(stub.release)
+	c.Close()
+
+	want := [][]string{{"00000001"}, {"00000002"}, {"00000003"}}
+	if have := stub.spanIDs(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestTraceBatchingCollectorBacklog(t *testing.T) {
+	stub := &blockingBatchCollector{release: make(chan struct{})}
+	c := NewTraceBatchingCollector(stub, time.Hour, TraceBatchingMaxTraces(1), TraceBatchingMaxSpans(2))
+
+	// trace 1 blocks the wrapped collector, trace 2 reaches the maximum number
+	// of spans and traces 3 and 4 are evicted, so only one trace waiting to be
+	// passed on fits
+	c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 1, 0, nil, false))
+	c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 2, 2, 0, nil, false))
+	if err := eventually(func() bool {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return len(c.evicted) == 0
+	}, time.Second); err != nil {
+		t.Fatal("trace 1 not taken by the loop")
+	}
+	c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 2, 3, 0, nil, false))
+	for _, traceID := range []uint64{3, 4, 5} {
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", traceID, traceID+1, 0, nil, false))
+	}
+	if want, have := uint64(3), c.DroppedSpans(); want != have {
+		t.Errorf("dropped spans: want %d, have %d", want, have)
+	}
+	close(stub.release)
+	c.Close()
+
+	want := [][]string{{"00000001"}, {"00000005"}, {"00000006"}}
+	if have := stub.spanIDs(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestTraceBatchingCollectorInvalidLimits(t *testing.T) {
+	stub := &stubBatchCollector{}
+	c := NewTraceBatchingCollector(stub, time.Hour, TraceBatchingMaxTraces(0), TraceBatchingMaxSpans(-1))
+	for _, traceID := range []uint64{1, 2} {
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", traceID, traceID, 0, nil, false))
+	}
+	c.Close()
+	if want, have := [][]string{{"00000001"}, {"00000002"}}, stub.spanIDs(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestTraceBatchingCollectorClose(t *testing.T) {
+	// collectors without batch support receive the spans of a trace in order
+	stub := &stubAgnosticCollector{}
+	c := NewTraceBatchingCollector(stub, time.Hour)
+	for _, ids := range [][2]uint64{{1, 1}, {2, 2}, {1, 3}} {
+		c.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", ids[0], ids[1], 0, nil, false))
+	}
+	if want, have := 0, len(stub.spans); want != have {
+		t.Fatalf("before close: want %d spans, have %d", want, have)
+	}
+	c.Close()
+
+	var have []string
+	for _, span := range stub.spans {
+		have = append(have, span.ID)
+	}
+	if want := []string{"00000001", "00000003", "00000002"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,102 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+// defaultUDPMaxDatagramSize is the maximum UDP payload size over IPv4.
+const defaultUDPMaxDatagramSize = 65507
+
+// ErrDatagramTooLarge is returned by the UDPCollector if a span encodes into a
+// payload exceeding the maximum datagram size.
+var ErrDatagramTooLarge = errors.New("span exceeds maximum datagram size")
+
+// UDPCollector implements AgnosticCollector by sending every span as a single
+// UDP datagram. Delivery is best effort: spans are fire-and-forget and no
+// backpressure is applied to the application.
+type UDPCollector struct {
+	logger          Logger
+	conn            net.Conn
+	v2              bool
+	maxDatagramSize int
+	errCallback     func(*CoreSpan, error)
+}
+
+// UDPOption sets a parameter for the UDPCollector
+type UDPOption func(c *UDPCollector)
+
+// UDPLogger sets the logger used to report errors in the collection
+// process. By default, a no-op logger is used, i.e. no errors are logged
+// anywhere. It's important to set this option in a production service.
+func UDPLogger(logger Logger) UDPOption {
+	return func(c *UDPCollector) { c.logger = logger }
+}
+
+// UDPJSONV2 makes the collector encode spans using the Zipkin v2 JSON model.
+// By default the v1 JSON model is used.
+func UDPJSONV2() UDPOption {
+	return func(c *UDPCollector) { c.v2 = true }
+}
+
+// UDPMaxDatagramSize sets the maximum size of a datagram. Spans encoding into
+// a larger payload are dropped. The default is 65507 bytes.
+func UDPMaxDatagramSize(n int) UDPOption {
+	return func(c *UDPCollector) { c.maxDatagramSize = n }
+}
+
+// UDPErrorCallback registers a callback function receiving spans which could
+// not be sent, together with the reason.
+func UDPErrorCallback(cb func(*CoreSpan, error)) UDPOption {
+	return func(c *UDPCollector) { c.errCallback = cb }
+}
+
+// NewUDPCollector returns a new UDP-backend Collector. addr should be a UDP
+// endpoint of the form "host:port".
+func NewUDPCollector(addr string, options ...UDPOption) (AgnosticCollector, error) {
+	c := &UDPCollector{
+		logger:          NewNopLogger(),
+		maxDatagramSize: defaultUDPMaxDatagramSize,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return c, nil
+}
+
+// Collect implements AgnosticCollector.
+func (c *UDPCollector) Collect(s *CoreSpan) error {
+	var (
+		payload []byte
+		err     error
+	)
+	if c.v2 {
+		payload, err = json.Marshal([]*CoreSpanV2{s.ToV2()})
+	} else {
+		payload, err = json.Marshal([]*CoreSpan{s})
+	}
+	if err == nil && len(payload) > c.maxDatagramSize {
+		err = ErrDatagramTooLarge
+	}
+	if err == nil {
+		_, err = c.conn.Write(payload)
+	}
+	if err != nil {
+		c.logger.Log("msg", "unable to send span", "err", err.Error())
+		if c.errCallback != nil {
+			c.errCallback(s, err)
+		}
+	}
+	return err
+}
+
+// Close implements AgnosticCollector.
+func (c *UDPCollector) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,129 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func listenUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) []byte {
+	buf := make([]byte, defaultUDPMaxDatagramSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("never received a datagram: %+v", err)
+	}
+	return buf[:n]
+}
+
+func recordClientSpan(t *testing.T, c AgnosticCollector) {
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "10.1.2.3:8080", "udp-service"),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	span := tracer.StartSpan("get", ext.SpanKindRPCClient)
+	span.SetTag("http.method", "GET")
+	span.Finish()
+}
+
+func TestUDPCollector(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewUDPCollector(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	recordClientSpan(t, c)
+
+	var spans []*CoreSpan
+	if err := json.Unmarshal(readDatagram(t, conn), &spans); err != nil {
+		t.Fatalf("unable to decode datagram: %+v", err)
+	}
+	if want, have := 1, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	if want, have := "get", spans[0].Name; want != have {
+		t.Errorf("name: want %q, have %q", want, have)
+	}
+	if want, have := []string{"cs", "cr"}, annotationValues(spans[0]); len(have) != 2 || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("annotations: want %v, have %v", want, have)
+	}
+}
+
+func TestUDPCollectorV2(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewUDPCollector(conn.LocalAddr().String(), UDPJSONV2())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	recordClientSpan(t, c)
+
+	var spans []*CoreSpanV2
+	if err := json.Unmarshal(readDatagram(t, conn), &spans); err != nil {
+		t.Fatalf("unable to decode datagram: %+v", err)
+	}
+	if want, have := 1, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	span := spans[0]
+	if want, have := "CLIENT", span.Kind; want != have {
+		t.Errorf("kind: want %q, have %q", want, have)
+	}
+	if want, have := 0, len(span.Annotations); want != have {
+		t.Errorf("annotations: want %d, have %d", want, have)
+	}
+	if want, have := "GET", span.Tags["http.method"]; want != have {
+		t.Errorf("tag: want %q, have %q", want, have)
+	}
+	if span.LocalEndpoint == nil {
+		t.Fatal("expected local endpoint")
+	}
+	if want, have := (CoreEndpointV2{ServiceName: "udp-service", IPv4: "10.1.2.3", Port: 8080}), *span.LocalEndpoint; want != have {
+		t.Errorf("local endpoint: want %+v, have %+v", want, have)
+	}
+	if span.Timestamp == 0 || span.Duration == 0 {
+		t.Errorf("expected timestamp and duration, have %d and %d", span.Timestamp, span.Duration)
+	}
+}
+
+func TestUDPCollectorDatagramTooLarge(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	var dropped []error
+	c, err := NewUDPCollector(conn.LocalAddr().String(),
+		UDPMaxDatagramSize(64),
+		UDPErrorCallback(func(_ *CoreSpan, err error) { dropped = append(dropped, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	span := makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 2, 0, nil, false)
+	if want, have := ErrDatagramTooLarge, c.Collect(span); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 1, len(dropped); want != have || dropped[0] != ErrDatagramTooLarge {
+		t.Errorf("error callback: want %d call, have %v", want, dropped)
+	}
+}
@@ -0,0 +1,237 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	otext "github.com/opentracing/opentracing-go/ext"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+// xrayHeader precedes every segment sent to the X-Ray daemon.
+const xrayHeader = `{"format":"json","version":1}` + "\n"
+
+// XRayCollector implements AgnosticCollector by converting spans into AWS
+// X-Ray segment documents and sending them to the X-Ray daemon over UDP.
+// Root spans are sent as segments, child spans as independent subsegments.
+type XRayCollector struct {
+	logger Logger
+	conn   net.Conn
+}
+
+// XRayOption sets a parameter for the XRayCollector
+type XRayOption func(c *XRayCollector)
+
+// XRayLogger sets the logger used to report errors in the collection
+// process. By default, a no-op logger is used, i.e. no errors are logged
+// anywhere. It's important to set this option in a production service.
+func XRayLogger(logger Logger) XRayOption {
+	return func(c *XRayCollector) { c.logger = logger }
+}
+
+// NewXRayCollector returns a new X-Ray daemon backed Collector. daemonAddr
+// should be the UDP endpoint of the daemon of the form "host:port", usually
+// "127.0.0.1:2000".
+func NewXRayCollector(daemonAddr string, options ...XRayOption) (AgnosticCollector, error) {
+	c := &XRayCollector{
+		logger: NewNopLogger(),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	conn, err := net.Dial("udp", daemonAddr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return c, nil
+}
+
+// Collect implements AgnosticCollector.
+func (c *XRayCollector) Collect(s *CoreSpan) error {
+	segment, err := json.Marshal(toXRaySegment(s))
+	if err == nil {
+		payload := make([]byte, 0, len(xrayHeader)+len(segment))
+		payload = append(payload, xrayHeader...)
+		payload = append(payload, segment...)
+		_, err = c.conn.Write(payload)
+	}
+	if err != nil {
+		c.logger.Log("msg", "unable to send segment", "err", err.Error())
+	}
+	return err
+}
+
+// Close implements AgnosticCollector.
+func (c *XRayCollector) Close() error {
+	return c.conn.Close()
+}
+
+// xraySegment is the subset of the X-Ray segment document filled from spans.
+type xraySegment struct {
+	Name        string            `json:"name"`
+	ID          string            `json:"id"`
+	TraceID     string            `json:"trace_id"`
+	ParentID    string            `json:"parent_id,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	StartTime   float64           `json:"start_time"`
+	EndTime     float64           `json:"end_time"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Error       bool              `json:"error,omitempty"`
+	Fault       bool              `json:"fault,omitempty"`
+	HTTP        *xrayHTTP         `json:"http,omitempty"`
+	SQL         *xraySQL          `json:"sql,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type xrayHTTP struct {
+	Request  *xrayHTTPRequest  `json:"request,omitempty"`
+	Response *xrayHTTPResponse `json:"response,omitempty"`
+}
+
+type xrayHTTPRequest struct {
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+type xrayHTTPResponse struct {
+	Status int `json:"status,omitempty"`
+}
+
+type xraySQL struct {
+	URL            string `json:"url,omitempty"`
+	User           string `json:"user,omitempty"`
+	DatabaseType   string `json:"database_type,omitempty"`
+	SanitizedQuery string `json:"sanitized_query,omitempty"`
+}
+
+// toXRaySegment maps a span onto an X-Ray segment. The OpenTracing http and
+// db tags are mapped onto the http and sql fields of the segment, the
+// remaining tags become annotations.
+func toXRaySegment(s *CoreSpan) *xraySegment {
+	start := coreSpanStart(s)
+
+	seg := &xraySegment{
+		Name:      s.Name,
+		ID:        s.ID,
+		TraceID:   xrayTraceID(s),
+		StartTime: float64(start) / 1e6,
+		EndTime:   float64(start+s.Duration) / 1e6,
+	}
+	if s.ParentID != "" {
+		seg.ParentID = s.ParentID
+		seg.Type = "subsegment"
+	} else if name := coreSpanServiceName(s); name != "" {
+		// segments are named after the service they represent
+		seg.Name = name
+	}
+	for _, a := range s.Annotations {
+		if a.Value == zipkincore.CLIENT_SEND {
+			seg.Namespace = "remote"
+		}
+	}
+
+	for _, ba := range s.BinaryAnnotations {
+		switch ba.Key {
+		case string(otext.HTTPMethod):
+			seg.httpRequest().Method = ba.Value
+		case string(otext.HTTPUrl):
+			seg.httpRequest().URL = ba.Value
+		case string(otext.HTTPStatusCode):
+			status, err := strconv.Atoi(ba.Value)
+			if err != nil {
+				seg.addAnnotation(ba.Key, ba.Value)
+				continue
+			}
+			if seg.HTTP == nil {
+				seg.HTTP = &xrayHTTP{}
+			}
+			seg.HTTP.Response = &xrayHTTPResponse{Status: status}
+			seg.Error = status >= 400 && status < 500
+			seg.Fault = status >= 500
+		case string(otext.DBInstance):
+			seg.sql().URL = ba.Value
+		case string(otext.DBUser):
+			seg.sql().User = ba.Value
+		case string(otext.DBType):
+			seg.sql().DatabaseType = ba.Value
+		case string(otext.DBStatement):
+			seg.sql().SanitizedQuery = ba.Value
+		case zipkincore.LOCAL_COMPONENT, zipkincore.SERVER_ADDR, zipkincore.CLIENT_ADDR:
+			// endpoint information is already reflected in the segment
+		default:
+			seg.addAnnotation(ba.Key, ba.Value)
+		}
+	}
+	return seg
+}
+
+func (seg *xraySegment) httpRequest() *xrayHTTPRequest {
+	if seg.HTTP == nil {
+		seg.HTTP = &xrayHTTP{}
+	}
+	if seg.HTTP.Request == nil {
+		seg.HTTP.Request = &xrayHTTPRequest{}
+	}
+	return seg.HTTP.Request
+}
+
+func (seg *xraySegment) sql() *xraySQL {
+	if seg.SQL == nil {
+		seg.SQL = &xraySQL{}
+	}
+	return seg.SQL
+}
+
+// addAnnotation adds a tag as annotation. X-Ray only allows alphanumeric
+// characters and underscores in annotation keys, others are replaced by an
+// underscore.
+func (seg *xraySegment) addAnnotation(key, value string) {
+	if seg.Annotations == nil {
+		seg.Annotations = make(map[string]string)
+	}
+	key = strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+	seg.Annotations[key] = value
+}
+
+// xrayTraceID converts the trace ID of the span into the X-Ray form of
+// "1-<8 hex digits>-<24 hex digits>". 128-bit trace IDs, either held in full
+// by TraceID as recorded by the JSONRecorder or split over TraceIDHigh and
+// TraceID, are split over both parts. 64-bit trace IDs are zero padded, so
+// all spans of a trace share the X-Ray trace ID regardless of their start
+// time.
+func xrayTraceID(s *CoreSpan) string {
+	id := s.TraceID
+	if len(id) < 32 && s.TraceIDHigh != "" {
+		id = s.TraceIDHigh + id
+	}
+	if len(id) < 32 {
+		id = strings.Repeat("0", 32-len(id)) + id
+	}
+	return "1-" + id[:8] + "-" + id[8:]
+}
+
+// coreSpanServiceName returns the service name of the local endpoint of the
+// span.
+func coreSpanServiceName(s *CoreSpan) string {
+	for _, a := range s.Annotations {
+		if a.Host != nil && a.Host.ServiceName != "" {
+			return a.Host.ServiceName
+		}
+	}
+	for _, ba := range s.BinaryAnnotations {
+		// the server address annotation holds the remote endpoint
+		if ba.Key != zipkincore.SERVER_ADDR && ba.Endpoint.ServiceName != "" {
+			return ba.Endpoint.ServiceName
+		}
+	}
+	return ""
+}
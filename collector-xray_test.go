@@ -0,0 +1,184 @@
+package zipkintracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
+)
+
+func TestXRayCollector(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewXRayCollector(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	host := &CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "xray-service"}
+	err = c.Collect(&CoreSpan{
+		TraceID:     "0123456789abcdef",
+		TraceIDHigh: "5759e988bd862e3f",
+		Name:        "get",
+		ID:          "00000000000000aa",
+		Timestamp:   1500000000000000,
+		Duration:    250000,
+		Annotations: []*CoreAnnotation{
+			{Timestamp: 1500000000000000, Value: zipkincore.SERVER_RECV, Host: host},
+			{Timestamp: 1500000000250000, Value: zipkincore.SERVER_SEND, Host: host},
+		},
+		BinaryAnnotations: []*CoreBinaryAnnotation{
+			{Key: "http.method", Value: "GET", Endpoint: *host},
+			{Key: "http.url", Value: "http://example.com/", Endpoint: *host},
+			{Key: "http.status_code", Value: "503", Endpoint: *host},
+			{Key: "user.id", Value: "42", Endpoint: *host},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := readDatagram(t, conn)
+	if !bytes.HasPrefix(payload, []byte(xrayHeader)) {
+		t.Fatalf("want header %q, have %q", xrayHeader, payload)
+	}
+	var segment struct {
+		Name      string  `json:"name"`
+		ID        string  `json:"id"`
+		TraceID   string  `json:"trace_id"`
+		Type      string  `json:"type"`
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+		Fault     bool    `json:"fault"`
+		HTTP      struct {
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status int `json:"status"`
+			} `json:"response"`
+		} `json:"http"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(payload[len(xrayHeader):], &segment); err != nil {
+		t.Fatalf("unable to decode segment: %+v", err)
+	}
+
+	if want, have := "1-5759e988-bd862e3f0123456789abcdef", segment.TraceID; want != have {
+		t.Errorf("trace_id: want %q, have %q", want, have)
+	}
+	if want, have := "xray-service", segment.Name; want != have {
+		t.Errorf("name: want %q, have %q", want, have)
+	}
+	if want, have := "00000000000000aa", segment.ID; want != have {
+		t.Errorf("id: want %q, have %q", want, have)
+	}
+	if want, have := "", segment.Type; want != have {
+		t.Errorf("type: want %q, have %q", want, have)
+	}
+	if want, have := 1500000000.0, segment.StartTime; want != have {
+		t.Errorf("start_time: want %f, have %f", want, have)
+	}
+	if want, have := 1500000000.25, segment.EndTime; want != have {
+		t.Errorf("end_time: want %f, have %f", want, have)
+	}
+	if want, have := "GET", segment.HTTP.Request.Method; want != have {
+		t.Errorf("http method: want %q, have %q", want, have)
+	}
+	if want, have := "http://example.com/", segment.HTTP.Request.URL; want != have {
+		t.Errorf("http url: want %q, have %q", want, have)
+	}
+	if want, have := 503, segment.HTTP.Response.Status; want != have {
+		t.Errorf("http status: want %d, have %d", want, have)
+	}
+	if !segment.Fault {
+		t.Error("fault: want true, have false")
+	}
+	if want, have := "42", segment.Annotations["user_id"]; want != have {
+		t.Errorf("annotation: want %q, have %q", want, have)
+	}
+}
+
+func TestXRaySubsegment(t *testing.T) {
+	seg := toXRaySegment(&CoreSpan{
+		TraceID:   "0123456789abcdef",
+		Name:      "query",
+		ID:        "00000000000000bb",
+		ParentID:  "00000000000000aa",
+		Timestamp: 1500000000000000,
+		Duration:  1000,
+		Annotations: []*CoreAnnotation{
+			{Timestamp: 1500000000000000, Value: zipkincore.CLIENT_SEND},
+		},
+		BinaryAnnotations: []*CoreBinaryAnnotation{
+			{Key: "db.type", Value: "sql"},
+			{Key: "db.statement", Value: "SELECT 1"},
+		},
+	})
+
+	// 64-bit trace IDs are zero padded
+	if want, have := "1-00000000-000000000123456789abcdef", seg.TraceID; want != have {
+		t.Errorf("trace_id: want %q, have %q", want, have)
+	}
+	if want, have := "subsegment", seg.Type; want != have {
+		t.Errorf("type: want %q, have %q", want, have)
+	}
+	if want, have := "00000000000000aa", seg.ParentID; want != have {
+		t.Errorf("parent_id: want %q, have %q", want, have)
+	}
+	if want, have := "remote", seg.Namespace; want != have {
+		t.Errorf("namespace: want %q, have %q", want, have)
+	}
+	if seg.SQL == nil {
+		t.Fatal("sql: want sql, have nil")
+	}
+	if want, have := (xraySQL{DatabaseType: "sql", SanitizedQuery: "SELECT 1"}), *seg.SQL; want != have {
+		t.Errorf("sql: want %+v, have %+v", want, have)
+	}
+}
+
+func TestXRayTraceID128Bit(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc").RecordSpan(RawSpan{
+		Context: SpanContext{
+			TraceID: types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a},
+			SpanID:  1,
+			Sampled: true,
+		},
+		Operation: "get",
+		Start:     time.Unix(1500000000, 0),
+	})
+	seg := toXRaySegment(c.spans[0])
+	if want, have := "1-5759e988-bd862e3fe1be023e8ff6d22a", seg.TraceID; want != have {
+		t.Errorf("trace_id: want %q, have %q", want, have)
+	}
+}
+
+func TestXRayTraceIDStable(t *testing.T) {
+	// spans of a 64-bit trace starting in different seconds share the trace ID
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc")
+	for i, start := range []time.Time{time.Unix(1, 0), time.Unix(2, 0)} {
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{
+				TraceID: types.TraceID{Low: 0x0123456789abcdef},
+				SpanID:  uint64(i + 1),
+				Sampled: true,
+				Owner:   true,
+			},
+			Operation: "get",
+			Start:     start,
+		})
+	}
+	for _, span := range c.spans {
+		if want, have := "1-00000000-000000000123456789abcdef", toXRaySegment(span).TraceID; want != have {
+			t.Errorf("span %s: trace_id: want %q, have %q", span.ID, want, have)
+		}
+	}
+}
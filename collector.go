@@ -1,6 +1,7 @@
 package zipkintracer
 
 import (
+	"context"
 	"strings"
 
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
@@ -13,6 +14,30 @@ type Collector interface {
 	Close() error
 }
 
+// Pinger is implemented by the HTTP collectors to check whether Zipkin is
+// reachable, e.g. from readiness probes:
+//  if p, ok := collector.(Pinger); ok {
+//  	err = p.Ping(ctx)
+//  }
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Saturater is implemented by the collectors buffering spans in a backlog to
+// report its fill level between 0 and 1, see AdaptiveSamplerBackpressure.
+type Saturater interface {
+	Saturation() float64
+}
+
+// saturation returns the fill level of a backlog holding length of capacity
+// spans.
+func saturation(length, capacity int) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(length) / float64(capacity)
+}
+
 // NopCollector implements Collector but performs no work.
 type NopCollector struct{}
 
@@ -24,10 +24,12 @@ type stubCollector struct {
 	errid     int
 	collected bool
 	closed    bool
+	spans     []*zipkincore.Span
 }
 
-func (c *stubCollector) Collect(*zipkincore.Span) error {
+func (c *stubCollector) Collect(s *zipkincore.Span) error {
 	c.collected = true
+	c.spans = append(c.spans, s)
 	if c.errid != 0 {
 		return fmt.Errorf("error %d", c.errid)
 	}
@@ -1,6 +1,7 @@
 package zipkintracer
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 	"testing"
@@ -115,6 +116,57 @@ func TestConcurrentUsage(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSpanPoolConcurrentReuse(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		EnableSpanPool(true),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	var wg sync.WaitGroup
+	const num = 50
+	wg.Add(num)
+	for i := 0; i < num; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < num; j++ {
+				id := fmt.Sprintf("%d-%d", i, j)
+				sp := tracer.StartSpan(id)
+				sp.SetTag("id", id)
+				sp.LogEvent(id)
+				sp.SetBaggageItem("id", id)
+				sp.Finish()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// recorded spans must not have been touched by the reuse of their span
+	spans := recorder.GetSpans()
+	if want, have := num*num, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	seen := make(map[string]bool, len(spans))
+	for _, span := range spans {
+		id := span.Operation
+		if seen[id] {
+			t.Fatalf("span %s recorded twice", id)
+		}
+		seen[id] = true
+		if want, have := 1, len(span.Tags); want != have || span.Tags["id"] != id {
+			t.Errorf("span %s: unexpected tags %v", id, span.Tags)
+		}
+		if want, have := 1, len(span.Logs); want != have || span.Logs[0].Fields[0].Value() != id {
+			t.Errorf("span %s: unexpected logs %v", id, span.Logs)
+		}
+		if want, have := id, span.Context.Baggage["id"]; want != have || len(span.Context.Baggage) != 1 {
+			t.Errorf("span %s: unexpected baggage %v", id, span.Context.Baggage)
+		}
+	}
+}
+
 func TestDisableSpanPool(t *testing.T) {
 	var cr CountingRecorder
 	tracer, err := NewTracer(
@@ -1,6 +1,13 @@
 package zipkintracer
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/flag"
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
 )
@@ -38,6 +45,77 @@ func (c SpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
 	}
 }
 
+// TraceIDString returns the trace ID in its Zipkin hex representation, 32
+// characters for 128-bit trace IDs and 16 characters otherwise.
+func (c SpanContext) TraceIDString() string {
+	return c.TraceID.ToHex()
+}
+
+// SpanIDString returns the span ID in its 16 character Zipkin hex
+// representation.
+func (c SpanContext) SpanIDString() string {
+	return fmt.Sprintf("%016x", c.SpanID)
+}
+
+// IsValid returns whether the SpanContext holds both a trace and a span ID.
+func (c SpanContext) IsValid() bool {
+	return !c.TraceID.Empty() && c.SpanID != 0
+}
+
+// IsZero returns whether the SpanContext is the zero value.
+func (c SpanContext) IsZero() bool {
+	return c.TraceID.Empty() && c.SpanID == 0 && c.ParentSpanID == nil &&
+		!c.Sampled && c.Flags == 0 && !c.Owner && len(c.Baggage) == 0
+}
+
+// String returns the compact "<trace id>/<span id>/<sampled>" representation
+// of the SpanContext for log correlation, e.g.
+// "5759e988bd862e3fe1be023e8ff6d22a/0123456789abcdef/1". Baggage, parent and
+// flags are omitted. See ParseSpanContext for the reverse.
+func (c SpanContext) String() string {
+	sampled := "0"
+	if c.Sampled {
+		sampled = "1"
+	}
+	return c.TraceIDString() + "/" + c.SpanIDString() + "/" + sampled
+}
+
+// ParseSpanContext parses the representation returned by SpanContext.String.
+func ParseSpanContext(s string) (SpanContext, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return SpanContext{}, fmt.Errorf("invalid span context %q. Should be of the form <trace id>/<span id>/<sampled>", s)
+	}
+	traceID, err := types.TraceIDFromHex(parts[0])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid span context %q: %v", s, err)
+	}
+	if len(parts[1]) != 16 {
+		return SpanContext{}, fmt.Errorf("invalid span context %q: span id should be 16 hex characters", s)
+	}
+	spanID, err := strconv.ParseUint(parts[1], 16, 64)
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid span context %q: %v", s, err)
+	}
+	var sampled bool
+	switch parts[2] {
+	case "1":
+		sampled = true
+	case "0":
+	default:
+		return SpanContext{}, fmt.Errorf("invalid span context %q: sampled should be 0 or 1", s)
+	}
+	if traceID.Empty() || spanID == 0 {
+		return SpanContext{}, fmt.Errorf("invalid span context %q: ids should not be zero", s)
+	}
+	return SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: sampled,
+		Flags:   flag.SamplingSet,
+	}, nil
+}
+
 // WithBaggageItem returns an entirely new basictracer SpanContext with the
 // given key:value baggage pair set.
 func (c SpanContext) WithBaggageItem(key, val string) SpanContext {
@@ -59,3 +137,19 @@ func (c SpanContext) WithBaggageItem(key, val string) SpanContext {
 	// Use positional parameters so the compiler will help catch new fields.
 	return SpanContext{c.TraceID, c.SpanID, c.Sampled, newBaggage, parentSpanID, c.Flags, c.Owner}
 }
+
+// TraceInfoFromContext returns the Zipkin trace and span ID, formatted as
+// emitted by the recorders, and the sampling decision of the span carried by
+// ctx. ok is false if ctx carries no span or the span was not created by this
+// tracer.
+func TraceInfoFromContext(ctx context.Context) (traceID, spanID string, sampled bool, ok bool) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", "", false, false
+	}
+	sc, ok := span.Context().(SpanContext)
+	if !ok {
+		return "", "", false, false
+	}
+	return sc.TraceIDString(), sc.SpanIDString(), sc.Sampled, true
+}
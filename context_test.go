@@ -0,0 +1,143 @@
+package zipkintracer
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/flag"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
+)
+
+func TestSpanContextIDStrings(t *testing.T) {
+	for _, traceID128Bit := range []bool{false, true} {
+		c := &stubAgnosticCollector{}
+		tracer, err := NewTracer(
+			NewJSONRecorder(c, false, "0.0.0.0:0", "svc"),
+			TraceID128Bit(traceID128Bit),
+			WithLogger(&nopLogger{}),
+		)
+		if err != nil {
+			t.Fatalf("Unable to create Tracer: %+v", err)
+		}
+		span := tracer.StartSpan("span")
+		ctx := span.Context().(SpanContext)
+		span.Finish()
+
+		if want, have := c.spans[0].TraceID, ctx.TraceIDString(); want != have {
+			t.Errorf("128 bit %t: trace id: want %s, have %s", traceID128Bit, want, have)
+		}
+		if want, have := c.spans[0].ID, ctx.SpanIDString(); want != have {
+			t.Errorf("128 bit %t: span id: want %s, have %s", traceID128Bit, want, have)
+		}
+		if !ctx.IsValid() {
+			t.Errorf("128 bit %t: want valid span context", traceID128Bit)
+		}
+		if ctx.IsZero() {
+			t.Errorf("128 bit %t: want non zero span context", traceID128Bit)
+		}
+	}
+
+	ctx := SpanContext{TraceID: types.TraceID{High: 1, Low: 2}, SpanID: 3}
+	if want, have := "00000000000000010000000000000002", ctx.TraceIDString(); want != have {
+		t.Errorf("trace id: want %s, have %s", want, have)
+	}
+	if want, have := "0000000000000003", ctx.SpanIDString(); want != have {
+		t.Errorf("span id: want %s, have %s", want, have)
+	}
+
+	if (SpanContext{TraceID: types.TraceID{Low: 1}}).IsValid() {
+		t.Error("want span context without span id to be invalid")
+	}
+	if (SpanContext{SpanID: 1}).IsValid() {
+		t.Error("want span context without trace id to be invalid")
+	}
+	if !(SpanContext{}).IsZero() {
+		t.Error("want zero value span context to be zero")
+	}
+	if (SpanContext{Baggage: map[string]string{"k": "v"}}).IsZero() {
+		t.Error("want span context with baggage to be non zero")
+	}
+}
+
+func TestTraceInfoFromContext(t *testing.T) {
+	tracer, err := NewTracer(NewInMemoryRecorder(), WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		context SpanContext
+		traceID string
+	}{
+		{"64 bit", SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true}, "0000000000000001"},
+		{"128 bit", SpanContext{TraceID: types.TraceID{High: 3, Low: 1}, SpanID: 2, Flags: flag.SamplingSet}, "00000000000000030000000000000001"},
+	} {
+		span := tracer.StartSpan("span", opentracing.ChildOf(test.context))
+		ctx := opentracing.ContextWithSpan(context.Background(), span)
+		traceID, spanID, sampled, ok := TraceInfoFromContext(ctx)
+		if !ok {
+			t.Fatalf("%s: want ok, have not ok", test.name)
+		}
+		if want, have := test.traceID, traceID; want != have {
+			t.Errorf("%s: trace id: want %s, have %s", test.name, want, have)
+		}
+		if want, have := span.Context().(SpanContext).SpanIDString(), spanID; want != have {
+			t.Errorf("%s: span id: want %s, have %s", test.name, want, have)
+		}
+		if want, have := test.context.Sampled, sampled; want != have {
+			t.Errorf("%s: sampled: want %t, have %t", test.name, want, have)
+		}
+		span.Finish()
+	}
+
+	if _, _, _, ok := TraceInfoFromContext(context.Background()); ok {
+		t.Error("context without span: want not ok, have ok")
+	}
+}
+
+func TestSpanContextString(t *testing.T) {
+	for _, sc := range []SpanContext{
+		{TraceID: types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a}, SpanID: 0x0123456789abcdef, Sampled: true},
+		{TraceID: types.TraceID{Low: 1}, SpanID: 2},
+	} {
+		s := sc.String()
+		parsed, err := ParseSpanContext(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if want, have := sc.TraceID, parsed.TraceID; want != have {
+			t.Errorf("%s: trace id: want %+v, have %+v", s, want, have)
+		}
+		if want, have := sc.SpanID, parsed.SpanID; want != have {
+			t.Errorf("%s: span id: want %d, have %d", s, want, have)
+		}
+		if want, have := sc.Sampled, parsed.Sampled; want != have {
+			t.Errorf("%s: sampled: want %t, have %t", s, want, have)
+		}
+	}
+
+	sc := SpanContext{TraceID: types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a}, SpanID: 0x0123456789abcdef, Sampled: true}
+	if want, have := "5759e988bd862e3fe1be023e8ff6d22a/0123456789abcdef/1", sc.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	for _, s := range []string{
+		"",
+		"0000000000000001/0000000000000002",
+		"0000000000000001/0000000000000002/1/extra",
+		"00000000000000011/0000000000000002/1",
+		"000000000000000g/0000000000000002/1",
+		"0000000000000001/2/1",
+		"0000000000000001/000000000000000x/1",
+		"0000000000000001/0000000000000002/true",
+		"0000000000000000/0000000000000002/1",
+		"0000000000000001/0000000000000000/1",
+	} {
+		if sc, err := ParseSpanContext(s); err == nil {
+			t.Errorf("%q: want error, have %s", s, sc)
+		}
+	}
+}
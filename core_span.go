@@ -1,6 +1,10 @@
 package zipkintracer
 
-// CoreSpan represents the span to be sent to the zipkin server
+import "encoding/json"
+
+// CoreSpan represents the span to be sent to the zipkin server. Empty fields
+// are left out of the JSON encoding, e.g. the timestamp and duration of spans
+// not owned by the current process.
 type CoreSpan struct {
 	TraceID           string                  `json:"traceId"`
 	Name              string                  `json:"name"`
@@ -10,8 +14,40 @@ type CoreSpan struct {
 	Timestamp         int64                   `json:"timestamp,omitempty"`
 	Duration          int64                   `json:"duration,omitempty"`
 	TraceIDHigh       string                  `json:"traceIdHigh,omitempty"`
-	Annotations       []*CoreAnnotation       `json:"annotations"`
-	BinaryAnnotations []*CoreBinaryAnnotation `json:"binaryAnnotations"`
+	Annotations       []*CoreAnnotation       `json:"annotations,omitempty"`
+	BinaryAnnotations []*CoreBinaryAnnotation `json:"binaryAnnotations,omitempty"`
+
+	// partial marks in-progress reports of spans, see Flusher.
+	partial bool
+	// stringTimestamps encodes timestamps and durations as JSON strings, see
+	// JSONWithStringTimestamps.
+	stringTimestamps bool
+}
+
+// coreSpanJSON is the default JSON encoding of CoreSpan.
+type coreSpanJSON CoreSpan
+
+// MarshalJSON implements json.Marshaler.
+func (s *CoreSpan) MarshalJSON() ([]byte, error) {
+	if !s.stringTimestamps {
+		return json.Marshal((*coreSpanJSON)(s))
+	}
+	annotations := make([]coreAnnotationStringJSON, len(s.Annotations))
+	for i, a := range s.Annotations {
+		annotations[i] = coreAnnotationStringJSON{CoreAnnotation: a, Timestamp: a.Timestamp}
+	}
+	return json.Marshal(struct {
+		*coreSpanJSON
+		Timestamp   int64                      `json:"timestamp,string,omitempty"`
+		Duration    int64                      `json:"duration,string,omitempty"`
+		Annotations []coreAnnotationStringJSON `json:"annotations,omitempty"`
+	}{(*coreSpanJSON)(s), s.Timestamp, s.Duration, annotations})
+}
+
+// coreAnnotationStringJSON encodes the timestamp of an annotation as string.
+type coreAnnotationStringJSON struct {
+	*CoreAnnotation
+	Timestamp int64 `json:"timestamp,string"`
 }
 
 // CoreBinaryAnnotation represents the tags added in the span
@@ -35,3 +71,32 @@ type CoreEndpoint struct {
 	ServiceName string `json:"serviceName"`
 	Ipv6        string `json:"ipv6,omitempty"`
 }
+
+// coreSpanStart returns the start time of the span in epoch microseconds. Spans
+// without timestamp, e.g. not owned by the recording process, start with their
+// earliest annotation.
+func coreSpanStart(s *CoreSpan) int64 {
+	start := s.Timestamp
+	if start == 0 {
+		for _, a := range s.Annotations {
+			if start == 0 || a.Timestamp < start {
+				start = a.Timestamp
+			}
+		}
+	}
+	return start
+}
+
+// coreSpanTraceID128 returns the trace ID of the span as 32 hex characters,
+// padding 64-bit trace IDs. The JSONRecorder sets TraceID to all 32 characters
+// of 128-bit trace IDs, hand built spans may split them over TraceIDHigh and
+// TraceID.
+func coreSpanTraceID128(s *CoreSpan) string {
+	switch {
+	case len(s.TraceID) == 32:
+		return s.TraceID
+	case s.TraceIDHigh != "":
+		return s.TraceIDHigh + s.TraceID
+	}
+	return "0000000000000000" + s.TraceID
+}
@@ -0,0 +1,126 @@
+package zipkintracer
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+// CoreSpanV2 represents a span in the Zipkin v2 JSON model.
+type CoreSpanV2 struct {
+	TraceID        string             `json:"traceId"`
+	ParentID       string             `json:"parentId,omitempty"`
+	ID             string             `json:"id"`
+	Kind           string             `json:"kind,omitempty"`
+	Name           string             `json:"name,omitempty"`
+	Timestamp      int64              `json:"timestamp,omitempty"`
+	Duration       int64              `json:"duration,omitempty"`
+	Debug          bool               `json:"debug,omitempty"`
+	Shared         bool               `json:"shared,omitempty"`
+	LocalEndpoint  *CoreEndpointV2    `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *CoreEndpointV2    `json:"remoteEndpoint,omitempty"`
+	Annotations    []CoreAnnotationV2 `json:"annotations,omitempty"`
+	Tags           map[string]string  `json:"tags,omitempty"`
+}
+
+// CoreAnnotationV2 represents an event in the Zipkin v2 JSON model.
+type CoreAnnotationV2 struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// CoreEndpointV2 represents a network endpoint in the Zipkin v2 JSON model.
+type CoreEndpointV2 struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        uint16 `json:"port,omitempty"`
+}
+
+// ToV2 converts the span into the Zipkin v2 model. The client and server core
+// annotations determine the span kind, the SERVER_ADDR binary annotation the
+// remote endpoint and all other binary annotations become tags.
+func (s *CoreSpan) ToV2() *CoreSpanV2 {
+	span := &CoreSpanV2{
+		TraceID:   s.TraceID,
+		ParentID:  s.ParentID,
+		ID:        s.ID,
+		Name:      s.Name,
+		Timestamp: s.Timestamp,
+		Duration:  s.Duration,
+		Debug:     s.Debug,
+	}
+
+	var begin, end int64
+	for _, annotation := range s.Annotations {
+		if span.LocalEndpoint == nil && annotation.Host != nil {
+			span.LocalEndpoint = annotation.Host.toV2()
+		}
+		switch annotation.Value {
+		case zipkincore.CLIENT_SEND, zipkincore.SERVER_RECV:
+			begin = annotation.Timestamp
+		case zipkincore.CLIENT_RECV, zipkincore.SERVER_SEND:
+			end = annotation.Timestamp
+		default:
+			span.Annotations = append(span.Annotations, CoreAnnotationV2{
+				Timestamp: annotation.Timestamp,
+				Value:     annotation.Value,
+			})
+			continue
+		}
+		switch annotation.Value {
+		case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV:
+			span.Kind = "CLIENT"
+		default:
+			span.Kind = "SERVER"
+		}
+	}
+	if span.Kind != "" && span.Timestamp == 0 {
+		// the span is shared with, and timed by, the other side of the RPC.
+		span.Timestamp = begin
+		if end > begin {
+			span.Duration = end - begin
+		}
+		span.Shared = span.Kind == "SERVER"
+	}
+
+	for _, annotation := range s.BinaryAnnotations {
+		switch annotation.Key {
+		case zipkincore.SERVER_ADDR:
+			span.RemoteEndpoint = annotation.Endpoint.toV2()
+		case zipkincore.LOCAL_COMPONENT:
+			if span.LocalEndpoint == nil {
+				span.LocalEndpoint = annotation.Endpoint.toV2()
+			}
+		default:
+			if span.LocalEndpoint == nil {
+				span.LocalEndpoint = annotation.Endpoint.toV2()
+			}
+			if span.Tags == nil {
+				span.Tags = make(map[string]string, len(s.BinaryAnnotations))
+			}
+			span.Tags[annotation.Key] = annotation.Value
+		}
+	}
+	return span
+}
+
+// toV2 converts the endpoint into the Zipkin v2 model. The v1 model holds the
+// IPv4 address as its signed 32 bit decimal representation.
+func (e CoreEndpoint) toV2() *CoreEndpointV2 {
+	endpoint := &CoreEndpointV2{
+		ServiceName: e.ServiceName,
+		Port:        uint16(e.Port),
+	}
+	if ipv4, err := strconv.ParseInt(e.Ipv4, 10, 32); err == nil && ipv4 != 0 {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(ipv4))
+		endpoint.IPv4 = ip.String()
+	}
+	if len(e.Ipv6) == net.IPv6len {
+		endpoint.IPv6 = net.IP(e.Ipv6).String()
+	}
+	return endpoint
+}
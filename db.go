@@ -0,0 +1,38 @@
+package zipkintracer
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+)
+
+// StartDBSpan starts a span of SpanKindResource for a database call, tagged
+// with the db.type, db.instance and db.statement tags. The peer.service tag
+// is set to instance, or dbType if instance is empty, so the recorders
+// annotate the database as server address. Empty values are not tagged and a
+// nil parent starts a new trace. Peer host and port tags can be added to the
+// returned span before it is finished.
+func StartDBSpan(tr opentracing.Tracer, parent opentracing.SpanContext, op, dbType, instance, statement string) opentracing.Span {
+	tags := opentracing.Tags{
+		string(otext.SpanKind): SpanKindResource,
+	}
+	for key, value := range map[string]string{
+		string(otext.DBType):      dbType,
+		string(otext.DBInstance):  instance,
+		string(otext.DBStatement): statement,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	if instance != "" {
+		tags[string(otext.PeerService)] = instance
+	} else if dbType != "" {
+		tags[string(otext.PeerService)] = dbType
+	}
+
+	options := []opentracing.StartSpanOption{tags}
+	if parent != nil {
+		options = append(options, opentracing.ChildOf(parent))
+	}
+	return tr.StartSpan(op, options...)
+}
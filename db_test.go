@@ -0,0 +1,82 @@
+package zipkintracer
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+func TestStartDBSpan(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "10.0.0.1:80", "svc"),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parent := tracer.StartSpan("parent")
+	span := StartDBSpan(tracer, parent.Context(), "select user", "sql", "customers", "SELECT * FROM users WHERE id = ?")
+	ext.PeerHostIPv4.Set(span, 0x0a000002)
+	ext.PeerPort.Set(span, 5432)
+	span.Finish()
+	parent.Finish()
+
+	dbSpan := c.spans[0]
+	if want, have := parent.Context().(SpanContext).SpanIDString(), dbSpan.ParentID; want != have {
+		t.Errorf("parent id: want %s, have %s", want, have)
+	}
+	annotations := map[string]*CoreBinaryAnnotation{}
+	for _, annotation := range dbSpan.BinaryAnnotations {
+		annotations[annotation.Key] = annotation
+	}
+	for key, want := range map[string]string{
+		string(ext.DBType):      "sql",
+		string(ext.DBInstance):  "customers",
+		string(ext.DBStatement): "SELECT * FROM users WHERE id = ?",
+	} {
+		if annotation, ok := annotations[key]; !ok || annotation.Value != want {
+			t.Errorf("%s: want %q, have %+v", key, want, annotation)
+		}
+	}
+	sa, ok := annotations[zipkincore.SERVER_ADDR]
+	if !ok {
+		t.Fatal("want sa annotation, have none")
+	}
+	if want, have := "customers", sa.Endpoint.ServiceName; want != have {
+		t.Errorf("sa service name: want %q, have %q", want, have)
+	}
+	if want, have := "167772162", sa.Endpoint.Ipv4; want != have {
+		t.Errorf("sa ipv4: want %q, have %q", want, have)
+	}
+	if want, have := int16(5432), sa.Endpoint.Port; want != have {
+		t.Errorf("sa port: want %d, have %d", want, have)
+	}
+	var values []string
+	for _, annotation := range dbSpan.Annotations {
+		values = append(values, annotation.Value)
+	}
+	if want, have := []string{zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV}, values; len(have) != 2 || have[0] != want[0] || have[1] != want[1] {
+		t.Errorf("annotations: want %v, have %v", want, have)
+	}
+
+	// without parent and instance a root span named after the database type
+	c.spans = nil
+	StartDBSpan(tracer, nil, "ping", "redis", "", "").Finish()
+	if have := c.spans[0].ParentID; have != "" {
+		t.Errorf("want root span, have parent %s", have)
+	}
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		switch annotation.Key {
+		case zipkincore.SERVER_ADDR:
+			if want, have := "redis", annotation.Endpoint.ServiceName; want != have {
+				t.Errorf("sa service name: want %q, have %q", want, have)
+			}
+		case string(ext.DBInstance), string(ext.DBStatement):
+			t.Errorf("unexpected empty tag %s", annotation.Key)
+		}
+	}
+}
@@ -23,11 +23,17 @@ package zipkintracer
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/go-logfmt/logfmt"
+	"github.com/gogo/protobuf/proto"
 	"github.com/opentracing/opentracing-go/log"
 )
 
@@ -58,6 +64,116 @@ func MaterializeWithLogFmt(logFields []log.Field) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
+// MaterializeWithLogFmtSep returns a materializer converting log Fields into a
+// LogFmt like string using kvSep between key and value and fieldSep between
+// fields, followed by terminator, e.g. "\n". Keys and values which hold a
+// separator, the terminator, whitespace, control characters or quotes are
+// quoted so the output can be parsed unambiguously. Keys rejected by the
+// LogFmt encoder fail the materialization, fields without key are left out.
+// MaterializeWithLogFmtSep("=", " ", "") yields the same output as
+// MaterializeWithLogFmt.
+func MaterializeWithLogFmtSep(kvSep, fieldSep, terminator string) func([]log.Field) ([]byte, error) {
+	quote := func(s string) string {
+		for _, sep := range []string{kvSep, fieldSep, terminator} {
+			if sep != "" && strings.Contains(s, sep) {
+				return strconv.Quote(s)
+			}
+		}
+		if strings.IndexFunc(s, func(r rune) bool {
+			return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError
+		}) >= 0 {
+			return strconv.Quote(s)
+		}
+		return s
+	}
+	return func(logFields []log.Field) ([]byte, error) {
+		buffer := bytes.NewBuffer(nil)
+		for _, field := range logFields {
+			if field.Key() == "" {
+				// lazy fields have no key of their own
+				continue
+			}
+			kv, err := logfmt.MarshalKeyvals(field.Key(), field.Value())
+			if err != nil {
+				// values which can't be encoded are replaced by the error like
+				// MaterializeWithLogFmt does, invalid keys are an error
+				if kv, err = logfmt.MarshalKeyvals(field.Key(), err.Error()); err != nil {
+					return nil, err
+				}
+			}
+			// logfmt keys can't hold '=' so the first one separates the value,
+			// which is unquoted to decide on quoting by its content
+			idx := bytes.IndexByte(kv, '=')
+			value := string(kv[idx+1:])
+			if strings.HasPrefix(value, `"`) {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				}
+			}
+			if buffer.Len() > 0 {
+				buffer.WriteString(fieldSep)
+			}
+			buffer.WriteString(quote(string(kv[:idx])))
+			buffer.WriteString(kvSep)
+			buffer.WriteString(quote(value))
+		}
+		buffer.WriteString(terminator)
+		return buffer.Bytes(), nil
+	}
+}
+
+// MaterializeWithProtobuf converts log Fields into a protobuf encoded LogFields
+// message using the following schema:
+//
+//  message LogFields {
+//    repeated LogField fields = 1;
+//  }
+//
+//  message LogField {
+//    string key = 1;
+//    oneof value {
+//      string string_value = 2;
+//      bool   bool_value   = 3;
+//      int64  int_value    = 4;
+//      uint64 uint_value   = 5;
+//      double double_value = 6;
+//    }
+//  }
+//
+// Errors and objects are encoded as string values.
+func MaterializeWithProtobuf(logFields []log.Field) ([]byte, error) {
+	fields := &protobufFields{
+		buf:   proto.NewBuffer(nil),
+		field: proto.NewBuffer(nil),
+	}
+	for _, field := range logFields {
+		field.Marshal(fields)
+	}
+	return fields.buf.Bytes(), fields.err
+}
+
+// MaterializeWithMsgPack converts log Fields into a msgpack map of field keys
+// to their typed values. Errors and objects are encoded as string values.
+func MaterializeWithMsgPack(logFields []log.Field) ([]byte, error) {
+	fields := &msgpackFields{}
+	for _, field := range logFields {
+		field.Marshal(fields)
+	}
+	var buf bytes.Buffer
+	switch {
+	case fields.n < 16:
+		buf.WriteByte(0x80 | byte(fields.n))
+	case fields.n <= math.MaxUint16:
+		buf.WriteByte(0xde)
+		binary.Write(&buf, binary.BigEndian, uint16(fields.n))
+	default:
+		buf.WriteByte(0xdf)
+		binary.Write(&buf, binary.BigEndian, uint32(fields.n))
+	}
+	buf.Write(fields.buf.Bytes())
+	return buf.Bytes(), nil
+}
+
 // StrictZipkinMaterializer will only record a log.Field of type "event".
 func StrictZipkinMaterializer(logFields []log.Field) ([]byte, error) {
 	for _, field := range logFields {
@@ -111,3 +227,250 @@ func (ml fieldsAsMap) EmitObject(key string, value interface{}) {
 func (ml fieldsAsMap) EmitLazyLogger(value log.LazyLogger) {
 	value(ml)
 }
+
+// protobuf wire types and LogField field numbers, see MaterializeWithProtobuf.
+const (
+	pbWireVarint  = 0
+	pbWireFixed64 = 1
+	pbWireBytes   = 2
+
+	pbLogFieldsField  = 1
+	pbKeyField        = 1
+	pbStringField     = 2
+	pbBoolField       = 3
+	pbIntField        = 4
+	pbUintField       = 5
+	pbDoubleField     = 6
+	pbLogFieldMessage = pbLogFieldsField<<3 | pbWireBytes
+)
+
+// protobufFields implements log.Encoder, appending every emitted field to buf
+// as a LogField message.
+type protobufFields struct {
+	buf   *proto.Buffer
+	field *proto.Buffer
+	err   error
+}
+
+func (pf *protobufFields) emit(key string, wireType, fieldNum uint64, encode func(b *proto.Buffer) error) {
+	if pf.err != nil {
+		return
+	}
+	pf.field.Reset()
+	if pf.err = pf.field.EncodeVarint(pbKeyField<<3 | pbWireBytes); pf.err != nil {
+		return
+	}
+	if pf.err = pf.field.EncodeStringBytes(key); pf.err != nil {
+		return
+	}
+	if pf.err = pf.field.EncodeVarint(fieldNum<<3 | wireType); pf.err != nil {
+		return
+	}
+	if pf.err = encode(pf.field); pf.err != nil {
+		return
+	}
+	if pf.err = pf.buf.EncodeVarint(pbLogFieldMessage); pf.err != nil {
+		return
+	}
+	pf.err = pf.buf.EncodeRawBytes(pf.field.Bytes())
+}
+
+func (pf *protobufFields) emitString(key, value string) {
+	pf.emit(key, pbWireBytes, pbStringField, func(b *proto.Buffer) error {
+		return b.EncodeStringBytes(value)
+	})
+}
+
+func (pf *protobufFields) emitInt(key string, value int64) {
+	pf.emit(key, pbWireVarint, pbIntField, func(b *proto.Buffer) error {
+		return b.EncodeVarint(uint64(value))
+	})
+}
+
+func (pf *protobufFields) emitUint(key string, value uint64) {
+	pf.emit(key, pbWireVarint, pbUintField, func(b *proto.Buffer) error {
+		return b.EncodeVarint(value)
+	})
+}
+
+func (pf *protobufFields) emitDouble(key string, value float64) {
+	pf.emit(key, pbWireFixed64, pbDoubleField, func(b *proto.Buffer) error {
+		return b.EncodeFixed64(math.Float64bits(value))
+	})
+}
+
+func (pf *protobufFields) EmitString(key, value string) {
+	pf.emitString(key, value)
+}
+
+func (pf *protobufFields) EmitBool(key string, value bool) {
+	var v uint64
+	if value {
+		v = 1
+	}
+	pf.emit(key, pbWireVarint, pbBoolField, func(b *proto.Buffer) error {
+		return b.EncodeVarint(v)
+	})
+}
+
+func (pf *protobufFields) EmitInt(key string, value int) {
+	pf.emitInt(key, int64(value))
+}
+
+func (pf *protobufFields) EmitInt32(key string, value int32) {
+	pf.emitInt(key, int64(value))
+}
+
+func (pf *protobufFields) EmitInt64(key string, value int64) {
+	pf.emitInt(key, value)
+}
+
+func (pf *protobufFields) EmitUint32(key string, value uint32) {
+	pf.emitUint(key, uint64(value))
+}
+
+func (pf *protobufFields) EmitUint64(key string, value uint64) {
+	pf.emitUint(key, value)
+}
+
+func (pf *protobufFields) EmitFloat32(key string, value float32) {
+	pf.emitDouble(key, float64(value))
+}
+
+func (pf *protobufFields) EmitFloat64(key string, value float64) {
+	pf.emitDouble(key, value)
+}
+
+func (pf *protobufFields) EmitObject(key string, value interface{}) {
+	pf.emitString(key, fmt.Sprintf("%+v", value))
+}
+
+func (pf *protobufFields) EmitLazyLogger(value log.LazyLogger) {
+	value(pf)
+}
+
+// msgpackFields implements log.Encoder, appending every emitted field to buf as
+// a key value pair of a msgpack map holding n entries.
+type msgpackFields struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (mf *msgpackFields) writeString(value string) {
+	switch l := len(value); {
+	case l < 32:
+		mf.buf.WriteByte(0xa0 | byte(l))
+	case l <= math.MaxUint8:
+		mf.buf.WriteByte(0xd9)
+		mf.buf.WriteByte(byte(l))
+	case l <= math.MaxUint16:
+		mf.buf.WriteByte(0xda)
+		binary.Write(&mf.buf, binary.BigEndian, uint16(l))
+	default:
+		mf.buf.WriteByte(0xdb)
+		binary.Write(&mf.buf, binary.BigEndian, uint32(l))
+	}
+	mf.buf.WriteString(value)
+}
+
+func (mf *msgpackFields) writeKey(key string) {
+	mf.n++
+	mf.writeString(key)
+}
+
+func (mf *msgpackFields) emitInt(key string, value int64) {
+	mf.writeKey(key)
+	switch {
+	case value >= 0:
+		mf.writeUint(uint64(value))
+	case value >= -32:
+		mf.buf.WriteByte(byte(int8(value)))
+	case value >= math.MinInt8:
+		mf.buf.WriteByte(0xd0)
+		mf.buf.WriteByte(byte(int8(value)))
+	case value >= math.MinInt16:
+		mf.buf.WriteByte(0xd1)
+		binary.Write(&mf.buf, binary.BigEndian, int16(value))
+	case value >= math.MinInt32:
+		mf.buf.WriteByte(0xd2)
+		binary.Write(&mf.buf, binary.BigEndian, int32(value))
+	default:
+		mf.buf.WriteByte(0xd3)
+		binary.Write(&mf.buf, binary.BigEndian, value)
+	}
+}
+
+func (mf *msgpackFields) writeUint(value uint64) {
+	switch {
+	case value <= 0x7f:
+		mf.buf.WriteByte(byte(value))
+	case value <= math.MaxUint8:
+		mf.buf.WriteByte(0xcc)
+		mf.buf.WriteByte(byte(value))
+	case value <= math.MaxUint16:
+		mf.buf.WriteByte(0xcd)
+		binary.Write(&mf.buf, binary.BigEndian, uint16(value))
+	case value <= math.MaxUint32:
+		mf.buf.WriteByte(0xce)
+		binary.Write(&mf.buf, binary.BigEndian, uint32(value))
+	default:
+		mf.buf.WriteByte(0xcf)
+		binary.Write(&mf.buf, binary.BigEndian, value)
+	}
+}
+
+func (mf *msgpackFields) EmitString(key, value string) {
+	mf.writeKey(key)
+	mf.writeString(value)
+}
+
+func (mf *msgpackFields) EmitBool(key string, value bool) {
+	mf.writeKey(key)
+	if value {
+		mf.buf.WriteByte(0xc3)
+	} else {
+		mf.buf.WriteByte(0xc2)
+	}
+}
+
+func (mf *msgpackFields) EmitInt(key string, value int) {
+	mf.emitInt(key, int64(value))
+}
+
+func (mf *msgpackFields) EmitInt32(key string, value int32) {
+	mf.emitInt(key, int64(value))
+}
+
+func (mf *msgpackFields) EmitInt64(key string, value int64) {
+	mf.emitInt(key, value)
+}
+
+func (mf *msgpackFields) EmitUint32(key string, value uint32) {
+	mf.writeKey(key)
+	mf.writeUint(uint64(value))
+}
+
+func (mf *msgpackFields) EmitUint64(key string, value uint64) {
+	mf.writeKey(key)
+	mf.writeUint(value)
+}
+
+func (mf *msgpackFields) EmitFloat32(key string, value float32) {
+	mf.writeKey(key)
+	mf.buf.WriteByte(0xca)
+	binary.Write(&mf.buf, binary.BigEndian, math.Float32bits(value))
+}
+
+func (mf *msgpackFields) EmitFloat64(key string, value float64) {
+	mf.writeKey(key)
+	mf.buf.WriteByte(0xcb)
+	binary.Write(&mf.buf, binary.BigEndian, math.Float64bits(value))
+}
+
+func (mf *msgpackFields) EmitObject(key string, value interface{}) {
+	mf.EmitString(key, fmt.Sprintf("%+v", value))
+}
+
+func (mf *msgpackFields) EmitLazyLogger(value log.LazyLogger) {
+	value(mf)
+}
@@ -1,9 +1,15 @@
 package zipkintracer
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/gogo/protobuf/proto"
 	"github.com/opentracing/opentracing-go/log"
 )
 
@@ -57,6 +63,187 @@ func TestMaterializeWithLogFmt(t *testing.T) {
 	}
 }
 
+func TestMaterializeWithLogFmtSep(t *testing.T) {
+	logFields := getLogFields()
+
+	want, _ := MaterializeWithLogFmt(logFields)
+	have, err := MaterializeWithLogFmtSep("=", " ", "")(logFields)
+	if err != nil {
+		t.Fatalf("expected logfmt string, got error %+v", err)
+	}
+	if string(want) != string(have) {
+		t.Errorf("want:\n%s\nhave\n%s", want, have)
+	}
+
+	logFields = []log.Field{
+		log.String("event", "cache miss"),
+		log.String("tab", "a\tb"),
+		log.String("semicolon", "a;b"),
+		log.String("colon", "a:b"),
+		log.Int("int", 42),
+		log.String("quote", `"q`),
+		log.String("backtick", "`b`"),
+	}
+	for _, test := range []struct {
+		kvSep, fieldSep, terminator, want string
+	}{
+		{"=", " ", "", `event="cache miss" tab="a\tb" semicolon=a;b colon=a:b int=42 quote="\"q" backtick=` + "`b`"},
+		{"=", "\t", "\n", `event="cache miss"` + "\t" + `tab="a\tb"` + "\t" + `semicolon=a;b` + "\t" + `colon=a:b` + "\t" + `int=42` + "\t" + `quote="\"q"` + "\t" + "backtick=`b`" + "\n"},
+		{":", ";", "", `event:"cache miss";tab:"a\tb";semicolon:"a;b";colon:"a:b";int:42;quote:"\"q";backtick:` + "`b`"},
+		{"=", ",", ";", `event="cache miss",tab="a\tb",semicolon="a;b",colon=a:b,int=42,quote="\"q",backtick=` + "`b`;"},
+	} {
+		have, err := MaterializeWithLogFmtSep(test.kvSep, test.fieldSep, test.terminator)(logFields)
+		if err != nil {
+			t.Fatalf("expected logfmt string, got error %+v", err)
+		}
+		if test.want != string(have) {
+			t.Errorf("want:\n%s\nhave\n%s", test.want, have)
+		}
+	}
+
+	// keys rejected by the logfmt encoder fail the materialization
+	if _, err := MaterializeWithLogFmtSep("=", "\t", "\n")([]log.Field{log.String(`= "`, "v")}); err == nil {
+		t.Error("invalid key: want error, have nil")
+	}
+}
+
+// decodeProtobufFields decodes a LogFields message as produced by
+// MaterializeWithProtobuf into a key => value map.
+func decodeProtobufFields(t *testing.T, b []byte) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for len(b) > 0 {
+		tag, n := proto.DecodeVarint(b)
+		if n == 0 || tag != pbLogFieldMessage {
+			t.Fatalf("unexpected LogFields tag %d", tag)
+		}
+		size, m := proto.DecodeVarint(b[n:])
+		if m == 0 || uint64(len(b)-n-m) < size {
+			t.Fatalf("invalid LogField length %d", size)
+		}
+		field := proto.NewBuffer(b[n+m : n+m+int(size)])
+		b = b[n+m+int(size):]
+		if tag, err := field.DecodeVarint(); err != nil || tag != pbKeyField<<3|pbWireBytes {
+			t.Fatalf("unexpected LogField key tag %d (err: %v)", tag, err)
+		}
+		key, err := field.DecodeStringBytes()
+		if err != nil {
+			t.Fatalf("unable to decode LogField key: %+v", err)
+		}
+		tag, err = field.DecodeVarint()
+		if err != nil {
+			t.Fatalf("unable to decode LogField value tag: %+v", err)
+		}
+		switch tag >> 3 {
+		case pbStringField:
+			fields[key], err = field.DecodeStringBytes()
+		case pbBoolField:
+			var v uint64
+			v, err = field.DecodeVarint()
+			fields[key] = v == 1
+		case pbIntField:
+			var v uint64
+			v, err = field.DecodeVarint()
+			fields[key] = int64(v)
+		case pbUintField:
+			fields[key], err = field.DecodeVarint()
+		case pbDoubleField:
+			var v uint64
+			v, err = field.DecodeFixed64()
+			fields[key] = math.Float64frombits(v)
+		default:
+			t.Fatalf("unexpected LogField value field %d", tag>>3)
+		}
+		if err != nil {
+			t.Fatalf("unable to decode LogField value for %q: %+v", key, err)
+		}
+	}
+	return fields
+}
+
+func TestMaterializeWithProtobuf(t *testing.T) {
+	logFields := []log.Field{
+		log.String("string", "value"),
+		log.Int("int", -42),
+		log.Uint64("uint64", 64),
+		log.Bool("bool", true),
+		log.Float64("float64", 64.123),
+		log.Error(errors.New("an error")),
+		log.Object("object", obj{a: 42, b: "string"}),
+		log.Lazy(func(fv log.Encoder) { fv.EmitString("lazy", "logger") }),
+	}
+	want := map[string]interface{}{
+		"string":  "value",
+		"int":     int64(-42),
+		"uint64":  uint64(64),
+		"bool":    true,
+		"float64": 64.123,
+		"error":   "an error",
+		"object":  "{a:42 b:string}",
+		"lazy":    "logger",
+	}
+	b, err := MaterializeWithProtobuf(logFields)
+	if err != nil {
+		t.Fatalf("expected protobuf message, got error %+v", err)
+	}
+	if have := decodeProtobufFields(t, b); !reflect.DeepEqual(want, have) {
+		t.Errorf("want:\n%+v\nhave\n%+v", want, have)
+	}
+}
+
+func TestMaterializeWithMsgPack(t *testing.T) {
+	// the expected encodings are taken from the msgpack specification, each
+	// field is materialized on its own into a map of one entry keyed "k"
+	// (0x81 0xa1 'k')
+	for _, test := range []struct {
+		field log.Field
+		want  string
+	}{
+		{log.String("k", ""), "81a16b" + "a0"},
+		{log.String("k", "value"), "81a16b" + "a576616c7565"},
+		{log.String("k", strings.Repeat("x", 32)), "81a16b" + "d920" + strings.Repeat("78", 32)},
+		{log.String("k", strings.Repeat("x", 256)), "81a16b" + "da0100" + strings.Repeat("78", 256)},
+		{log.Int("k", 42), "81a16b" + "2a"},
+		{log.Int("k", 200), "81a16b" + "ccc8"},
+		{log.Int("k", -1), "81a16b" + "ff"},
+		{log.Int("k", -32), "81a16b" + "e0"},
+		{log.Int("k", -42), "81a16b" + "d0d6"},
+		{log.Int32("k", -300), "81a16b" + "d1fed4"},
+		{log.Int32("k", math.MinInt32), "81a16b" + "d280000000"},
+		{log.Int64("k", math.MinInt64), "81a16b" + "d38000000000000000"},
+		{log.Uint32("k", 70000), "81a16b" + "ce00011170"},
+		{log.Uint64("k", math.MaxUint64), "81a16b" + "cfffffffffffffffff"},
+		{log.Bool("k", true), "81a16b" + "c3"},
+		{log.Bool("k", false), "81a16b" + "c2"},
+		{log.Float32("k", 32.5), "81a16b" + "ca42020000"},
+		{log.Float64("k", 64.123), "81a16b" + "cb405007df3b645a1d"},
+		{log.Error(errors.New("an error")), "81a56572726f72" + "a8616e206572726f72"},
+		{log.Lazy(func(fv log.Encoder) { fv.EmitBool("k", false) }), "81a16b" + "c2"},
+	} {
+		b, err := MaterializeWithMsgPack([]log.Field{test.field})
+		if err != nil {
+			t.Fatalf("%v: expected msgpack map, got error %+v", test.field, err)
+		}
+		if have := hex.EncodeToString(b); test.want != have {
+			t.Errorf("%v: want %s, have %s", test.field, test.want, have)
+		}
+	}
+
+	// maps of 16 entries and more use the map 16 format
+	var logFields []log.Field
+	want := "de0010"
+	for i := 0; i < 16; i++ {
+		logFields = append(logFields, log.Int(string(rune('a'+i)), i))
+		want += fmt.Sprintf("a1%02x%02x", 'a'+i, i)
+	}
+	b, err := MaterializeWithMsgPack(logFields)
+	if err != nil {
+		t.Fatalf("expected msgpack map, got error %+v", err)
+	}
+	if have := hex.EncodeToString(b); want != have {
+		t.Errorf("map 16: want %s, have %s", want, have)
+	}
+}
+
 func TestStrictZipkinMaterializer(t *testing.T) {
 	logFields := getLogFields()
 	want := `EventValue`
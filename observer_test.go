@@ -0,0 +1,68 @@
+package zipkintracer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	otobserver "github.com/opentracing-contrib/go-observer"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// finishObserver reports finished spans as "<name>:<operation>:<duration>".
+type finishObserver struct {
+	name     string
+	finished *[]string
+}
+
+func (o finishObserver) OnStartSpan(sp opentracing.Span, _ string, _ opentracing.StartSpanOptions) (otobserver.SpanObserver, bool) {
+	return &finishSpanObserver{finishObserver: o, span: sp.(Span)}, true
+}
+
+type finishSpanObserver struct {
+	finishObserver
+	span Span
+}
+
+func (o *finishSpanObserver) OnSetOperationName(string) {}
+
+func (o *finishSpanObserver) OnSetTag(string, interface{}) {}
+
+func (o *finishSpanObserver) OnFinish(options opentracing.FinishOptions) {
+	*o.finished = append(*o.finished, fmt.Sprintf("%s:%s:%s",
+		o.name, o.span.Operation(), options.FinishTime.Sub(o.span.Start())))
+}
+
+func TestMultipleObservers(t *testing.T) {
+	var (
+		finished []string
+		now      = time.Now()
+	)
+	clock := func() time.Time {
+		now = now.Add(250 * time.Millisecond)
+		return now
+	}
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		WithClock(clock),
+		WithObserver(finishObserver{name: "first", finished: &finished}),
+		WithObserver(finishObserver{name: "second", finished: &finished}),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	span := tracer.StartSpan("op")
+	span.SetOperationName("renamed")
+	span.Finish()
+
+	want := []string{"first:renamed:250ms", "second:renamed:250ms"}
+	if fmt.Sprint(want) != fmt.Sprint(finished) {
+		t.Errorf("want %v, have %v", want, finished)
+	}
+	if want, have := 250*time.Millisecond, recorder.GetSpans()[0].Duration; want != have {
+		t.Errorf("recorded duration: want %s, have %s", want, have)
+	}
+}
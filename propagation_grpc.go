@@ -0,0 +1,60 @@
+package zipkintracer
+
+import (
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// grpcMetadataCarrier adapts gRPC metadata to the TextMap interfaces.
+// metadata.MD keys are lowercase and hold multiple values per key.
+type grpcMetadataCarrier map[string][]string
+
+func (c grpcMetadataCarrier) Set(key, val string) {
+	c[strings.ToLower(key)] = []string{val}
+}
+
+func (c grpcMetadataCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, vals := range c {
+		// binary metadata can't hold trace state
+		if len(vals) == 0 || strings.HasSuffix(k, "-bin") {
+			continue
+		}
+		// the first value wins if a key was appended more than once
+		if err := handler(k, vals[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InjectGRPC writes the SpanContext into gRPC metadata using the text map
+// propagation of tracer, i.e. the B3 keys for this package's tracers. md is
+// typically a google.golang.org/grpc/metadata.MD, which converts to
+// map[string][]string. Existing values of the B3 keys are replaced.
+func InjectGRPC(tracer opentracing.Tracer, sc SpanContext, md map[string][]string) error {
+	if md == nil {
+		return opentracing.ErrInvalidCarrier
+	}
+	return tracer.Inject(sc, opentracing.TextMap, grpcMetadataCarrier(md))
+}
+
+// ExtractGRPC reads a SpanContext from gRPC metadata written by InjectGRPC or
+// any other B3 compatible tracer, applying the extraction options of tracer.
+// Keys are matched case insensitively and the first value of a key is used.
+func ExtractGRPC(tracer opentracing.Tracer, md map[string][]string) (SpanContext, error) {
+	return extractSpanContext(tracer, opentracing.TextMap, grpcMetadataCarrier(md))
+}
+
+// extractSpanContext extracts a SpanContext of this package from carrier.
+func extractSpanContext(tracer opentracing.Tracer, format, carrier interface{}) (SpanContext, error) {
+	sc, err := tracer.Extract(format, carrier)
+	if err != nil {
+		return SpanContext{}, err
+	}
+	ctx, ok := sc.(SpanContext)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidSpanContext
+	}
+	return ctx, nil
+}
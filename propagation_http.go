@@ -0,0 +1,28 @@
+package zipkintracer
+
+import (
+	"net/http"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// InjectHTTPRequest writes the SpanContext into the headers of req using the
+// HTTP headers propagation of tracer, i.e. the B3 headers for this package's
+// tracers. Existing values of the B3 headers are replaced.
+func InjectHTTPRequest(tracer opentracing.Tracer, sc SpanContext, req *http.Request) error {
+	if req == nil || req.Header == nil {
+		return opentracing.ErrInvalidCarrier
+	}
+	return tracer.Inject(sc, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+}
+
+// ExtractHTTPRequest reads a SpanContext from the headers of req written by
+// InjectHTTPRequest or any other B3 compatible tracer, applying the extraction
+// options of tracer. Like Tracer.Extract it returns a zero SpanContext, see
+// SpanContext.IsZero, if req holds no trace context.
+func ExtractHTTPRequest(tracer opentracing.Tracer, req *http.Request) (SpanContext, error) {
+	if req == nil {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	return extractSpanContext(tracer, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+}
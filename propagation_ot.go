@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -33,6 +34,43 @@ const (
 	zipkinFlags        = prefixTracerState + "flags"
 )
 
+// internalFlags are the flags holding the tracer's own sampling and root state,
+// which are neither read from nor written to X-B3-Flags.
+const internalFlags = flag.SamplingSet | flag.Sampled | flag.IsRoot
+
+// encodeBaggageKey percent-encodes all characters of a baggage key which are
+// not allowed in HTTP header names (RFC 7230 tokens).
+func encodeBaggageKey(key string) string {
+	const hex = "0123456789ABCDEF"
+	var encoded []byte
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if isHeaderTokenChar(c) {
+			if encoded != nil {
+				encoded = append(encoded, c)
+			}
+			continue
+		}
+		if encoded == nil {
+			encoded = append(make([]byte, 0, len(key)+8), key[:i]...)
+		}
+		encoded = append(encoded, '%', hex[c>>4], hex[c&0x0f])
+	}
+	if encoded == nil {
+		return key
+	}
+	return string(encoded)
+}
+
+func isHeaderTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	// '%' is a token char but is reserved for our escape sequences.
+	return strings.IndexByte("!#$&'*+-.^_`|~", c) >= 0
+}
+
 func (p *textMapPropagator) Inject(
 	spanContext opentracing.SpanContext,
 	opaqueCarrier interface{},
@@ -62,12 +100,17 @@ func (p *textMapPropagator) Inject(
 		carrier.Set(zipkinSampled, "0")
 	}
 
-	// we only need to inject the debug flag if set. see flag package for details.
+	// the flags used by the tracer itself are never propagated. Sampled spans
+	// pass on all other flags, e.g. custom flags received from upstream, so
+	// they survive every hop. see flag package for details.
 	flags := sc.Flags & flag.Debug
+	if sc.Sampled {
+		flags = sc.Flags &^ internalFlags
+	}
 	carrier.Set(zipkinFlags, strconv.FormatUint(uint64(flags), 10))
 
 	for k, v := range sc.Baggage {
-		carrier.Set(prefixBaggage+k, v)
+		carrier.Set(p.tracer.options.baggagePrefix+encodeBaggageKey(k), v)
 	}
 	return nil
 }
@@ -89,6 +132,7 @@ func (p *textMapPropagator) Extract(
 		err          error
 	)
 	decodedBaggage := make(map[string]string)
+	baggagePrefix := strings.ToLower(p.tracer.options.baggagePrefix)
 
 	var traceIDFound, spanIDFound bool
 	err = carrier.ForeachKey(func(k, v string) error {
@@ -133,13 +177,17 @@ func (p *textMapPropagator) Extract(
 			if err != nil {
 				return opentracing.ErrSpanContextCorrupted
 			}
-			if flag.Flags(f)&flag.Debug == flag.Debug {
-				flags |= flag.Debug
-			}
+			flags |= flag.Flags(f) &^ internalFlags
 		default:
 			lowercaseK := strings.ToLower(k)
-			if strings.HasPrefix(lowercaseK, prefixBaggage) {
-				decodedBaggage[strings.TrimPrefix(lowercaseK, prefixBaggage)] = v
+			if strings.HasPrefix(lowercaseK, baggagePrefix) {
+				key := strings.TrimPrefix(lowercaseK, baggagePrefix)
+				// keys which are not escaped, e.g. holding a raw %, are
+				// taken as is.
+				if unescaped, err := url.PathUnescape(key); err == nil {
+					key = unescaped
+				}
+				decodedBaggage[key] = v
 			}
 		}
 		return nil
@@ -153,8 +201,9 @@ func (p *textMapPropagator) Extract(
 		return nil, opentracing.ErrSpanContextCorrupted
 	}
 
-	// check if Sample state was communicated through the Flags bitset
-	if !sampled && flags&flag.Sampled == flag.Sampled {
+	// check if Sample state was communicated through the Flags bitset, debug
+	// implies sampled.
+	if !sampled && flags&(flag.Sampled|flag.Debug) != 0 {
 		sampled = true
 	}
 
@@ -237,7 +286,9 @@ func (p *binaryPropagator) Extract(
 		return nil, opentracing.ErrSpanContextCorrupted
 	}
 	buf := make([]byte, length)
-	if n, err := carrier.Read(buf); err != nil {
+	// A single Read may return fewer bytes than requested on stream based
+	// carriers, so keep reading until the announced length is consumed.
+	if n, err := io.ReadFull(carrier, buf); err != nil {
 		if n > 0 {
 			return nil, opentracing.ErrSpanContextCorrupted
 		}
@@ -250,7 +301,8 @@ func (p *binaryPropagator) Extract(
 	}
 
 	flags := flag.Flags(ctx.Flags)
-	if flags&flag.Sampled == flag.Sampled {
+	// debug implies sampled
+	if flags&(flag.Sampled|flag.Debug) != 0 {
 		ctx.Sampled = true
 	}
 	// this propagator expects sampling state to be explicitly propagated by the
@@ -258,12 +310,18 @@ func (p *binaryPropagator) Extract(
 	// run its sampler in case it is not the root of the trace.
 	flags |= flag.SamplingSet
 
+	// the upstream root span has no parent, see Inject
+	var parentSpanID *uint64
+	if flags&flag.IsRoot == 0 {
+		parentSpanID = &ctx.ParentSpanId
+	}
+
 	return SpanContext{
 		TraceID:      types.TraceID{Low: ctx.TraceId, High: ctx.TraceIdHigh},
 		SpanID:       ctx.SpanId,
 		Sampled:      ctx.Sampled,
 		Baggage:      ctx.BaggageItems,
-		ParentSpanID: &ctx.ParentSpanId,
+		ParentSpanID: parentSpanID,
 		Flags:        flags,
 	}, nil
 }
@@ -2,11 +2,14 @@ package zipkintracer_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -267,6 +270,33 @@ func TestTextMapPropagator_Extract(t *testing.T) {
 				Flags:   flag.SamplingSet,
 			},
 		},
+		// 128-bit trace ids are split into both halves
+		{
+			headerVals: map[string]string{
+				"X-B3-TraceId": "0000000000000007" + traceIDHex,
+				"X-B3-SpanId":  traceIDHex,
+			},
+			want: zipkintracer.SpanContext{
+				TraceID: types.TraceID{High: 7, Low: traceIDUintVal},
+				SpanID:  traceIDUintVal,
+				Baggage: map[string]string{},
+			},
+		},
+		// debug implies sampled
+		{
+			headerVals: map[string]string{
+				"X-B3-TraceId": traceIDHex,
+				"X-B3-SpanId":  traceIDHex,
+				"X-B3-Flags":   "1",
+			},
+			want: zipkintracer.SpanContext{
+				TraceID: traceID,
+				SpanID:  traceIDUintVal,
+				Baggage: map[string]string{},
+				Sampled: true,
+				Flags:   flag.Debug,
+			},
+		},
 	} {
 		header := http.Header{}
 		for k, v := range tc.headerVals {
@@ -290,6 +320,98 @@ func TestTextMapPropagator_Extract(t *testing.T) {
 	}
 }
 
+func TestTextMapPropagator_DebugFlag(t *testing.T) {
+	recorder := zipkintracer.NewInMemoryRecorder()
+	tracer, err := zipkintracer.NewTracer(
+		recorder,
+		zipkintracer.WithSampler(func(_ uint64) bool { return false }),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-B3-TraceId", "0000000000000001")
+	header.Set("X-B3-SpanId", "0000000000000002")
+	header.Set("X-B3-Flags", "1")
+	spanCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := tracer.StartSpan("span", opentracing.ChildOf(spanCtx))
+
+	// the debug flag is propagated downstream
+	out := http.Header{}
+	if err := tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "1", out.Get("X-B3-Flags"); want != have {
+		t.Errorf("X-B3-Flags: want %q, have %q", want, have)
+	}
+	if want, have := "1", out.Get("X-B3-Sampled"); want != have {
+		t.Errorf("X-B3-Sampled: want %q, have %q", want, have)
+	}
+	span.Finish()
+
+	spans := recorder.GetSampledSpans()
+	if want, have := 1, len(spans); want != have {
+		t.Fatalf("sampled spans: want %d, have %d", want, have)
+	}
+	if want, have := flag.Debug, spans[0].Context.Flags&flag.Debug; want != have {
+		t.Errorf("flags: want %d, have %d", want, have)
+	}
+}
+
+func TestTextMapPropagator_SampledTriState(t *testing.T) {
+	for _, tc := range []struct {
+		sampledHeader string
+		localDecision bool
+		wantCalls     int
+		wantSampled   bool
+	}{
+		// absent header defers the decision to the local sampler
+		{"", true, 1, true},
+		{"", false, 1, false},
+		// explicit upstream decisions bypass the local sampler
+		{"0", true, 0, false},
+		{"1", false, 0, true},
+	} {
+		var calls int
+		tracer, err := zipkintracer.NewTracer(
+			zipkintracer.NewInMemoryRecorder(),
+			zipkintracer.WithSampler(func(_ uint64) bool {
+				calls++
+				return tc.localDecision
+			}),
+		)
+		if err != nil {
+			t.Fatalf("Unable to create Tracer: %+v", err)
+		}
+
+		header := http.Header{}
+		header.Set("X-B3-TraceId", "0000000000000001")
+		header.Set("X-B3-SpanId", "0000000000000002")
+		if tc.sampledHeader != "" {
+			header.Set("X-B3-Sampled", tc.sampledHeader)
+		}
+		spanCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		span := tracer.StartSpan("span", opentracing.ChildOf(spanCtx))
+		child := tracer.StartSpan("child", opentracing.ChildOf(span.Context()))
+
+		if want, have := tc.wantCalls, calls; want != have {
+			t.Errorf("header %q: sampler calls: want %d, have %d", tc.sampledHeader, want, have)
+		}
+		for _, s := range []opentracing.Span{span, child} {
+			if want, have := tc.wantSampled, s.Context().(zipkintracer.SpanContext).Sampled; want != have {
+				t.Errorf("header %q: sampled: want %t, have %t", tc.sampledHeader, want, have)
+			}
+		}
+	}
+}
+
 func TestTextMapPropagator_Extract_Fail(t *testing.T) {
 	tracer, err := zipkintracer.NewTracer(
 		zipkintracer.NewInMemoryRecorder(),
@@ -321,6 +443,14 @@ func TestTextMapPropagator_Extract_Fail(t *testing.T) {
 			},
 			wantError: opentracing.ErrSpanContextCorrupted,
 		},
+		// trace ids must be 16 or 32 hex characters
+		{
+			headerVals: map[string]string{
+				"X-B3-TraceId": traceIDHex + "0",
+				"X-B3-SpanId":  traceIDHex,
+			},
+			wantError: opentracing.ErrSpanContextCorrupted,
+		},
 	} {
 		header := http.Header{}
 		for k, v := range tc.headerVals {
@@ -335,6 +465,302 @@ func TestTextMapPropagator_Extract_Fail(t *testing.T) {
 	}
 }
 
+func TestBinaryPropagator_RoundTrip(t *testing.T) {
+	tracer, err := zipkintracer.NewTracer(zipkintracer.NewInMemoryRecorder())
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parentSpanID := uint64(0x0102030405060708)
+	for _, tc := range []struct {
+		name    string
+		context zipkintracer.SpanContext
+	}{
+		{"child", zipkintracer.SpanContext{
+			TraceID:      types.TraceID{High: 0x1122334455667788, Low: 0x99aabbccddeeff00},
+			SpanID:       0x8877665544332211,
+			ParentSpanID: &parentSpanID,
+			Sampled:      true,
+			Baggage:      map[string]string{"user": "alice", "tenant": "42"},
+		}},
+		{"root", zipkintracer.SpanContext{
+			TraceID: types.TraceID{Low: 1},
+			SpanID:  1,
+		}},
+		{"debug", zipkintracer.SpanContext{
+			TraceID:      types.TraceID{Low: 2},
+			SpanID:       3,
+			ParentSpanID: &parentSpanID,
+			Flags:        flag.Debug,
+		}},
+	} {
+		buf := &bytes.Buffer{}
+		if err := tracer.Inject(tc.context, opentracing.Binary, buf); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		// stream carriers may deliver the payload in pieces
+		extracted, err := tracer.Extract(opentracing.Binary, iotest.OneByteReader(buf))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got := extracted.(zipkintracer.SpanContext)
+
+		if want, have := tc.context.TraceID, got.TraceID; want != have {
+			t.Errorf("%s: trace id: want %+v, have %+v", tc.name, want, have)
+		}
+		if want, have := tc.context.SpanID, got.SpanID; want != have {
+			t.Errorf("%s: span id: want %d, have %d", tc.name, want, have)
+		}
+		if tc.context.ParentSpanID == nil {
+			if got.ParentSpanID != nil {
+				t.Errorf("%s: parent span id: want nil, have %d", tc.name, *got.ParentSpanID)
+			}
+		} else if got.ParentSpanID == nil || *got.ParentSpanID != *tc.context.ParentSpanID {
+			t.Errorf("%s: parent span id: want %d, have %v", tc.name, *tc.context.ParentSpanID, got.ParentSpanID)
+		}
+		// debug implies sampled
+		if want, have := tc.context.Sampled || tc.context.Flags&flag.Debug != 0, got.Sampled; want != have {
+			t.Errorf("%s: sampled: want %t, have %t", tc.name, want, have)
+		}
+		if want, have := tc.context.Flags&flag.Debug, got.Flags&flag.Debug; want != have {
+			t.Errorf("%s: debug flag: want %d, have %d", tc.name, want, have)
+		}
+		if len(tc.context.Baggage) > 0 && !reflect.DeepEqual(tc.context.Baggage, got.Baggage) {
+			t.Errorf("%s: baggage: want %v, have %v", tc.name, tc.context.Baggage, got.Baggage)
+		}
+	}
+
+	// a payload shorter than its announced length is corrupted
+	buf := &bytes.Buffer{}
+	if err := tracer.Inject(zipkintracer.SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 1}, opentracing.Binary, buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.Truncate(buf.Len() - 1)
+	if _, err := tracer.Extract(opentracing.Binary, buf); err != opentracing.ErrSpanContextCorrupted {
+		t.Errorf("truncated payload: want %v, have %v", opentracing.ErrSpanContextCorrupted, err)
+	}
+}
+
+// grpcMD mimics google.golang.org/grpc/metadata.MD.
+type grpcMD map[string][]string
+
+func TestGRPCPropagation(t *testing.T) {
+	tracer, err := zipkintracer.NewTracer(zipkintracer.NewInMemoryRecorder())
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	parentSpanID := uint64(7)
+	sc := zipkintracer.SpanContext{
+		TraceID:      types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a},
+		SpanID:       0x0123456789abcdef,
+		ParentSpanID: &parentSpanID,
+		Sampled:      true,
+		Baggage:      map[string]string{"user": "alice"},
+	}
+
+	md := grpcMD{"x-b3-traceid": []string{"stale"}, "authorization": []string{"token"}}
+	if err := zipkintracer.InjectGRPC(tracer, sc, md); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range md {
+		if k != strings.ToLower(k) {
+			t.Errorf("want lowercase metadata key, have %q", k)
+		}
+		if len(v) != 1 {
+			t.Errorf("%s: want single value, have %v", k, v)
+		}
+	}
+	if want, have := "5759e988bd862e3fe1be023e8ff6d22a", md["x-b3-traceid"][0]; want != have {
+		t.Errorf("trace id: want %q, have %q", want, have)
+	}
+
+	// values appended by other middleware must not shadow ours
+	md["x-b3-sampled"] = append(md["x-b3-sampled"], "0")
+	md["trace-bin"] = []string{"\x00"}
+
+	got, err := zipkintracer.ExtractGRPC(tracer, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := sc.TraceID, got.TraceID; want != have {
+		t.Errorf("trace id: want %+v, have %+v", want, have)
+	}
+	if want, have := sc.SpanID, got.SpanID; want != have {
+		t.Errorf("span id: want %d, have %d", want, have)
+	}
+	if got.ParentSpanID == nil || *got.ParentSpanID != parentSpanID {
+		t.Errorf("parent span id: want %d, have %v", parentSpanID, got.ParentSpanID)
+	}
+	if !got.Sampled {
+		t.Error("sampled: want true, have false")
+	}
+	if want, have := sc.Baggage, got.Baggage; !reflect.DeepEqual(want, have) {
+		t.Errorf("baggage: want %v, have %v", want, have)
+	}
+
+	if _, err := zipkintracer.ExtractGRPC(tracer, grpcMD{"x-b3-traceid": []string{"zz"}, "x-b3-spanid": []string{"1"}}); err != opentracing.ErrSpanContextCorrupted {
+		t.Errorf("corrupted metadata: want %v, have %v", opentracing.ErrSpanContextCorrupted, err)
+	}
+	if err := zipkintracer.InjectGRPC(tracer, sc, nil); err != opentracing.ErrInvalidCarrier {
+		t.Errorf("nil metadata: want %v, have %v", opentracing.ErrInvalidCarrier, err)
+	}
+
+	// the options of the tracer apply
+	tracer, err = zipkintracer.NewTracer(
+		zipkintracer.NewInMemoryRecorder(),
+		zipkintracer.WithBaggagePrefix("x-baggage-"),
+		zipkintracer.WithExtractHook(func(_ interface{}, _ interface{}, sc zipkintracer.SpanContext) zipkintracer.SpanContext {
+			sc.Baggage["hooked"] = "true"
+			return sc
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	md = grpcMD{}
+	if err := zipkintracer.InjectGRPC(tracer, sc, md); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := []string{"alice"}, md["x-baggage-user"]; !reflect.DeepEqual(want, have) {
+		t.Errorf("baggage prefix: want %v, have %v", want, have)
+	}
+	got, err = zipkintracer.ExtractGRPC(tracer, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := map[string]string{"user": "alice", "hooked": "true"}, got.Baggage; !reflect.DeepEqual(want, have) {
+		t.Errorf("baggage: want %v, have %v", want, have)
+	}
+}
+
+func TestB3FlagsPropagation(t *testing.T) {
+	tracer, err := zipkintracer.NewTracer(
+		zipkintracer.NewInMemoryRecorder(),
+		zipkintracer.WithSampler(func(_ uint64) bool { return false }),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	for _, test := range []struct {
+		sampled, flags, want string
+	}{
+		// debug and custom bits survive the hop
+		{"", "81", "81"},
+		{"1", "80", "80"},
+		// the tracer's internal bits are not propagated
+		{"1", "94", "80"},
+		// unsampled spans only pass on the debug flag
+		{"0", "80", "0"},
+	} {
+		header := http.Header{}
+		header.Set("X-B3-TraceId", "0000000000000001")
+		header.Set("X-B3-SpanId", "0000000000000002")
+		if test.sampled != "" {
+			header.Set("X-B3-Sampled", test.sampled)
+		}
+		header.Set("X-B3-Flags", test.flags)
+		spanCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// directly and through a child span
+		span := tracer.StartSpan("span", opentracing.ChildOf(spanCtx))
+		for _, sc := range []opentracing.SpanContext{spanCtx, span.Context()} {
+			out := http.Header{}
+			if err := tracer.Inject(sc, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)); err != nil {
+				t.Fatal(err)
+			}
+			if want, have := test.want, out.Get("X-B3-Flags"); want != have {
+				t.Errorf("flags %s: X-B3-Flags: want %q, have %q", test.flags, want, have)
+			}
+		}
+		span.Finish()
+	}
+}
+
+func TestHTTPRequestPropagation(t *testing.T) {
+	tracer, err := zipkintracer.NewTracer(zipkintracer.NewInMemoryRecorder())
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	parentSpanID := uint64(7)
+	sc := zipkintracer.SpanContext{
+		TraceID:      types.TraceID{High: 0x5759e988bd862e3f, Low: 0xe1be023e8ff6d22a},
+		SpanID:       0x0123456789abcdef,
+		ParentSpanID: &parentSpanID,
+		Sampled:      true,
+		Baggage:      map[string]string{"user": "alice"},
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-B3-TraceId", "stale")
+	if err := zipkintracer.InjectHTTPRequest(tracer, sc, req); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "5759e988bd862e3fe1be023e8ff6d22a", req.Header.Get("X-B3-TraceId"); want != have {
+		t.Errorf("trace id header: want %q, have %q", want, have)
+	}
+
+	got, err := zipkintracer.ExtractHTTPRequest(tracer, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := sc.TraceID, got.TraceID; want != have {
+		t.Errorf("trace id: want %+v, have %+v", want, have)
+	}
+	if want, have := sc.SpanID, got.SpanID; want != have {
+		t.Errorf("span id: want %d, have %d", want, have)
+	}
+	if got.ParentSpanID == nil || *got.ParentSpanID != parentSpanID {
+		t.Errorf("parent span id: want %d, have %v", parentSpanID, got.ParentSpanID)
+	}
+	if !got.Sampled {
+		t.Error("sampled: want true, have false")
+	}
+	if want, have := sc.Baggage, got.Baggage; !reflect.DeepEqual(want, have) {
+		t.Errorf("baggage: want %v, have %v", want, have)
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	if got, err := zipkintracer.ExtractHTTPRequest(tracer, req); err != nil || !got.IsZero() {
+		t.Errorf("no headers: want zero span context, have %+v, %v", got, err)
+	}
+	if err := zipkintracer.InjectHTTPRequest(tracer, sc, nil); err != opentracing.ErrInvalidCarrier {
+		t.Errorf("nil request: want %v, have %v", opentracing.ErrInvalidCarrier, err)
+	}
+
+	// a custom baggage prefix of the tracer applies
+	tracer, err = zipkintracer.NewTracer(
+		zipkintracer.NewInMemoryRecorder(),
+		zipkintracer.WithBaggagePrefix("X-Baggage-"),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	if err := zipkintracer.InjectHTTPRequest(tracer, sc, req); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "alice", req.Header.Get("X-Baggage-User"); want != have {
+		t.Errorf("baggage header: want %q, have %q", want, have)
+	}
+	if have := req.Header.Get("Ot-Baggage-User"); have != "" {
+		t.Errorf("default baggage header: want none, have %q", have)
+	}
+	got, err = zipkintracer.ExtractHTTPRequest(tracer, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := sc.Baggage, got.Baggage; !reflect.DeepEqual(want, have) {
+		t.Errorf("baggage: want %v, have %v", want, have)
+	}
+}
+
 func TestInvalidCarrier(t *testing.T) {
 	recorder := zipkintracer.NewInMemoryRecorder()
 	tracer, err := zipkintracer.NewTracer(
@@ -378,3 +804,202 @@ func TestB3Hex(t *testing.T) {
 		span.Finish()
 	}
 }
+
+func TestContextValidator(t *testing.T) {
+	recorder := zipkintracer.NewInMemoryRecorder()
+	tracer, err := zipkintracer.NewTracer(
+		recorder,
+		zipkintracer.WithContextValidator(func(sc zipkintracer.SpanContext) error {
+			for _, v := range sc.Baggage {
+				if strings.ContainsAny(v, "<>") {
+					return errors.New("suspicious baggage value")
+				}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	for i, tc := range []struct {
+		baggage  string
+		rejected bool
+	}{
+		{baggage: "user-42", rejected: false},
+		{baggage: "<script>alert(1)</script>", rejected: true},
+	} {
+		recorder.Reset()
+		upstream := zipkintracer.SpanContext{
+			TraceID: types.TraceID{Low: 123},
+			SpanID:  456,
+			Sampled: true,
+			Baggage: map[string]string{"user": tc.baggage},
+		}
+		header := http.Header{}
+		if err := tracer.Inject(upstream, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {
+			t.Fatalf("%d: error injecting span context: %v", i, err)
+		}
+		wireContext, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+		if err != nil {
+			t.Fatalf("%d: error extracting span context: %v", i, err)
+		}
+		tracer.StartSpan("server", opentracing.ChildOf(wireContext)).Finish()
+
+		spans := recorder.GetSpans()
+		if want, have := 1, len(spans); want != have {
+			t.Fatalf("%d: want %d spans, have %d", i, want, have)
+		}
+		sc := spans[0].Context
+		if tc.rejected {
+			if sc.TraceID == upstream.TraceID {
+				t.Errorf("%d: expected a new trace, got upstream trace %s", i, sc.TraceID.ToHex())
+			}
+			if sc.ParentSpanID != nil {
+				t.Errorf("%d: expected a root span, got parent %d", i, *sc.ParentSpanID)
+			}
+			if sc.Flags&flag.IsRoot != flag.IsRoot {
+				t.Errorf("%d: expected IsRoot flag to be set", i)
+			}
+			if len(sc.Baggage) != 0 {
+				t.Errorf("%d: expected no baggage, got %v", i, sc.Baggage)
+			}
+			continue
+		}
+		if want, have := upstream.TraceID, sc.TraceID; want != have {
+			t.Errorf("%d: want trace %s, have %s", i, want.ToHex(), have.ToHex())
+		}
+		if sc.ParentSpanID == nil || *sc.ParentSpanID != upstream.SpanID {
+			t.Errorf("%d: expected parent span %d, got %v", i, upstream.SpanID, sc.ParentSpanID)
+		}
+	}
+}
+
+func TestExtractHook(t *testing.T) {
+	neverSample := func(uint64) bool { return false }
+	tracer, err := zipkintracer.NewTracer(
+		zipkintracer.NewInMemoryRecorder(),
+		zipkintracer.WithSampler(neverSample),
+		zipkintracer.WithExtractHook(zipkintracer.DebugHeaderHook("X-Debug")),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		header    http.Header
+		wantDebug bool
+	}{
+		{"unsampled upstream", http.Header{
+			"X-B3-Traceid": []string{"0000000000000001"},
+			"X-B3-Spanid":  []string{"0000000000000002"},
+			"X-B3-Sampled": []string{"0"},
+			"X-Debug":      []string{"1"},
+		}, true},
+		{"without trace state", http.Header{"X-Debug": []string{"1"}}, true},
+		{"disabled", http.Header{"X-Debug": []string{"0"}}, false},
+		{"absent", http.Header{}, false},
+	} {
+		parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(tc.header))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		span := tracer.StartSpan("server", opentracing.ChildOf(parent))
+		sc := span.Context().(zipkintracer.SpanContext)
+		if want, have := tc.wantDebug, sc.Sampled; want != have {
+			t.Errorf("%s: sampled: want %t, have %t", tc.name, want, have)
+		}
+		if want, have := tc.wantDebug, sc.Flags&flag.Debug != 0; want != have {
+			t.Errorf("%s: debug: want %t, have %t", tc.name, want, have)
+		}
+		span.Finish()
+	}
+
+	// hooks receive the format and carrier of the extraction
+	var formats []interface{}
+	tracer, err = zipkintracer.NewTracer(
+		zipkintracer.NewInMemoryRecorder(),
+		zipkintracer.WithExtractHook(func(format, carrier interface{}, sc zipkintracer.SpanContext) zipkintracer.SpanContext {
+			formats = append(formats, format)
+			return sc
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	if _, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier{}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := []interface{}{opentracing.TextMap}, formats; !reflect.DeepEqual(want, have) {
+		t.Errorf("formats: want %v, have %v", want, have)
+	}
+}
+
+func TestBaggageHTTPHeaders(t *testing.T) {
+	for _, prefix := range []string{"", "X-B3-Baggage-"} {
+		var options []zipkintracer.TracerOption
+		wantPrefix := "Ot-Baggage-"
+		if prefix != "" {
+			options = append(options, zipkintracer.WithBaggagePrefix(prefix))
+			wantPrefix = prefix
+		}
+		tracer, err := zipkintracer.NewTracer(zipkintracer.NewInMemoryRecorder(), options...)
+		if err != nil {
+			t.Fatalf("Unable to create Tracer: %+v", err)
+		}
+
+		baggage := map[string]string{
+			"auth-user":    "alice",
+			"tenant:id/v2": "a b%c",
+			"100%":         "done",
+		}
+		sp := tracer.StartSpan("client")
+		for k, v := range baggage {
+			sp.SetBaggageItem(k, v)
+		}
+		header := http.Header{}
+		if err := tracer.Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {
+			t.Fatalf("%q: error injecting span context: %v", prefix, err)
+		}
+		for key, want := range map[string]string{
+			wantPrefix + "Auth-User":        "alice",
+			wantPrefix + "Tenant%3aid%2fv2": "a b%c",
+			wantPrefix + "100%25":           "done",
+		} {
+			if have := header.Get(key); want != have {
+				t.Errorf("%q: header %s: want %q, have %q (%v)", prefix, key, want, have, header)
+			}
+		}
+
+		wireContext, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+		if err != nil {
+			t.Fatalf("%q: error extracting span context: %v", prefix, err)
+		}
+		if want, have := baggage, wireContext.(zipkintracer.SpanContext).Baggage; !reflect.DeepEqual(want, have) {
+			t.Errorf("%q: baggage: want %v, have %v", prefix, want, have)
+		}
+		sp.Finish()
+	}
+
+	// keys which are not percent-encoded are extracted as is
+	tracer, err := zipkintracer.NewTracer(zipkintracer.NewInMemoryRecorder())
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	wireContext, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{
+		"X-B3-Traceid":        {"0000000000000001"},
+		"X-B3-Spanid":         {"0000000000000002"},
+		"Ot-Baggage-Rate-50%": {"raw"},
+	}))
+	if err != nil {
+		t.Fatalf("raw key: error extracting span context: %v", err)
+	}
+	if want, have := map[string]string{"rate-50%": "raw"}, wireContext.(zipkintracer.SpanContext).Baggage; !reflect.DeepEqual(want, have) {
+		t.Errorf("raw key: baggage: want %v, have %v", want, have)
+	}
+
+	if _, err := zipkintracer.NewTracer(nil, zipkintracer.WithBaggagePrefix("")); err == nil {
+		t.Error("expected error for empty baggage prefix")
+	}
+}
@@ -27,4 +27,22 @@ type RawSpan struct {
 
 	// The span's "microlog".
 	Logs []opentracing.LogRecord
+
+	// The references the span was started with besides the one to its
+	// parent, e.g. the FollowsFrom references of a span processing a batch
+	// of messages.
+	Links []SpanLink
+
+	// Partial marks an in-progress update of a span which has not finished
+	// yet, see Flusher. It only holds the logs recorded since the previous
+	// update, and recorders leave out the start time, duration and the
+	// annotations derived from the span kind, which are reported once the
+	// span finishes.
+	Partial bool
+}
+
+// SpanLink is a reference of a span to a span other than its parent.
+type SpanLink struct {
+	Type    opentracing.SpanReferenceType
+	Context SpanContext
 }
@@ -0,0 +1,206 @@
+package zipkintracer
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
+)
+
+// Tags set on the span emitted for a group of aggregated spans.
+const (
+	AggregateCountTag       = "aggregate.count"
+	AggregateMinDurationTag = "aggregate.min_duration"
+	AggregateMaxDurationTag = "aggregate.max_duration"
+	AggregateAvgDurationTag = "aggregate.avg_duration"
+)
+
+// SpanGrouper returns the key under which a span is aggregated with its
+// siblings, or an empty string if the span should be passed on as is.
+type SpanGrouper func(span RawSpan) string
+
+// GroupLocalSpansByPrefix returns a SpanGrouper aggregating local spans, i.e.
+// spans without span.kind tag, whose operation name starts with one of the
+// prefixes. The matching prefix is used as key.
+func GroupLocalSpansByPrefix(prefixes ...string) SpanGrouper {
+	return func(span RawSpan) string {
+		if _, ok := span.Tags[string(otext.SpanKind)]; ok {
+			return ""
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(span.Operation, prefix) {
+				return prefix
+			}
+		}
+		return ""
+	}
+}
+
+type aggregateKey struct {
+	traceID  types.TraceID
+	parentID uint64
+	group    string
+}
+
+type spanAggregate struct {
+	first    RawSpan
+	count    int
+	end      time.Time
+	min, max time.Duration
+	total    time.Duration
+}
+
+// AggregatingRecorder is a SpanRecorder which coalesces sibling spans of the
+// same group within a trace into a single span carrying the count and the
+// minimum, maximum and average duration of its members. This reduces the
+// volume of chatty internal call chains.
+//
+// A group is passed on to the wrapped SpanRecorder once its parent span is
+// recorded. Groups whose parent is not recorded by this process, e.g. children
+// of a remote parent, are only passed on by Flush.
+type AggregatingRecorder struct {
+	next  SpanRecorder
+	group SpanGrouper
+
+	mu         sync.Mutex
+	aggregates map[aggregateKey]*spanAggregate
+	byParent   map[uint64][]aggregateKey
+}
+
+// NewAggregatingRecorder creates an AggregatingRecorder wrapping next which
+// aggregates spans by the key returned from group.
+func NewAggregatingRecorder(next SpanRecorder, group SpanGrouper) *AggregatingRecorder {
+	return &AggregatingRecorder{
+		next:       next,
+		group:      group,
+		aggregates: make(map[aggregateKey]*spanAggregate),
+		byParent:   make(map[uint64][]aggregateKey),
+	}
+}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (r *AggregatingRecorder) RecordSpan(span RawSpan) {
+	if span.Partial {
+		// in-progress updates neither complete groups nor join them.
+		r.next.RecordSpan(span)
+		return
+	}
+	if span.Context.ParentSpanID != nil {
+		if group := r.group(span); group != "" {
+			r.add(aggregateKey{
+				traceID:  span.Context.TraceID,
+				parentID: *span.Context.ParentSpanID,
+				group:    group,
+			}, span)
+			return
+		}
+	}
+
+	// children finish before their parent, so the groups below this span are
+	// complete now.
+	r.mu.Lock()
+	keys := r.byParent[span.Context.SpanID]
+	delete(r.byParent, span.Context.SpanID)
+	aggregates := r.take(keys, span.Context.TraceID)
+	r.mu.Unlock()
+
+	for _, a := range aggregates {
+		r.next.RecordSpan(a.span())
+	}
+	r.next.RecordSpan(span)
+}
+
+// Flush passes all pending groups on to the wrapped SpanRecorder.
+func (r *AggregatingRecorder) Flush() {
+	r.mu.Lock()
+	aggregates := make([]*spanAggregate, 0, len(r.aggregates))
+	for _, a := range r.aggregates {
+		aggregates = append(aggregates, a)
+	}
+	r.aggregates = make(map[aggregateKey]*spanAggregate)
+	r.byParent = make(map[uint64][]aggregateKey)
+	r.mu.Unlock()
+
+	for _, a := range aggregates {
+		r.next.RecordSpan(a.span())
+	}
+}
+
+func (r *AggregatingRecorder) add(key aggregateKey, span RawSpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	end := span.Start.Add(span.Duration)
+	a, ok := r.aggregates[key]
+	if !ok {
+		r.aggregates[key] = &spanAggregate{
+			first: span,
+			count: 1,
+			end:   end,
+			min:   span.Duration,
+			max:   span.Duration,
+			total: span.Duration,
+		}
+		r.byParent[key.parentID] = append(r.byParent[key.parentID], key)
+		return
+	}
+	a.count++
+	a.total += span.Duration
+	if span.Duration < a.min {
+		a.min = span.Duration
+	}
+	if span.Duration > a.max {
+		a.max = span.Duration
+	}
+	if span.Start.Before(a.first.Start) {
+		a.first.Start = span.Start
+	}
+	if end.After(a.end) {
+		a.end = end
+	}
+}
+
+// take removes the groups of keys belonging to traceID. Span IDs are only
+// unique within a trace, so groups of other traces are kept.
+func (r *AggregatingRecorder) take(keys []aggregateKey, traceID types.TraceID) []*spanAggregate {
+	var (
+		aggregates []*spanAggregate
+		remaining  []aggregateKey
+	)
+	for _, key := range keys {
+		if key.traceID != traceID {
+			remaining = append(remaining, key)
+			continue
+		}
+		aggregates = append(aggregates, r.aggregates[key])
+		delete(r.aggregates, key)
+	}
+	if len(remaining) > 0 {
+		r.byParent[keys[0].parentID] = remaining
+	}
+	return aggregates
+}
+
+// span returns the span representing the group. A group of one is passed on
+// unchanged. Otherwise the identity and operation name of the first member are
+// kept while the span covers the time from the earliest start to the latest
+// finish.
+func (a *spanAggregate) span() RawSpan {
+	if a.count == 1 {
+		return a.first
+	}
+	span := a.first
+	span.Duration = a.end.Sub(span.Start)
+	span.Logs = nil
+	span.Tags = opentracing.Tags{
+		AggregateCountTag:       a.count,
+		AggregateMinDurationTag: a.min.String(),
+		AggregateMaxDurationTag: a.max.String(),
+		AggregateAvgDurationTag: (a.total / time.Duration(a.count)).String(),
+	}
+	return span
+}
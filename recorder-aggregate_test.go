@@ -0,0 +1,106 @@
+package zipkintracer
+
+import (
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func TestAggregatingRecorder(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	aggregator := NewAggregatingRecorder(recorder, GroupLocalSpansByPrefix("cache."))
+	tracer, err := NewTracer(aggregator, WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	start := time.Now()
+	root := tracer.StartSpan("root", opentracing.StartTime(start))
+	const n = 10
+	for i := 1; i <= n; i++ {
+		child := tracer.StartSpan("cache.get",
+			opentracing.ChildOf(root.Context()),
+			opentracing.StartTime(start.Add(time.Duration(i)*time.Second)),
+		)
+		child.FinishWithOptions(opentracing.FinishOptions{
+			FinishTime: start.Add(time.Duration(i)*time.Second + time.Duration(i)*time.Millisecond),
+		})
+	}
+	// spans outside the group and remote calls pass unchanged
+	tracer.StartSpan("db.query", opentracing.ChildOf(root.Context())).Finish()
+	tracer.StartSpan("cache.remote", opentracing.ChildOf(root.Context()), ext.SpanKindRPCClient).Finish()
+
+	if want, have := 2, len(recorder.GetSpans()); want != have {
+		t.Fatalf("before parent finished: want %d spans, have %d", want, have)
+	}
+	root.Finish()
+
+	spans := recorder.GetSpans()
+	if want, have := 4, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	aggregate := spans[2]
+	if want, have := "cache.get", aggregate.Operation; want != have {
+		t.Fatalf("want aggregate %q before parent, have %q", want, have)
+	}
+	if want, have := root.Context().(SpanContext).SpanID, *aggregate.Context.ParentSpanID; want != have {
+		t.Errorf("parent span id: want %d, have %d", want, have)
+	}
+	for key, want := range map[string]interface{}{
+		AggregateCountTag:       n,
+		AggregateMinDurationTag: "1ms",
+		AggregateMaxDurationTag: "10ms",
+		AggregateAvgDurationTag: "5.5ms",
+	} {
+		if have := aggregate.Tags[key]; want != have {
+			t.Errorf("%s: want %v, have %v", key, want, have)
+		}
+	}
+	if want, have := start.Add(time.Second), aggregate.Start; !want.Equal(have) {
+		t.Errorf("start: want %s, have %s", want, have)
+	}
+	if want, have := 9*time.Second+10*time.Millisecond, aggregate.Duration; want != have {
+		t.Errorf("duration: want %s, have %s", want, have)
+	}
+	if want, have := "root", spans[3].Operation; want != have {
+		t.Errorf("want parent %q last, have %q", want, have)
+	}
+}
+
+func TestAggregatingRecorderFlush(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	aggregator := NewAggregatingRecorder(recorder, GroupLocalSpansByPrefix("cache.get", "cache.put"))
+	tracer, err := NewTracer(aggregator, WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	// the parent lives in another process
+	remote := SpanContext{TraceID: tracer.StartSpan("x").Context().(SpanContext).TraceID, SpanID: 1, Sampled: true}
+	for i := 0; i < 3; i++ {
+		tracer.StartSpan("cache.get", opentracing.ChildOf(remote)).Finish()
+	}
+	// a single member is passed on as is
+	tracer.StartSpan("cache.put", opentracing.ChildOf(remote)).Finish()
+	if want, have := 0, len(recorder.GetSpans()); want != have {
+		t.Fatalf("before flush: want %d spans, have %d", want, have)
+	}
+
+	aggregator.Flush()
+	spans := recorder.GetSpans()
+	if want, have := 2, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	counts := map[string]interface{}{}
+	for _, span := range spans {
+		counts[span.Operation] = span.Tags[AggregateCountTag]
+	}
+	if want, have := 3, counts["cache.get"]; want != have {
+		t.Errorf("cache.get count: want %v, have %v", want, have)
+	}
+	if have := counts["cache.put"]; have != nil {
+		t.Errorf("cache.put count: want none, have %v", have)
+	}
+}
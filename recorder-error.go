@@ -0,0 +1,50 @@
+package zipkintracer
+
+import (
+	otext "github.com/opentracing/opentracing-go/ext"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/flag"
+)
+
+// ErrorForcingRecorder is a SpanRecorder which marks unsampled spans carrying
+// an error as sampled and debug before passing them on to the wrapped
+// SpanRecorder, so errors are retained regardless of the sampling rate. A span
+// carries an error if it has an error tag set to true or a log following the
+// OpenTracing error conventions.
+//
+// As the error is only known once a span finishes, the decision is made at
+// record time and only rescues the errored span itself. Other spans of the
+// trace, e.g. its parent or spans in other processes, remain unsampled. The
+// error must be visible at record time as well: with TrimUnsampledSpans the
+// tags and logs of unsampled spans are discarded and nothing can be rescued.
+type ErrorForcingRecorder struct {
+	next SpanRecorder
+}
+
+// NewErrorForcingRecorder creates an ErrorForcingRecorder wrapping next.
+func NewErrorForcingRecorder(next SpanRecorder) *ErrorForcingRecorder {
+	return &ErrorForcingRecorder{next: next}
+}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (r *ErrorForcingRecorder) RecordSpan(span RawSpan) {
+	if !span.Context.Sampled && spanHasError(span) {
+		span.Context.Sampled = true
+		span.Context.Flags |= flag.Debug | flag.SamplingSet | flag.Sampled
+	}
+	r.next.RecordSpan(span)
+}
+
+// spanHasError reports whether the span has an error tag set to true or an
+// error log.
+func spanHasError(span RawSpan) bool {
+	if value, ok := span.Tags[string(otext.Error)]; ok && (value == true || value == "true") {
+		return true
+	}
+	for _, spLog := range span.Logs {
+		if _, ok := logErrorMessage(spLog.Fields); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package zipkintracer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+func TestErrorForcingRecorder(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewErrorForcingRecorder(NewJSONRecorder(c, false, "0.0.0.0:0", "svc")),
+		WithSampler(func(uint64) bool { return false }),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	tracer.StartSpan("clean").Finish()
+
+	span := tracer.StartSpan("tagged")
+	ext.Error.Set(span, true)
+	span.Finish()
+
+	span = tracer.StartSpan("logged")
+	span.LogFields(log.Error(errors.New("boom")))
+	span.Finish()
+
+	span = tracer.StartSpan("not an error")
+	span.SetTag(string(ext.Error), false)
+	span.Finish()
+
+	var have []string
+	for _, span := range c.spans {
+		have = append(have, span.Name)
+		if !span.Debug {
+			t.Errorf("%s: want debug span", span.Name)
+		}
+	}
+	if want := []string{"tagged", "logged"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("exported spans: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,58 @@
+package zipkintracer
+
+import (
+	"regexp"
+
+	otext "github.com/opentracing/opentracing-go/ext"
+)
+
+// FilterRecorder is a SpanRecorder which only passes spans on to the wrapped
+// SpanRecorder if its keep predicate returns true.
+type FilterRecorder struct {
+	next SpanRecorder
+	keep func(RawSpan) bool
+}
+
+// NewFilterRecorder creates a FilterRecorder wrapping next. Spans for which
+// keep returns false are dropped. This allows for filtering by e.g. duration,
+// operation name or tags before spans reach the collector.
+func NewFilterRecorder(next SpanRecorder, keep func(RawSpan) bool) *FilterRecorder {
+	return &FilterRecorder{
+		next: next,
+		keep: keep,
+	}
+}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (r *FilterRecorder) RecordSpan(span RawSpan) {
+	if r.keep(span) {
+		r.next.RecordSpan(span)
+	}
+}
+
+// NewURLFilterRecorder creates a FilterRecorder which drops spans with an
+// http.url tag matching one of the exclude patterns, e.g. health check and
+// metrics endpoints. The exclude patterns are regular expressions.
+//
+// As the http.url tag is typically set after a span has started, filtering is
+// done at record time instead of by a Sampler.
+func NewURLFilterRecorder(next SpanRecorder, excludePatterns []string) (*FilterRecorder, error) {
+	exclude := make([]*regexp.Regexp, 0, len(excludePatterns))
+	for _, pattern := range excludePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		exclude = append(exclude, re)
+	}
+	return NewFilterRecorder(next, func(span RawSpan) bool {
+		if url, ok := span.Tags[string(otext.HTTPUrl)].(string); ok {
+			for _, re := range exclude {
+				if re.MatchString(url) {
+					return false
+				}
+			}
+		}
+		return true
+	}), nil
+}
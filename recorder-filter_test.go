@@ -0,0 +1,79 @@
+package zipkintracer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func TestURLFilterRecorder(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	filter, err := NewURLFilterRecorder(recorder, []string{`/healthz$`, `^https?://[^/]+/metrics`})
+	if err != nil {
+		t.Fatalf("Unable to create URLFilterRecorder: %+v", err)
+	}
+	tracer, err := NewTracer(filter, WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	for _, url := range []string{
+		"http://10.0.0.1:8080/healthz",
+		"http://10.0.0.1:8080/metrics",
+		"http://10.0.0.1:8080/api/orders",
+		"http://10.0.0.1:8080/api/healthz/history",
+	} {
+		span := tracer.StartSpan("GET", ext.SpanKindRPCServer)
+		ext.HTTPUrl.Set(span, url)
+		span.Finish()
+	}
+	// spans without http.url tag pass
+	tracer.StartSpan("internal").Finish()
+
+	var have []interface{}
+	for _, span := range recorder.GetSpans() {
+		have = append(have, span.Tags[string(ext.HTTPUrl)])
+	}
+	want := []interface{}{
+		"http://10.0.0.1:8080/api/orders",
+		"http://10.0.0.1:8080/api/healthz/history",
+		nil,
+	}
+	if len(want) != len(have) {
+		t.Fatalf("recorded spans: want %v, have %v", want, have)
+	}
+	for i := range want {
+		if want[i] != have[i] {
+			t.Errorf("recorded span %d: want %v, have %v", i, want[i], have[i])
+		}
+	}
+
+	if _, err := NewURLFilterRecorder(recorder, []string{"("}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestFilterRecorder(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	filter := NewFilterRecorder(recorder, func(span RawSpan) bool {
+		return span.Duration >= time.Millisecond
+	})
+
+	now := time.Now()
+	for _, d := range []time.Duration{
+		time.Microsecond, 999 * time.Microsecond, time.Millisecond, time.Second,
+	} {
+		filter.RecordSpan(RawSpan{Operation: d.String(), Start: now, Duration: d})
+	}
+
+	spans := recorder.GetSpans()
+	if want, have := 2, len(spans); want != have {
+		t.Fatalf("recorded spans: want %d, have %d", want, have)
+	}
+	for i, want := range []string{"1ms", "1s"} {
+		if have := spans[i].Operation; want != have {
+			t.Errorf("recorded span %d: want %s, have %s", i, want, have)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package zipkintracer
+
+// MultiFormatRecorder is a SpanRecorder passing every span on to two
+// SpanRecorders, typically encoding spans in different formats for different
+// backends, e.g. while migrating from the Zipkin v1 to the v2 JSON model.
+// Unlike a collector fanning out encoded spans, each wrapped SpanRecorder
+// converts the span on its own.
+//
+// Both SpanRecorders receive the same RawSpan, including its tag map, and must
+// not modify it.
+type MultiFormatRecorder struct {
+	v1, v2 SpanRecorder
+}
+
+// NewMultiFormatRecorder creates a MultiFormatRecorder passing spans on to v1
+// first and v2 second.
+func NewMultiFormatRecorder(v1, v2 SpanRecorder) *MultiFormatRecorder {
+	return &MultiFormatRecorder{v1: v1, v2: v2}
+}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (r *MultiFormatRecorder) RecordSpan(span RawSpan) {
+	r.v1.RecordSpan(span)
+	r.v2.RecordSpan(span)
+}
@@ -0,0 +1,89 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+)
+
+func TestMultiFormatRecorder(t *testing.T) {
+	v1Spans := make(chan []*CoreSpan, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []*CoreSpan
+		if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+			t.Error(err)
+		}
+		v1Spans <- spans
+	}))
+	defer server.Close()
+	v1Collector, err := NewJSONHTTPCollector(server.URL, JSONHTTPSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v1Collector.Close()
+
+	conn := listenUDP(t)
+	defer conn.Close()
+	v2Collector, err := NewUDPCollector(conn.LocalAddr().String(), UDPJSONV2())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v2Collector.Close()
+
+	recorder := NewMultiFormatRecorder(
+		NewJSONRecorder(v1Collector, false, "10.0.0.1:80", "svc"),
+		NewJSONRecorder(v2Collector, false, "10.0.0.1:80", "svc"),
+	)
+	tracer, err := NewTracer(recorder, WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	span := tracer.StartSpan("get", otext.SpanKindRPCServer, opentracing.Tag{Key: "key", Value: "value"})
+	span.Finish()
+
+	v1 := <-v1Spans
+	if want, have := 1, len(v1); want != have {
+		t.Fatalf("v1 spans: want %d, have %d", want, have)
+	}
+	var values []string
+	for _, annotation := range v1[0].Annotations {
+		values = append(values, annotation.Value)
+	}
+	if want, have := []string{zipkincore.SERVER_RECV, zipkincore.SERVER_SEND}, values; !reflect.DeepEqual(want, have) {
+		t.Errorf("v1 annotations: want %v, have %v", want, have)
+	}
+	if want, have := 1, len(v1[0].BinaryAnnotations); want != have {
+		t.Fatalf("v1 binary annotations: want %d, have %d", want, have)
+	}
+	if want, have := (CoreBinaryAnnotation{Key: "key", Value: "value", Endpoint: CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "svc"}}), *v1[0].BinaryAnnotations[0]; want != have {
+		t.Errorf("v1 binary annotation: want %+v, have %+v", want, have)
+	}
+
+	var v2 []*CoreSpanV2
+	if err := json.Unmarshal(readDatagram(t, conn), &v2); err != nil {
+		t.Fatalf("unable to decode v2 spans: %+v", err)
+	}
+	if want, have := 1, len(v2); want != have {
+		t.Fatalf("v2 spans: want %d, have %d", want, have)
+	}
+	if want, have := v1[0].ID, v2[0].ID; want != have {
+		t.Errorf("v2 id: want %s, have %s", want, have)
+	}
+	// the span kind tag was not consumed by the first recorder
+	if want, have := "SERVER", v2[0].Kind; want != have {
+		t.Errorf("v2 kind: want %q, have %q", want, have)
+	}
+	if want, have := "value", v2[0].Tags["key"]; want != have {
+		t.Errorf("v2 tag: want %q, have %q", want, have)
+	}
+	if want, have := 1, len(v2[0].Tags); want != have {
+		t.Errorf("v2 tags: want %d, have %v", want, v2[0].Tags)
+	}
+}
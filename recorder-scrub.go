@@ -0,0 +1,92 @@
+package zipkintracer
+
+import (
+	"regexp"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// ScrubbedValue replaces the sensitive parts of scrubbed tag and log values.
+const ScrubbedValue = "***"
+
+// ScrubbingRecorder is a SpanRecorder which redacts sensitive tag and log
+// field values before passing spans on to the wrapped SpanRecorder.
+type ScrubbingRecorder struct {
+	next  SpanRecorder
+	rules map[string]*regexp.Regexp
+}
+
+// NewScrubbingRecorder creates a ScrubbingRecorder wrapping next. For every
+// tag and log field with a key found in rules, the parts of its string value
+// matching the rule's pattern are replaced by ScrubbedValue. Values of other
+// types are passed as is.
+func NewScrubbingRecorder(next SpanRecorder, rules map[string]*regexp.Regexp) *ScrubbingRecorder {
+	return &ScrubbingRecorder{
+		next:  next,
+		rules: rules,
+	}
+}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (r *ScrubbingRecorder) RecordSpan(span RawSpan) {
+	// The tags map and logs slice are shared with the span and possibly other
+	// recorders. Copy on first modification.
+	var tags opentracing.Tags
+	for key, value := range span.Tags {
+		scrubbed, ok := r.scrub(key, value)
+		if !ok {
+			continue
+		}
+		if tags == nil {
+			tags = make(opentracing.Tags, len(span.Tags))
+			for k, v := range span.Tags {
+				tags[k] = v
+			}
+		}
+		tags[key] = scrubbed
+	}
+	if tags != nil {
+		span.Tags = tags
+	}
+
+	var logs []opentracing.LogRecord
+	for i, record := range span.Logs {
+		var fields []log.Field
+		for j, field := range record.Fields {
+			scrubbed, ok := r.scrub(field.Key(), field.Value())
+			if !ok {
+				continue
+			}
+			if fields == nil {
+				fields = append([]log.Field(nil), record.Fields...)
+			}
+			fields[j] = log.String(field.Key(), scrubbed)
+		}
+		if fields == nil {
+			continue
+		}
+		if logs == nil {
+			logs = append([]opentracing.LogRecord(nil), span.Logs...)
+		}
+		logs[i].Fields = fields
+	}
+	if logs != nil {
+		span.Logs = logs
+	}
+
+	r.next.RecordSpan(span)
+}
+
+// scrub returns the scrubbed value and true if value needs to be redacted.
+func (r *ScrubbingRecorder) scrub(key string, value interface{}) (string, bool) {
+	re, ok := r.rules[key]
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	if !ok || !re.MatchString(s) {
+		return "", false
+	}
+	return re.ReplaceAllLiteralString(s, ScrubbedValue), true
+}
@@ -0,0 +1,63 @@
+package zipkintracer
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+func TestScrubbingRecorder(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	scrubber := NewScrubbingRecorder(recorder, map[string]*regexp.Regexp{
+		"Authorization": regexp.MustCompile(`.+`),
+		"db.statement":  regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.]+`),
+	})
+
+	tags := opentracing.Tags{
+		"Authorization": "Bearer s3cr3t",
+		"db.statement":  "SELECT * FROM users WHERE email = 'jane.doe@example.com'",
+		"db.type":       "sql",
+		"http.status":   200,
+	}
+	fields := []log.Field{
+		log.String("db.statement", "UPDATE users SET email = 'j@example.org'"),
+		log.Int("rows", 1),
+	}
+	scrubber.RecordSpan(RawSpan{
+		Operation: "query",
+		Tags:      tags,
+		Logs:      []opentracing.LogRecord{{Fields: fields}},
+	})
+
+	spans := recorder.GetSpans()
+	if want, have := 1, len(spans); want != have {
+		t.Fatalf("recorded spans: want %d, have %d", want, have)
+	}
+	wantTags := opentracing.Tags{
+		"Authorization": "***",
+		"db.statement":  "SELECT * FROM users WHERE email = '***'",
+		"db.type":       "sql",
+		"http.status":   200,
+	}
+	if have := spans[0].Tags; !reflect.DeepEqual(wantTags, have) {
+		t.Errorf("tags: want %v, have %v", wantTags, have)
+	}
+	logFields := spans[0].Logs[0].Fields
+	if want, have := "UPDATE users SET email = '***'", logFields[0].Value(); want != have {
+		t.Errorf("log field: want %q, have %q", want, have)
+	}
+	if want, have := 1, logFields[1].Value(); want != have {
+		t.Errorf("log field: want %v, have %v", want, have)
+	}
+
+	// the span's own tags and logs must be left untouched
+	if want, have := "Bearer s3cr3t", tags["Authorization"]; want != have {
+		t.Errorf("original tag modified: want %q, have %q", want, have)
+	}
+	if want, have := "UPDATE users SET email = 'j@example.org'", fields[0].Value(); want != have {
+		t.Errorf("original log field modified: want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,67 @@
+package zipkintracer
+
+import "sync"
+
+// SwitchableRecorder is a SpanRecorder passing spans on to a SpanRecorder
+// which can be replaced at runtime, e.g. to migrate to another collector
+// without losing spans.
+type SwitchableRecorder struct {
+	swapMu sync.Mutex // serializes Swap
+
+	mu       sync.Mutex
+	current  SpanRecorder
+	swapping bool
+	buffer   []RawSpan
+	inFlight sync.WaitGroup
+}
+
+// NewSwitchableRecorder creates a SwitchableRecorder initially passing spans on
+// to initial.
+func NewSwitchableRecorder(initial SpanRecorder) *SwitchableRecorder {
+	return &SwitchableRecorder{current: initial}
+}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (r *SwitchableRecorder) RecordSpan(span RawSpan) {
+	r.mu.Lock()
+	if r.swapping {
+		r.buffer = append(r.buffer, span)
+		r.mu.Unlock()
+		return
+	}
+	current := r.current
+	r.inFlight.Add(1)
+	r.mu.Unlock()
+
+	defer r.inFlight.Done()
+	current.RecordSpan(span)
+}
+
+// Swap redirects all future spans to next and returns the previous
+// SpanRecorder. Spans recorded while the previous SpanRecorder is still busy
+// with earlier spans are buffered and replayed to next. Once Swap returns the
+// previous SpanRecorder receives no more spans and can be shut down.
+func (r *SwitchableRecorder) Swap(next SpanRecorder) SpanRecorder {
+	r.swapMu.Lock()
+	defer r.swapMu.Unlock()
+
+	r.mu.Lock()
+	r.swapping = true
+	r.mu.Unlock()
+
+	// no new spans are handed to the previous recorder while swapping.
+	r.inFlight.Wait()
+
+	r.mu.Lock()
+	previous := r.current
+	r.current = next
+	buffered := r.buffer
+	r.buffer = nil
+	r.swapping = false
+	r.mu.Unlock()
+
+	for _, span := range buffered {
+		next.RecordSpan(span)
+	}
+	return previous
+}
@@ -0,0 +1,71 @@
+package zipkintracer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowRecorder delays every span before recording it.
+type slowRecorder struct {
+	*InMemorySpanRecorder
+	delay time.Duration
+}
+
+func (r slowRecorder) RecordSpan(span RawSpan) {
+	time.Sleep(r.delay)
+	r.InMemorySpanRecorder.RecordSpan(span)
+}
+
+func TestSwitchableRecorder(t *testing.T) {
+	var (
+		first  = NewInMemoryRecorder()
+		second = NewInMemoryRecorder()
+		r      = NewSwitchableRecorder(slowRecorder{first, time.Millisecond})
+	)
+
+	const (
+		goroutines = 8
+		spans      = 50
+	)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < spans; i++ {
+				r.RecordSpan(RawSpan{Context: SpanContext{SpanID: uint64(g*spans + i + 1)}})
+			}
+		}(g)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	previous := r.Swap(second)
+	if _, ok := previous.(slowRecorder); !ok {
+		t.Errorf("want previous recorder returned, have %T", previous)
+	}
+	// the previous recorder receives no spans after the swap
+	recordedBefore := len(first.GetSpans())
+	wg.Wait()
+	if want, have := recordedBefore, len(first.GetSpans()); want != have {
+		t.Errorf("spans recorded after swap: want %d, have %d", want, have)
+	}
+
+	seen := make(map[uint64]int)
+	for _, recorder := range []*InMemorySpanRecorder{first, second} {
+		for _, span := range recorder.GetSpans() {
+			seen[span.Context.SpanID]++
+		}
+	}
+	if want, have := goroutines*spans, len(seen); want != have {
+		t.Errorf("recorded spans: want %d, have %d", want, have)
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("span %d recorded %d times", id, count)
+		}
+	}
+	if len(first.GetSpans()) == 0 || len(second.GetSpans()) == 0 {
+		t.Errorf("want spans in both recorders, have %d and %d", len(first.GetSpans()), len(second.GetSpans()))
+	}
+}
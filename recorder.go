@@ -10,9 +10,19 @@ type SpanRecorder interface {
 	RecordSpan(span RawSpan)
 }
 
+// NopSpanRecorder implements SpanRecorder but discards all spans. Tracers using
+// it still create and propagate span contexts, which makes it suitable for
+// disabling the export of spans without changing instrumented code.
+type NopSpanRecorder struct{}
+
+// RecordSpan implements the respective method of SpanRecorder.
+func (NopSpanRecorder) RecordSpan(RawSpan) {}
+
 // InMemorySpanRecorder is a simple thread-safe implementation of
 // SpanRecorder that stores all reported spans in memory, accessible
-// via reporter.GetSpans(). It is primarily intended for testing purposes.
+// via reporter.GetSpans(). Spans are recorded synchronously when finished, so
+// they can be read back in finishing order right after the code under test
+// returns. It is primarily intended for testing purposes.
 type InMemorySpanRecorder struct {
 	sync.RWMutex
 	spans []RawSpan
@@ -1,10 +1,14 @@
 package zipkintracer
 
 import (
+	"fmt"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,6 +26,118 @@ func TestInMemoryRecorderSpans(t *testing.T) {
 	assert.Equal(t, []RawSpan{}, recorder.GetSampledSpans())
 }
 
+func TestInMemoryRecorderTracer(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	sampled := true
+	tracer, err := NewTracer(
+		recorder,
+		WithSampler(func(uint64) bool { return sampled }),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	root := tracer.StartSpan("root")
+	for i := 0; i < 3; i++ {
+		child := tracer.StartSpan(fmt.Sprintf("child-%d", i), opentracing.ChildOf(root.Context()))
+		child.SetTag("index", i)
+		child.Finish()
+	}
+	root.Finish()
+	sampled = false
+	tracer.StartSpan("unsampled").Finish()
+
+	// spans are available as soon as they are finished, in finishing order
+	spans := recorder.GetSpans()
+	var operations []string
+	for _, span := range spans {
+		operations = append(operations, span.Operation)
+	}
+	assert.Equal(t, []string{"child-0", "child-1", "child-2", "root", "unsampled"}, operations)
+	for i, span := range spans[:3] {
+		assert.Equal(t, root.Context().(SpanContext).SpanID, *span.Context.ParentSpanID)
+		assert.Equal(t, opentracing.Tags{"index": i}, span.Tags)
+	}
+
+	sampledSpans := recorder.GetSampledSpans()
+	assert.Len(t, sampledSpans, 4)
+	assert.Equal(t, spans[:4], sampledSpans)
+
+	// the returned slices are copies
+	spans[0].Operation = "changed"
+	assert.Equal(t, "child-0", recorder.GetSpans()[0].Operation)
+
+	recorder.Reset()
+	assert.Empty(t, recorder.GetSpans())
+	tracer.StartSpan("after-reset").Finish()
+	assert.Equal(t, "after-reset", recorder.GetSpans()[0].Operation)
+}
+
+func TestInMemoryRecorderConcurrency(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(recorder, WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tracer.StartSpan("span").Finish()
+				recorder.GetSpans()
+				recorder.GetSampledSpans()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, recorder.GetSpans(), 1000)
+}
+
+func TestNopRecorders(t *testing.T) {
+	var (
+		_ SpanRecorder      = NopSpanRecorder{}
+		_ Collector         = NopCollector{}
+		_ AgnosticCollector = NopAgnosticCollector{}
+	)
+
+	for _, recorder := range []SpanRecorder{
+		NopSpanRecorder{},
+		NewRecorder(NopCollector{}, false, "10.0.0.1:80", "svc"),
+		NewJSONRecorder(NopAgnosticCollector{}, false, "10.0.0.1:80", "svc"),
+	} {
+		tracer, err := NewTracer(recorder, WithLogger(&nopLogger{}))
+		if err != nil {
+			t.Fatalf("Unable to create Tracer: %+v", err)
+		}
+		parent := tracer.StartSpan("parent")
+		parent.SetTag("key", "value")
+		parent.LogFields(log.String("event", "log"))
+
+		// contexts are still created and propagated
+		carrier := opentracing.TextMapCarrier{}
+		if err := tracer.Inject(parent.Context(), opentracing.TextMap, carrier); err != nil {
+			t.Fatal(err)
+		}
+		extracted, err := tracer.Extract(opentracing.TextMap, carrier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		child := tracer.StartSpan("child", opentracing.ChildOf(extracted))
+		assert.Equal(t, parent.Context().(SpanContext).TraceID, child.Context().(SpanContext).TraceID)
+		assert.NotZero(t, child.Context().(SpanContext).SpanID)
+		child.Finish()
+		parent.Finish()
+	}
+
+	assert.NoError(t, NopCollector{}.Close())
+	assert.NoError(t, NopAgnosticCollector{}.Collect(&CoreSpan{}))
+	assert.NoError(t, NopAgnosticCollector{}.Close())
+}
+
 type CountingRecorder int32
 
 func (c *CountingRecorder) RecordSpan(r RawSpan) {
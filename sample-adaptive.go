@@ -0,0 +1,161 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingRateSource returns the sampling rate currently desired by the
+// backend, between 0 and 1.
+type SamplingRateSource func() (float64, error)
+
+// HTTPSamplingRateSource returns a SamplingRateSource fetching the rate from a
+// configuration endpoint, e.g. "http://zipkin:9411/config/sampling", which
+// responds with a JSON document of the form {"sampleRate": 0.1}. A nil client
+// uses http.DefaultClient.
+func HTTPSamplingRateSource(url string, client *http.Client) SamplingRateSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func() (float64, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		var config struct {
+			SampleRate *float64 `json:"sampleRate"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+			return 0, err
+		}
+		if config.SampleRate == nil {
+			return 0, errors.New("missing sampleRate")
+		}
+		return *config.SampleRate, nil
+	}
+}
+
+// AdaptiveSampler samples a fraction of traces which can be changed at
+// runtime, either through SetRate or by polling a SamplingRateSource. Like
+// NewDeterministicSampler it bases its decision on the trace id. Pass its
+// Sample method to WithSampler.
+type AdaptiveSampler struct {
+	boundary uint64 // accessed atomically
+	rate     atomic.Value
+	logger   Logger
+	source   SamplingRateSource
+	interval time.Duration
+	backlog  func() float64
+	quit     chan struct{}
+	done     sync.WaitGroup
+	close    sync.Once
+}
+
+// AdaptiveSamplerOption sets a parameter for the AdaptiveSampler
+type AdaptiveSamplerOption func(s *AdaptiveSampler)
+
+// AdaptiveSamplerPoll makes the sampler fetch its rate from source every
+// interval. Failed polls keep the current rate.
+func AdaptiveSamplerPoll(source SamplingRateSource, interval time.Duration) AdaptiveSamplerOption {
+	return func(s *AdaptiveSampler) {
+		s.source = source
+		s.interval = interval
+	}
+}
+
+// AdaptiveSamplerBackpressure scales the sampling rate down while the
+// collector is saturated, as spans sampled while its backlog is full are
+// disposed anyway. saturation reports the fill level of the backlog between 0
+// and 1, typically the Saturation method of a Saturater collector. The rate is
+// scaled by 1 - saturation, so no traces are sampled while the backlog is full.
+func AdaptiveSamplerBackpressure(saturation func() float64) AdaptiveSamplerOption {
+	return func(s *AdaptiveSampler) { s.backlog = saturation }
+}
+
+// AdaptiveSamplerLogger sets the logger used to report failed polls. By
+// default, a no-op logger is used.
+func AdaptiveSamplerLogger(logger Logger) AdaptiveSamplerOption {
+	return func(s *AdaptiveSampler) { s.logger = logger }
+}
+
+// NewAdaptiveSampler returns an AdaptiveSampler initially sampling at rate.
+// Call Close to stop polling.
+func NewAdaptiveSampler(rate float64, options ...AdaptiveSamplerOption) *AdaptiveSampler {
+	s := &AdaptiveSampler{
+		logger: NewNopLogger(),
+		quit:   make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.SetRate(rate)
+	if s.source != nil && s.interval > 0 {
+		s.done.Add(1)
+		go s.poll()
+	}
+	return s
+}
+
+// Sample implements Sampler.
+func (s *AdaptiveSampler) Sample(id uint64) bool {
+	boundary := atomic.LoadUint64(&s.boundary)
+	if s.backlog != nil {
+		if saturation := s.backlog(); saturation >= 1 {
+			boundary = 0
+		} else if saturation > 0 {
+			boundary = uint64(float64(boundary)*(1-saturation) + 0.5)
+		}
+	}
+	return id%10000 < boundary
+}
+
+// SetRate changes the sampling rate. Rates are clamped into the range [0, 1].
+func (s *AdaptiveSampler) SetRate(rate float64) {
+	if rate < 0 {
+		rate = 0
+	} else if rate > 1 {
+		rate = 1
+	}
+	s.rate.Store(rate)
+	atomic.StoreUint64(&s.boundary, uint64(rate*10000+0.5))
+}
+
+// Rate returns the current sampling rate, not accounting for backpressure.
+func (s *AdaptiveSampler) Rate() float64 {
+	return s.rate.Load().(float64)
+}
+
+// Close stops polling the SamplingRateSource.
+func (s *AdaptiveSampler) Close() error {
+	s.close.Do(func() { close(s.quit) })
+	s.done.Wait()
+	return nil
+}
+
+func (s *AdaptiveSampler) poll() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rate, err := s.source()
+			if err != nil {
+				_ = s.logger.Log("msg", "unable to fetch sampling rate", "err", err.Error())
+				continue
+			}
+			s.SetRate(rate)
+		case <-s.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package zipkintracer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sampledFraction returns the fraction of a full cycle of trace ids sampled.
+func sampledFraction(sampler Sampler) float64 {
+	var sampled int
+	for id := uint64(0); id < 10000; id++ {
+		if sampler(id) {
+			sampled++
+		}
+	}
+	return float64(sampled) / 10000
+}
+
+func TestAdaptiveSamplerSetRate(t *testing.T) {
+	s := NewAdaptiveSampler(0.1)
+	defer s.Close()
+
+	for _, rate := range []float64{0.1, 0.5, 0, 1, 2, -1} {
+		s.SetRate(rate)
+		want := rate
+		if want > 1 {
+			want = 1
+		} else if want < 0 {
+			want = 0
+		}
+		if have := s.Rate(); want != have {
+			t.Errorf("rate %f: want rate %f, have %f", rate, want, have)
+		}
+		if have := sampledFraction(s.Sample); want != have {
+			t.Errorf("rate %f: want sampled fraction %f, have %f", rate, want, have)
+		}
+	}
+}
+
+func TestAdaptiveSamplerPoll(t *testing.T) {
+	var rate atomic.Value
+	rate.Store("0.1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"sampleRate": %s}`, rate.Load())
+	}))
+	defer server.Close()
+
+	const pollInterval = 20 * time.Millisecond
+	s := NewAdaptiveSampler(0.01, AdaptiveSamplerPoll(HTTPSamplingRateSource(server.URL, nil), pollInterval))
+	defer s.Close()
+
+	for _, advertised := range []string{"0.1", "0.75", "0"} {
+		rate.Store(advertised)
+		var want float64
+		fmt.Sscan(advertised, &want)
+		// allow for a poll in flight while the rate was changed
+		if err := eventually(func() bool { return sampledFraction(s.Sample) == want }, 3*pollInterval); err != nil {
+			t.Errorf("advertised %s: want sampled fraction %f, have %f", advertised, want, sampledFraction(s.Sample))
+		}
+	}
+
+	// failed polls keep the current rate
+	rate.Store("invalid")
+	time.Sleep(3 * pollInterval)
+	if want, have := 0.0, s.Rate(); want != have {
+		t.Errorf("after failed poll: want rate %f, have %f", want, have)
+	}
+}
+
+func TestAdaptiveSamplerPollError(t *testing.T) {
+	errs := make(chan error, 1)
+	logger := LoggerFunc(func(keyvals ...interface{}) error {
+		select {
+		case errs <- errors.New(fmt.Sprint(keyvals...)):
+		default:
+		}
+		return nil
+	})
+	s := NewAdaptiveSampler(0.5,
+		AdaptiveSamplerPoll(func() (float64, error) { return 0, errors.New("unavailable") }, time.Millisecond),
+		AdaptiveSamplerLogger(logger),
+	)
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Error("failed poll not logged")
+	}
+	s.Close()
+	if want, have := 0.5, s.Rate(); want != have {
+		t.Errorf("want rate %f, have %f", want, have)
+	}
+}
+
+func TestAdaptiveSamplerBackpressure(t *testing.T) {
+	var saturation atomic.Value
+	saturation.Store(0.0)
+	s := NewAdaptiveSampler(0.5, AdaptiveSamplerBackpressure(func() float64 {
+		return saturation.Load().(float64)
+	}))
+	defer s.Close()
+
+	for _, test := range []struct {
+		saturation, fraction float64
+	}{
+		{0, 0.5},
+		{0.5, 0.25},
+		{0.9, 0.05},
+		{1, 0},
+		{0, 0.5},
+	} {
+		saturation.Store(test.saturation)
+		if want, have := test.fraction, sampledFraction(s.Sample); want != have {
+			t.Errorf("saturation %f: want sampled fraction %f, have %f", test.saturation, want, have)
+		}
+	}
+	if want, have := 0.5, s.Rate(); want != have {
+		t.Errorf("rate: want %f, have %f", want, have)
+	}
+}
+
+func TestAdaptiveSamplerSaturatedCollector(t *testing.T) {
+	var (
+		received = make(chan struct{}, 1)
+		release  = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+
+	c, err := NewJSONHTTPCollector(server.URL, JSONHTTPBatchSize(1), JSONHTTPMaxBacklog(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer close(release)
+
+	collector := c.(*JSONHTTPCollector)
+	s := NewAdaptiveSampler(1, AdaptiveSamplerBackpressure(collector.Saturation))
+	defer s.Close()
+
+	before := sampledFraction(s.Sample)
+
+	// the first span blocks the send loop on the server, the rest fill the
+	// backlog.
+	collector.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, 1, 0, nil, false))
+	<-received
+	for i := 0; i < 10; i++ {
+		collector.Collect(makeNewJSONSpan("1.2.3.4:1234", "service", "method", 1, uint64(i+2), 0, nil, false))
+	}
+	if want, have := 1.0, collector.Saturation(); want != have {
+		t.Fatalf("saturation: want %f, have %f", want, have)
+	}
+	if after := sampledFraction(s.Sample); after >= before {
+		t.Errorf("want fewer traces admitted when saturated, have %f before and %f after", before, after)
+	}
+}
@@ -28,6 +28,8 @@ func ModuloSampler(mod uint64) Sampler {
 // NewBoundarySampler is appropriate for high-traffic instrumentation who
 // provision random trace ids, and make the sampling decision only once.
 // It defends against nodes in the cluster selecting exactly the same ids.
+// The decision for a given trace id is deterministic given the salt: samplers
+// sharing a salt agree, samplers with different salts sample different traces.
 func NewBoundarySampler(rate float64, salt int64) Sampler {
 	if rate <= 0 {
 		return neverSample
@@ -44,11 +46,36 @@ func NewBoundarySampler(rate float64, salt int64) Sampler {
 	}
 }
 
+// NewDeterministicSampler makes its sampling decision purely based on the
+// lower 64 bits of the trace id. Every service using a deterministic sampler
+// with the same rate will come to the same decision for a given trace, which
+// keeps traces complete even if services don't propagate sampling decisions.
+func NewDeterministicSampler(rate float64) Sampler {
+	if rate <= 0 {
+		return neverSample
+	}
+	if rate >= 1.0 {
+		return alwaysSample
+	}
+	boundary := uint64(rate * 10000)
+	return func(id uint64) bool {
+		return id%10000 < boundary
+	}
+}
+
 // NewCountingSampler is appropriate for low-traffic instrumentation or
 // those who do not provision random trace ids. It is not appropriate for
 // collectors as the sampling decision isn't idempotent (consistent based
 // on trace id).
 func NewCountingSampler(rate float64) Sampler {
+	return NewCountingSamplerSeeded(rate, time.Now().UnixNano())
+}
+
+// NewCountingSamplerSeeded is like NewCountingSampler but distributes the
+// sampled spans within every 100 spans based on seed, so samplers with the
+// same seed come to the same sequence of decisions, e.g. for reproducible
+// tests. Seeding instances of a fleet differently avoids correlated sampling.
+func NewCountingSamplerSeeded(rate float64, seed int64) Sampler {
 	if rate <= 0 {
 		return neverSample
 	}
@@ -58,7 +85,7 @@ func NewCountingSampler(rate float64) Sampler {
 	var (
 		i         = 0
 		outOf100  = int(rate*100 + math.Copysign(0.5, rate*100)) // for rounding float to int conversion instead of truncation
-		decisions = randomBitSet(100, outOf100, rand.New(rand.NewSource(time.Now().UnixNano())))
+		decisions = randomBitSet(100, outOf100, rand.New(rand.NewSource(seed)))
 		mtx       = &sync.Mutex{}
 	)
 
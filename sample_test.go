@@ -1,8 +1,11 @@
 package zipkintracer_test
 
 import (
+	"net/http"
 	"testing"
 
+	opentracing "github.com/opentracing/opentracing-go"
+
 	zipkin "github.com/openzipkin-contrib/zipkin-go-opentracing"
 )
 
@@ -36,6 +39,42 @@ func TestBoundarySampler(t *testing.T) {
 	}
 }
 
+func TestDeterministicSampler(t *testing.T) {
+	type pair struct {
+		id   uint64
+		rate float64
+	}
+	for input, want := range map[pair]bool{
+		{123, 1.0}:                  true,
+		{123, 999}:                  true,
+		{123, 0.0}:                  false,
+		{123, -42}:                  false,
+		{1230000, 0.01}:             true,
+		{1230099, 0.01}:             true,
+		{1230100, 0.01}:             false,
+		{9999, 0.01}:                false,
+		{4999, 0.5}:                 true,
+		{5000, 0.5}:                 false,
+		{18446744073709551615, 0.2}: true, // id % 10000 == 1615
+		{18446744073709551615, 0.1}: false,
+	} {
+		sampler := zipkin.NewDeterministicSampler(input.rate)
+		for i := 0; i < 10; i++ {
+			if have := sampler(input.id); want != have {
+				t.Fatalf("%#+v (call %d): want %v, have %v", input, i, want, have)
+			}
+		}
+	}
+
+	// independently created samplers must agree on every trace id
+	a, b := zipkin.NewDeterministicSampler(0.25), zipkin.NewDeterministicSampler(0.25)
+	for id := uint64(0); id < 20000; id += 7 {
+		if a(id) != b(id) {
+			t.Fatalf("id %d: samplers disagree", id)
+		}
+	}
+}
+
 func TestCountingSampler(t *testing.T) {
 	for n := 1; n < 100; n++ {
 		sampler := zipkin.NewCountingSampler(float64(n) / 100)
@@ -50,3 +89,152 @@ func TestCountingSampler(t *testing.T) {
 		}
 	}
 }
+
+func TestSeededSamplers(t *testing.T) {
+	agree := func(a, b zipkin.Sampler) bool {
+		for id := uint64(0); id < 20000; id += 7 {
+			if a(id) != b(id) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for name, newSampler := range map[string]func(seed int64) zipkin.Sampler{
+		"boundary": func(seed int64) zipkin.Sampler { return zipkin.NewBoundarySampler(0.3, seed) },
+		"counting": func(seed int64) zipkin.Sampler { return zipkin.NewCountingSamplerSeeded(0.3, seed) },
+	} {
+		if !agree(newSampler(42), newSampler(42)) {
+			t.Errorf("%s: same seed: want identical decisions", name)
+		}
+		if agree(newSampler(42), newSampler(4711)) {
+			t.Errorf("%s: different seeds: want diverging decisions", name)
+		}
+	}
+
+	// seeding does not change the sampling rate
+	sampler := zipkin.NewCountingSamplerSeeded(0.3, 42)
+	found := 0
+	for i := 0; i < 100; i++ {
+		if sampler(1) {
+			found++
+		}
+	}
+	if want, have := 30, found; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+func TestSamplerCalledOncePerTrace(t *testing.T) {
+	var calls int
+	// sample every other trace
+	sampler := func(id uint64) bool {
+		calls++
+		return calls%2 == 1
+	}
+	recorder := zipkin.NewInMemoryRecorder()
+	tracer, err := zipkin.NewTracer(recorder, zipkin.WithSampler(sampler))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	const traces = 4
+	for i := 0; i < traces; i++ {
+		root := tracer.StartSpan("root")
+		sampled := root.Context().(zipkin.SpanContext).Sampled
+		for j := 0; j < 10; j++ {
+			child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+			follower := tracer.StartSpan("follower", opentracing.FollowsFrom(child.Context()))
+			for _, span := range []opentracing.Span{child, follower} {
+				if want, have := sampled, span.Context().(zipkin.SpanContext).Sampled; want != have {
+					t.Errorf("trace %d: want sampled %t, have %t", i, want, have)
+				}
+			}
+			follower.Finish()
+			child.Finish()
+		}
+		root.Finish()
+	}
+
+	if want, have := traces, calls; want != have {
+		t.Errorf("sampler calls: want %d, have %d", want, have)
+	}
+	if want, have := traces/2*21, len(recorder.GetSampledSpans()); want != have {
+		t.Errorf("sampled spans: want %d, have %d", want, have)
+	}
+}
+
+func TestRespectParentSampling(t *testing.T) {
+	for _, respect := range []bool{true, false} {
+		var calls int
+		neverSample := func(id uint64) bool {
+			calls++
+			return false
+		}
+		tracer, err := zipkin.NewTracer(
+			zipkin.NewInMemoryRecorder(),
+			zipkin.WithSampler(neverSample),
+			zipkin.WithRespectParentSampling(respect),
+		)
+		if err != nil {
+			t.Fatalf("Unable to create Tracer: %+v", err)
+		}
+
+		for _, sampled := range []string{"1", "0"} {
+			calls = 0
+			carrier := opentracing.HTTPHeadersCarrier(http.Header{
+				"X-B3-Traceid": []string{"0000000000000001"},
+				"X-B3-Spanid":  []string{"0000000000000002"},
+				"X-B3-Sampled": []string{sampled},
+			})
+			parent, err := tracer.Extract(opentracing.HTTPHeaders, carrier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			span := tracer.StartSpan("server", opentracing.ChildOf(parent))
+			child := tracer.StartSpan("child", opentracing.ChildOf(span.Context()))
+
+			want := respect && sampled == "1"
+			for _, s := range []opentracing.Span{span, child} {
+				if have := s.Context().(zipkin.SpanContext).Sampled; want != have {
+					t.Errorf("respect %t, upstream %s: want sampled %t, have %t", respect, sampled, want, have)
+				}
+			}
+			wantCalls := 0
+			if !respect && sampled == "1" {
+				wantCalls = 1
+			}
+			if wantCalls != calls {
+				t.Errorf("respect %t, upstream %s: sampler calls: want %d, have %d", respect, sampled, wantCalls, calls)
+			}
+			child.Finish()
+			span.Finish()
+		}
+	}
+}
+
+func TestSpanCounters(t *testing.T) {
+	tracer, err := zipkin.NewTracer(
+		zipkin.NewInMemoryRecorder(),
+		zipkin.WithSampler(zipkin.NewBoundarySampler(0.1, 0)),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+	counters := tracer.(zipkin.SpanCounters)
+
+	const spans = 1000
+	for i := 0; i < spans; i++ {
+		tracer.StartSpan("root").Finish()
+	}
+
+	if want, have := uint64(spans), counters.SpansStarted(); want != have {
+		t.Errorf("started: want %d, have %d", want, have)
+	}
+	if want, have := counters.SpansStarted(), counters.SpansSampled()+counters.SpansDropped(); want != have {
+		t.Errorf("sampled + dropped: want %d, have %d", want, have)
+	}
+	if ratio := float64(counters.SpansSampled()) / spans; ratio < 0.05 || ratio > 0.15 {
+		t.Errorf("sampled ratio: want about 0.1, have %f", ratio)
+	}
+}
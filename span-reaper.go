@@ -0,0 +1,90 @@
+package zipkintracer
+
+import (
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// IncompleteTag is set on spans finished by the tracer because they exceeded
+// the lifetime configured with WithMaxSpanLifetime.
+const IncompleteTag = "incomplete"
+
+// spanReaper finishes spans which stay open longer than lifetime. The set of
+// open spans decides who finishes a span: the reaper or Finish, whichever
+// removes it first.
+type spanReaper struct {
+	lifetime time.Duration
+	clock    func() time.Time
+
+	mu      sync.Mutex
+	spans   map[*spanImpl]struct{}
+	running bool
+}
+
+func newSpanReaper(lifetime time.Duration, clock func() time.Time) *spanReaper {
+	return &spanReaper{
+		lifetime: lifetime,
+		clock:    clock,
+		spans:    make(map[*spanImpl]struct{}),
+	}
+}
+
+// add registers an open span. The reaper goroutine only runs while spans are
+// open, so idle tracers don't hold on to a goroutine.
+func (r *spanReaper) add(s *spanImpl) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans[s] = struct{}{}
+	if !r.running {
+		r.running = true
+		go r.loop()
+	}
+}
+
+// remove unregisters a span and reports whether it was still open.
+func (r *spanReaper) remove(s *spanImpl) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.spans[s]; !ok {
+		return false
+	}
+	delete(r.spans, s)
+	return true
+}
+
+func (r *spanReaper) loop() {
+	interval := r.lifetime / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	for {
+		time.Sleep(interval)
+
+		var expired []*spanImpl
+		deadline := r.clock().Add(-r.lifetime)
+		r.mu.Lock()
+		for s := range r.spans {
+			if s.raw.Start.Before(deadline) {
+				expired = append(expired, s)
+				delete(r.spans, s)
+			}
+		}
+		done := len(r.spans) == 0
+		if done {
+			r.running = false
+		}
+		r.mu.Unlock()
+
+		for _, s := range expired {
+			s.SetTag(IncompleteTag, true)
+			// the owner of the span may still hold a reference, so it must not
+			// be recycled.
+			s.finish(opentracing.FinishOptions{}, false)
+		}
+		if done {
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package zipkintracer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+func TestMaxSpanLifetime(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(recorder, WithMaxSpanLifetime(20*time.Millisecond), WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	leaked := tracer.StartSpan("leaked")
+	tracer.StartSpan("finished").Finish()
+
+	if err := eventually(func() bool { return len(recorder.GetSpans()) == 2 }, time.Second); err != nil {
+		t.Fatalf("want leaked span to be recorded, have %d spans", len(recorder.GetSpans()))
+	}
+	spans := recorder.GetSpans()
+	if want, have := "finished", spans[0].Operation; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if _, ok := spans[0].Tags[IncompleteTag]; ok {
+		t.Error("finished span: want no incomplete tag")
+	}
+	if want, have := "leaked", spans[1].Operation; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := true, spans[1].Tags[IncompleteTag]; want != have {
+		t.Errorf("incomplete tag: want %v, have %v", want, have)
+	}
+	if spans[1].Duration < 20*time.Millisecond {
+		t.Errorf("want duration of at least the lifetime, have %s", spans[1].Duration)
+	}
+
+	// a late Finish is ignored
+	leaked.Finish()
+	if want, have := 2, len(recorder.GetSpans()); want != have {
+		t.Errorf("after late Finish: want %d spans, have %d", want, have)
+	}
+
+	if _, err := NewTracer(recorder, WithMaxSpanLifetime(-time.Second)); err == nil {
+		t.Error("negative lifetime: want error, have nil")
+	}
+}
+
+func TestMaxSpanLifetimeConcurrentFinish(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(recorder,
+		WithMaxSpanLifetime(time.Millisecond),
+		EnableSpanPool(true),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	const spans = 200
+	var wg sync.WaitGroup
+	for i := 0; i < spans; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			span := tracer.StartSpan("op")
+			// race the reaper
+			time.Sleep(time.Duration(i%4) * time.Millisecond)
+			span.FinishWithOptions(opentracing.FinishOptions{})
+		}(i)
+	}
+	wg.Wait()
+
+	// every span is recorded exactly once
+	if want, have := spans, len(recorder.GetSpans()); want != have {
+		t.Errorf("want %d spans, have %d", want, have)
+	}
+}
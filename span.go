@@ -2,6 +2,7 @@ package zipkintracer
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -9,6 +10,7 @@ import (
 	"github.com/opentracing/opentracing-go/log"
 
 	otobserver "github.com/opentracing-contrib/go-observer"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/flag"
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
 )
 
@@ -25,6 +27,30 @@ type Span interface {
 	Start() time.Time
 }
 
+// ForceSampler is implemented by the spans of this package's tracers which
+// can be sampled after their start.
+type ForceSampler interface {
+	// ForceSample marks the span as sampled and debug, overriding the
+	// sampling decision made at its start, e.g. once a request turns out to
+	// be worth keeping. Spans started from its context afterwards, including
+	// those in other processes, inherit the decision. With TrimUnsampledSpans
+	// tags and logs added before the call are not recorded.
+	ForceSample()
+}
+
+// Flusher is implemented by the spans of this package's tracers which can
+// report their progress before they finish.
+type Flusher interface {
+	// Flush records the current state of the unfinished span as an
+	// in-progress update, e.g. to make the progress of long running spans
+	// visible before they finish. The update carries the tags and the logs
+	// recorded since the previous Flush, and no start time or duration. The
+	// logs are not reported again; Finish reports the remaining logs, the
+	// tags and the timing. Zipkin merges the reports of a span by trace and
+	// span ID, later tag values win.
+	Flush()
+}
+
 // Implements the `Span` interface. Created via tracerImpl (see
 // `zipkintracer.NewTracer()`).
 type spanImpl struct {
@@ -35,6 +61,8 @@ type spanImpl struct {
 	raw        RawSpan
 	// The number of logs dropped because of MaxLogsPerSpan.
 	numDroppedLogs int
+	// The number of tags dropped because of MaxTagsPerSpan.
+	numDroppedTags int
 	Endpoint       *zipkincore.Endpoint
 }
 
@@ -43,7 +71,8 @@ var spanPool = &sync.Pool{New: func() interface{} {
 }}
 
 func (s *spanImpl) reset() {
-	s.tracer, s.event = nil, nil
+	s.tracer, s.event, s.observer = nil, nil, nil
+	s.Endpoint = nil
 	// Note: Would like to do the following, but then the consumer of RawSpan
 	// (the recorder) needs to make sure that they're not holding on to the
 	// baggage or logs when they return (i.e. they need to copy if they care):
@@ -62,6 +91,7 @@ func (s *spanImpl) reset() {
 	s.raw = RawSpan{
 		Context: SpanContext{},
 	}
+	s.numDroppedLogs, s.numDroppedTags = 0, 0
 }
 
 func (s *spanImpl) SetOperationName(operationName string) opentracing.Span {
@@ -74,6 +104,18 @@ func (s *spanImpl) SetOperationName(operationName string) opentracing.Span {
 	return s
 }
 
+func (s *spanImpl) ForceSample() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.raw.Context.Sampled {
+		// the span counts as sampled from now on
+		atomic.AddUint64(&s.tracer.spansDropped, ^uint64(0))
+		atomic.AddUint64(&s.tracer.spansSampled, 1)
+	}
+	s.raw.Context.Sampled = true
+	s.raw.Context.Flags |= flag.Debug | flag.SamplingSet | flag.Sampled
+}
+
 func (s *spanImpl) trim() bool {
 	return !s.raw.Context.Sampled && s.tracer.options.trimUnsampledSpans
 }
@@ -99,6 +141,12 @@ func (s *spanImpl) SetTag(key string, value interface{}) opentracing.Span {
 	if s.raw.Tags == nil {
 		s.raw.Tags = opentracing.Tags{}
 	}
+	if maxTags := s.tracer.options.maxTagsPerSpan; maxTags > 0 && len(s.raw.Tags) >= maxTags {
+		if _, ok := s.raw.Tags[key]; !ok {
+			s.numDroppedTags++
+			return s
+		}
+	}
 	s.raw.Tags[key] = value
 	return s
 }
@@ -138,7 +186,7 @@ func (s *spanImpl) LogFields(fields ...log.Field) {
 		return
 	}
 	if lr.Timestamp.IsZero() {
-		lr.Timestamp = time.Now()
+		lr.Timestamp = s.tracer.options.clock()
 	}
 	s.appendLog(lr)
 }
@@ -165,7 +213,7 @@ func (s *spanImpl) Log(ld opentracing.LogData) {
 	}
 
 	if ld.Timestamp.IsZero() {
-		ld.Timestamp = time.Now()
+		ld.Timestamp = s.tracer.options.clock()
 	}
 
 	s.appendLog(ld.ToLogRecord())
@@ -175,6 +223,55 @@ func (s *spanImpl) Finish() {
 	s.FinishWithOptions(opentracing.FinishOptions{})
 }
 
+// decircularizeLogs restores the order of the logs if some were dropped
+// because of MaxLogsPerSpan, the caller must hold the lock.
+func (s *spanImpl) decircularizeLogs() {
+	if s.numDroppedLogs == 0 {
+		return
+	}
+	// We dropped some log events, which means that we used part of Logs as a
+	// circular buffer (see appendLog). De-circularize it.
+	numOld := (len(s.raw.Logs) - 1) / 2
+	numNew := len(s.raw.Logs) - numOld
+	rotateLogBuffer(s.raw.Logs[numOld:], s.numDroppedLogs%numNew)
+
+	// Replace the log in the middle (the oldest "new" log) with information
+	// about the dropped logs. This means that we are effectively dropping one
+	// more "new" log.
+	numDropped := s.numDroppedLogs + 1
+	s.raw.Logs[numOld] = opentracing.LogRecord{
+		// Keep the timestamp of the last dropped event.
+		Timestamp: s.raw.Logs[numOld].Timestamp,
+		Fields: []log.Field{
+			log.String("event", "dropped Span logs"),
+			log.Int("dropped_log_count", numDropped),
+			log.String("component", "zipkintracer"),
+		},
+	}
+}
+
+func (s *spanImpl) Flush() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.raw.Context.Sampled {
+		return
+	}
+	s.decircularizeLogs()
+
+	update := s.raw
+	update.Partial = true
+	// the span keeps changing, the recorder gets a copy of the tags.
+	update.Tags = make(opentracing.Tags, len(s.raw.Tags))
+	for k, v := range s.raw.Tags {
+		update.Tags[k] = v
+	}
+	// flushed logs are handed off to the recorder and not reported again.
+	s.raw.Logs = nil
+	s.numDroppedLogs = 0
+
+	s.tracer.options.recorder.RecordSpan(update)
+}
+
 // rotateLogBuffer rotates the records in the buffer: records 0 to pos-1 move at
 // the end (i.e. pos circular left shifts).
 func rotateLogBuffer(buf []opentracing.LogRecord, pos int) {
@@ -193,55 +290,63 @@ func rotateLogBuffer(buf []opentracing.LogRecord, pos int) {
 }
 
 func (s *spanImpl) FinishWithOptions(opts opentracing.FinishOptions) {
-	finishTime := opts.FinishTime
-	if finishTime.IsZero() {
-		finishTime = time.Now()
+	if t := s.tracer; t != nil && t.reaper != nil && !t.reaper.remove(s) {
+		// already finished by the reaper
+		return
 	}
-	duration := finishTime.Sub(s.raw.Start)
+	s.finish(opts, true)
+}
 
+// finish records the span. Spans are only returned to the pool if recycle is
+// set.
+func (s *spanImpl) finish(opts opentracing.FinishOptions, recycle bool) {
 	if s.observer != nil {
+		// provide observers with the actual finish time of the span.
+		if opts.FinishTime.IsZero() {
+			opts.FinishTime = s.tracer.options.clock()
+		}
 		s.observer.OnFinish(opts)
 	}
 
 	s.Lock()
 	defer s.Unlock()
 
-	for _, lr := range opts.LogRecords {
-		s.appendLog(lr)
+	finishTime := opts.FinishTime
+	if finishTime.IsZero() {
+		finishTime = s.tracer.options.clock()
 	}
-	for _, ld := range opts.BulkLogData {
-		s.appendLog(ld.ToLogRecord())
+	duration := finishTime.Sub(s.raw.Start)
+
+	if !s.tracer.options.dropAllLogs && !s.trim() {
+		for _, lr := range opts.LogRecords {
+			s.appendLog(lr)
+		}
+		for _, ld := range opts.BulkLogData {
+			s.appendLog(ld.ToLogRecord())
+		}
 	}
 
-	if s.numDroppedLogs > 0 {
-		// We dropped some log events, which means that we used part of Logs as a
-		// circular buffer (see appendLog). De-circularize it.
-		numOld := (len(s.raw.Logs) - 1) / 2
-		numNew := len(s.raw.Logs) - numOld
-		rotateLogBuffer(s.raw.Logs[numOld:], s.numDroppedLogs%numNew)
-
-		// Replace the log in the middle (the oldest "new" log) with information
-		// about the dropped logs. This means that we are effectively dropping one
-		// more "new" log.
-		numDropped := s.numDroppedLogs + 1
-		s.raw.Logs[numOld] = opentracing.LogRecord{
-			// Keep the timestamp of the last dropped event.
-			Timestamp: s.raw.Logs[numOld].Timestamp,
+	if s.numDroppedTags > 0 && !s.tracer.options.dropAllLogs {
+		// Record how many tags were dropped because of MaxTagsPerSpan.
+		s.appendLog(opentracing.LogRecord{
+			Timestamp: finishTime,
 			Fields: []log.Field{
-				log.String("event", "dropped Span logs"),
-				log.Int("dropped_log_count", numDropped),
+				log.String("event", "dropped Span tags"),
+				log.Int("dropped_tag_count", s.numDroppedTags),
 				log.String("component", "zipkintracer"),
 			},
-		}
+		})
 	}
 
+	s.decircularizeLogs()
+
 	s.raw.Duration = duration
 
 	s.onFinish(s.raw)
 	s.tracer.options.recorder.RecordSpan(s.raw)
 
 	// Last chance to get options before the span is possibly reset.
-	poolEnabled := s.tracer.options.enableSpanPool
+	poolEnabled := s.tracer.options.enableSpanPool && recycle
 	if s.tracer.options.debugAssertUseAfterFinish {
 		// This makes it much more likely to catch a panic on any subsequent
 		// operation since s.tracer is accessed on every call to `Lock`.
@@ -9,6 +9,9 @@ import (
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/flag"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
 )
 
 func TestSpan_Baggage(t *testing.T) {
@@ -167,6 +170,17 @@ func TestSpan_TrimUnsampledSpans(t *testing.T) {
 	assert.Equal(t, 1, len(spans))
 	assert.Equal(t, 0, len(spans[0].Logs))
 	assert.Equal(t, 0, len(spans[0].Tags))
+
+	// tags passed at start and logs passed at finish are discarded as well
+	recorder.Reset()
+	span = tracer.StartSpan("x", opentracing.Tag{Key: "start", Value: "value"})
+	span.FinishWithOptions(opentracing.FinishOptions{
+		LogRecords: []opentracing.LogRecord{{Fields: []log.Field{log.String("event", "finish")}}},
+	})
+	spans = recorder.GetSpans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, 0, len(spans[0].Logs))
+	assert.Equal(t, 0, len(spans[0].Tags))
 }
 
 func TestSpan_DropAllLogs(t *testing.T) {
@@ -193,6 +207,34 @@ func TestSpan_DropAllLogs(t *testing.T) {
 	assert.Equal(t, 0, len(spans[0].Logs))
 }
 
+func TestSpan_DropAllLogsJSONRecorder(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc"),
+		DropAllLogs(true),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	span := tracer.StartSpan("x", ext.SpanKindRPCClient)
+	span.SetTag("tag", "value")
+	span.LogFields(log.String("event", "fields"), log.Int("int", 1))
+	span.LogKV("event", "kv")
+	span.FinishWithOptions(opentracing.FinishOptions{
+		LogRecords: []opentracing.LogRecord{{Fields: []log.Field{log.String("event", "finish")}}},
+	})
+
+	assert.Equal(t, 1, len(c.spans))
+	assert.Equal(t, []string{"cs", "cr"}, annotationValues(c.spans[0]))
+	var tags []string
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		tags = append(tags, annotation.Key+"="+annotation.Value)
+	}
+	assert.Equal(t, []string{"tag=value"}, tags)
+}
+
 func TestSpan_MaxLogSperSpan(t *testing.T) {
 	for _, limit := range []int{5, 10, 15, 20, 30, 40, 50} {
 		for _, numLogs := range []int{5, 10, 15, 20, 30, 40, 50, 60, 70, 80} {
@@ -250,3 +292,254 @@ func TestSpan_MaxLogSperSpan(t *testing.T) {
 		}
 	}
 }
+
+func TestSpan_MaxTagsPerSpan(t *testing.T) {
+	const limit = 5
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		WithSampler(func(_ uint64) bool { return true }),
+		WithMaxTagsPerSpan(limit),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	span := tracer.StartSpan("x")
+	for i := 0; i < limit*2; i++ {
+		span.SetTag("tag"+strconv.Itoa(i), i)
+	}
+	// overwriting an existing key is allowed once the limit is reached
+	span.SetTag("tag0", "overwritten")
+	span.Finish()
+
+	spans := recorder.GetSpans()
+	assert.Equal(t, 1, len(spans))
+	want := opentracing.Tags{"tag0": "overwritten"}
+	for i := 1; i < limit; i++ {
+		want["tag"+strconv.Itoa(i)] = i
+	}
+	assert.Equal(t, want, spans[0].Tags)
+
+	assert.Equal(t, 1, len(spans[0].Logs))
+	fv := NewLogFieldValidator(t, spans[0].Logs[0].Fields)
+	fv.
+		ExpectNextFieldEquals("event", reflect.String, "dropped Span tags").
+		ExpectNextFieldEquals("dropped_tag_count", reflect.Int, strconv.Itoa(limit)).
+		ExpectNextFieldEquals("component", reflect.String, "zipkintracer")
+
+	if _, err = NewTracer(recorder, WithMaxTagsPerSpan(-1)); err == nil {
+		t.Error("expected error for negative MaxTagsPerSpan limit")
+	}
+}
+
+func TestSpan_MaxTagsPerSpanDisabledByDefault(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		WithSampler(func(_ uint64) bool { return true }),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	const numTags = 1000
+	span := tracer.StartSpan("x")
+	for i := 0; i < numTags; i++ {
+		span.SetTag("tag"+strconv.Itoa(i), i)
+	}
+	span.Finish()
+
+	spans := recorder.GetSpans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, numTags, len(spans[0].Tags))
+	assert.Equal(t, 0, len(spans[0].Logs))
+}
+
+func TestSpan_DebugModeBypassesSampler(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		WithSampler(func(_ uint64) bool { return false }),
+		DebugMode(true),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parent := tracer.StartSpan("parent")
+	tracer.StartSpan("child", opentracing.ChildOf(parent.Context())).Finish()
+	parent.Finish()
+
+	spans := recorder.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	for _, span := range spans {
+		assert.True(t, span.Context.Sampled, span.Operation)
+		assert.Equal(t, flag.Debug, span.Context.Flags&flag.Debug, span.Operation)
+	}
+}
+
+func TestSpan_DebugTag(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		WithSampler(func(_ uint64) bool { return false }),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parent := tracer.StartSpan("parent", opentracing.Tag{Key: DebugTag, Value: true})
+	tracer.StartSpan("child", opentracing.ChildOf(parent.Context())).Finish()
+	parent.Finish()
+	tracer.StartSpan("regular", opentracing.Tag{Key: DebugTag, Value: false}).Finish()
+
+	spans := recorder.GetSpans()
+	assert.Equal(t, 3, len(spans))
+	for _, span := range spans[:2] {
+		assert.True(t, span.Context.Sampled, span.Operation)
+		assert.Equal(t, flag.Debug, span.Context.Flags&flag.Debug, span.Operation)
+	}
+	assert.False(t, spans[2].Context.Sampled)
+	assert.Equal(t, flag.Flags(0), spans[2].Context.Flags&flag.Debug)
+
+	// the control tag is not recorded, other tags are
+	tags := opentracing.Tags{DebugTag: true, "key": "value"}
+	tracer.StartSpan("tagged", tags).Finish()
+	spans = recorder.GetSpans()
+	assert.Equal(t, opentracing.Tags{"key": "value"}, spans[3].Tags)
+	assert.Equal(t, 2, len(tags), "caller's tags")
+	for _, span := range spans[:3] {
+		_, ok := span.Tags[DebugTag]
+		assert.False(t, ok, span.Operation)
+	}
+}
+
+// sequenceIDGenerator hands out incrementing ids.
+type sequenceIDGenerator struct {
+	next uint64
+}
+
+func (g *sequenceIDGenerator) TraceID() types.TraceID {
+	g.next++
+	return types.TraceID{High: 0xabc, Low: g.next}
+}
+
+func (g *sequenceIDGenerator) SpanID() uint64 {
+	g.next++
+	return g.next
+}
+
+func TestSpan_IDGenerator(t *testing.T) {
+	recorder := NewInMemoryRecorder()
+	tracer, err := NewTracer(
+		recorder,
+		WithIDGenerator(&sequenceIDGenerator{next: 100}),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parent := tracer.StartSpan("parent")
+	tracer.StartSpan("child", opentracing.ChildOf(parent.Context())).Finish()
+	parent.Finish()
+
+	spans := recorder.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	child, root := spans[0].Context, spans[1].Context
+	assert.Equal(t, types.TraceID{High: 0xabc, Low: 101}, root.TraceID)
+	assert.Equal(t, uint64(102), root.SpanID)
+	assert.Equal(t, root.TraceID, child.TraceID)
+	assert.Equal(t, uint64(103), child.SpanID)
+	assert.Equal(t, uint64(102), *child.ParentSpanID)
+}
+
+func TestSpan_ForceSample(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc"),
+		WithSampler(func(_ uint64) bool { return false }),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parent := tracer.StartSpan("parent")
+	assert.False(t, parent.Context().(SpanContext).Sampled)
+	parent.(ForceSampler).ForceSample()
+	parent.(ForceSampler).ForceSample()
+	counters := tracer.(SpanCounters)
+	assert.Equal(t, uint64(1), counters.SpansSampled())
+	assert.Equal(t, uint64(0), counters.SpansDropped())
+
+	// the decision is propagated in-process and across process boundaries
+	carrier := opentracing.TextMapCarrier{}
+	assert.NoError(t, tracer.Inject(parent.Context(), opentracing.TextMap, carrier))
+	remote, err := tracer.Extract(opentracing.TextMap, carrier)
+	assert.NoError(t, err)
+
+	tracer.StartSpan("child", opentracing.ChildOf(parent.Context())).Finish()
+	tracer.StartSpan("remote", opentracing.ChildOf(remote)).Finish()
+	parent.Finish()
+	tracer.StartSpan("unsampled").Finish()
+
+	var names []string
+	for _, span := range c.spans {
+		names = append(names, span.Name)
+		assert.True(t, span.Debug, span.Name)
+	}
+	assert.Equal(t, []string{"child", "remote", "parent"}, names)
+	assert.Equal(t, uint64(3), counters.SpansSampled())
+	assert.Equal(t, uint64(1), counters.SpansDropped())
+	assert.Equal(t, uint64(4), counters.SpansStarted())
+}
+
+func TestSpan_Flush(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc"),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	span := tracer.StartSpan("stream", ext.SpanKindRPCServer)
+	span.SetTag("chunks", 1)
+	span.LogFields(log.String("event", "chunk 1"))
+	span.(Flusher).Flush()
+
+	if !assert.Equal(t, 1, len(c.spans), "flush before finish") {
+		return
+	}
+	update := c.spans[0]
+	assert.Equal(t, span.Context().(SpanContext).SpanIDString(), update.ID)
+	assert.Equal(t, int64(0), update.Timestamp)
+	assert.Equal(t, int64(0), update.Duration)
+	assert.Equal(t, 1, len(update.Annotations))
+	assert.Equal(t, "chunk 1", update.Annotations[0].Value)
+	assert.Equal(t, 1, len(update.BinaryAnnotations))
+	assert.Equal(t, "chunks", update.BinaryAnnotations[0].Key)
+
+	span.SetTag("chunks", 2)
+	span.LogFields(log.String("event", "chunk 2"))
+	span.Finish()
+
+	if !assert.Equal(t, 2, len(c.spans)) {
+		return
+	}
+	final := c.spans[1]
+	assert.Equal(t, update.ID, final.ID)
+	assert.NotEqual(t, int64(0), final.Timestamp)
+	var values []string
+	for _, annotation := range final.Annotations {
+		values = append(values, annotation.Value)
+	}
+	// flushed logs are not reported again
+	assert.Equal(t, []string{"sr", "ss", "chunk 2"}, values)
+	assert.Equal(t, "2", final.BinaryAnnotations[0].Value)
+}
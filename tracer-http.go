@@ -0,0 +1,69 @@
+package zipkintracer
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// httpTracerOptions holds the options passed through by NewHTTPTracer.
+type httpTracerOptions struct {
+	debug            bool
+	collectorOptions []JSONHTTPOption
+	recorderOptions  []JSONRecorderOption
+	tracerOptions    []TracerOption
+}
+
+// HTTPTracerOption sets a parameter for NewHTTPTracer.
+type HTTPTracerOption func(o *httpTracerOptions)
+
+// HTTPTracerDebug sets the debug flag of the JSON recorder, marking all
+// recorded spans as debug.
+func HTTPTracerDebug(debug bool) HTTPTracerOption {
+	return func(o *httpTracerOptions) { o.debug = debug }
+}
+
+// HTTPTracerCollectorOptions passes options through to the JSON HTTP
+// collector, e.g. JSONHTTPBatchSize.
+func HTTPTracerCollectorOptions(options ...JSONHTTPOption) HTTPTracerOption {
+	return func(o *httpTracerOptions) {
+		o.collectorOptions = append(o.collectorOptions, options...)
+	}
+}
+
+// HTTPTracerRecorderOptions passes options through to the JSON recorder, e.g.
+// JSONWithJSONMaterializer.
+func HTTPTracerRecorderOptions(options ...JSONRecorderOption) HTTPTracerOption {
+	return func(o *httpTracerOptions) {
+		o.recorderOptions = append(o.recorderOptions, options...)
+	}
+}
+
+// HTTPTracerTracerOptions passes options through to the tracer, e.g.
+// WithSampler.
+func HTTPTracerTracerOptions(options ...TracerOption) HTTPTracerOption {
+	return func(o *httpTracerOptions) {
+		o.tracerOptions = append(o.tracerOptions, options...)
+	}
+}
+
+// NewHTTPTracer assembles a tracer reporting to Zipkin at zipkinURL through a
+// JSON HTTP collector and a JSON recorder. serviceName and hostPort describe
+// the local endpoint as in NewJSONRecorder. The returned close function flushes
+// pending spans and must be called before the application exits.
+func NewHTTPTracer(zipkinURL, serviceName, hostPort string, options ...HTTPTracerOption) (opentracing.Tracer, func() error, error) {
+	o := &httpTracerOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	collector, err := NewJSONHTTPCollector(zipkinURL, o.collectorOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorder := NewJSONRecorder(collector, o.debug, hostPort, serviceName, o.recorderOptions...)
+	tracer, err := NewTracer(recorder, o.tracerOptions...)
+	if err != nil {
+		collector.Close()
+		return nil, nil, err
+	}
+	return tracer, collector.Close, nil
+}
@@ -0,0 +1,62 @@
+package zipkintracer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestNewHTTPTracer(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		spans []*CoreSpan
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []*CoreSpan
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		spans = append(spans, batch...)
+	}))
+	defer server.Close()
+
+	tracer, closeTracer, err := NewHTTPTracer(server.URL, "svc", "10.0.0.1:80",
+		HTTPTracerDebug(true),
+		HTTPTracerCollectorOptions(JSONHTTPBatchSize(10)),
+		HTTPTracerTracerOptions(WithSampler(alwaysSample), WithLogger(&nopLogger{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.StartSpan("op").Finish()
+
+	// closing flushes pending spans
+	if err := closeTracer(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want, have := 1, len(spans); want != have {
+		t.Fatalf("spans: want %d, have %d", want, have)
+	}
+	if want, have := "op", spans[0].Name; want != have {
+		t.Errorf("name: want %q, have %q", want, have)
+	}
+	if !spans[0].Debug {
+		t.Error("debug: want true, have false")
+	}
+	if want, have := "svc", spans[0].BinaryAnnotations[0].Endpoint.ServiceName; want != have {
+		t.Errorf("service name: want %q, have %q", want, have)
+	}
+
+	// invalid tracer options are reported
+	if _, _, err := NewHTTPTracer(server.URL, "svc", "10.0.0.1:80",
+		HTTPTracerTracerOptions(WithMaxLogsPerSpan(1)),
+	); err == nil {
+		t.Error("want error for invalid tracer option, have nil")
+	}
+}
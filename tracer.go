@@ -2,6 +2,8 @@ package zipkintracer
 
 import (
 	"errors"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -53,6 +55,14 @@ type TracerOptions struct {
 	// If NewSpanEventListener is set, the callbacks will still fire for all log
 	// events. This value is ignored if DropAllLogs is true.
 	maxLogsPerSpan int
+	// maxTagsPerSpan limits the number of Tags in a span (if set to a nonzero
+	// value). Once a span holds this many distinct tags, SetTag calls for new
+	// keys are dropped, so the first maxTagsPerSpan keys by insertion are kept.
+	// Overwriting the value of an already present key is always allowed.
+	//
+	// If NewSpanEventListener is set, the callbacks will still fire for all
+	// tag events.
+	maxTagsPerSpan int
 	// debugAssertSingleGoroutine internally records the ID of the goroutine
 	// creating each Span and verifies that no operation is carried out on
 	// it on a different goroutine.
@@ -110,13 +120,51 @@ type TracerOptions struct {
 	traceID128Bit bool
 
 	observer otobserver.Observer
+	// contextValidator is invoked on every successfully extracted SpanContext.
+	// If it returns an error the extracted context is discarded and an empty
+	// SpanContext is returned instead, causing spans joining it to become the
+	// root of a new trace.
+	contextValidator ContextValidator
+	// clock returns the current time and is used to timestamp span starts,
+	// finishes and logs which have no explicit time set.
+	clock func() time.Time
+	// idGenerator provides the trace and span ids of new spans. If not set the
+	// tracer uses random ids honoring traceID128Bit.
+	idGenerator IDGenerator
+	// baggagePrefix is prepended to the baggage keys when propagating baggage
+	// items through TextMap and HTTPHeaders carriers.
+	baggagePrefix string
+	// respectParentSampling makes the tracer honor the sampling decision of
+	// extracted contexts without consulting shouldSample. If false, the local
+	// sampler is consulted on extraction of an upstream sampled context and
+	// may drop the trace.
+	respectParentSampling bool
+	// maxSpanLifetime is the duration after which open spans are finished
+	// by the tracer. Zero disables the reaper.
+	maxSpanLifetime time.Duration
+	// extractHook is invoked on every successfully extracted and validated
+	// SpanContext together with the carrier, allowing the context to be
+	// amended from carrier contents the propagators don't know about.
+	extractHook ExtractHook
 }
 
+// ContextValidator inspects a SpanContext extracted from a carrier. A non-nil
+// error rejects the context.
+type ContextValidator func(SpanContext) error
+
+// ExtractHook inspects the carrier a SpanContext was extracted from and returns
+// the SpanContext to use, e.g. with sampling forced by a custom header.
+type ExtractHook func(format, carrier interface{}, sc SpanContext) SpanContext
+
 // TracerOption allows for functional options.
 // See: http://dave.cheney.net/2014/10/17/functional-options-for-friendly-apis
 type TracerOption func(opts *TracerOptions) error
 
-// WithSampler allows one to add a Sampler function
+// WithSampler allows one to add a Sampler function. The Sampler is only
+// consulted for root spans and for children of contexts without sampling
+// decision, e.g. extracted without X-B3-Sampled header. The decision is kept in
+// the SpanContext and reused by all descendants, so a trace is either sampled
+// or not as a whole.
 func WithSampler(sampler Sampler) TracerOption {
 	return func(opts *TracerOptions) error {
 		opts.shouldSample = sampler
@@ -124,6 +172,18 @@ func WithSampler(sampler Sampler) TracerOption {
 	}
 }
 
+// WithRespectParentSampling sets whether a sampling decision extracted from a
+// carrier is honored as is (default) or the local Sampler gets the final say
+// on extraction. In the latter case an upstream sampled trace is only kept if
+// the Sampler agrees, while an upstream unsampled trace stays unsampled. Debug
+// contexts are always sampled.
+func WithRespectParentSampling(val bool) TracerOption {
+	return func(opts *TracerOptions) error {
+		opts.respectParentSampling = val
+		return nil
+	}
+}
+
 // TrimUnsampledSpans option
 func TrimUnsampledSpans(trim bool) TracerOption {
 	return func(opts *TracerOptions) error {
@@ -132,7 +192,9 @@ func TrimUnsampledSpans(trim bool) TracerOption {
 	}
 }
 
-// DropAllLogs option
+// DropAllLogs option discards the logs of all spans, including the log
+// records passed to FinishWithOptions, before they reach the SpanRecorder.
+// Tags and the core annotations derived from the span kind are unaffected.
 func DropAllLogs(dropAllLogs bool) TracerOption {
 	return func(opts *TracerOptions) error {
 		opts.dropAllLogs = dropAllLogs
@@ -185,7 +247,17 @@ func ClientServerSameSpan(val bool) TracerOption {
 	}
 }
 
-// DebugMode allows to set the tracer to Zipkin debug mode
+// DebugTag can be set to true in the tags passed to StartSpan to start a debug
+// span: it is sampled regardless of the Sampler and flagged as debug so Zipkin
+// retains it. The Debug flag is propagated to all descendants of the span. The
+// tag only controls the tracer and is not recorded.
+//
+//  span := tracer.StartSpan("op", opentracing.Tag{Key: DebugTag, Value: true})
+const DebugTag = "zipkincore.debug"
+
+// DebugMode allows to set the tracer to Zipkin debug mode. All traces started
+// by the tracer bypass the configured Sampler: they are sampled and flagged as
+// debug so Zipkin retains them regardless of backend sampling.
 func DebugMode(val bool) TracerOption {
 	return func(opts *TracerOptions) error {
 		opts.debugMode = val
@@ -193,7 +265,10 @@ func DebugMode(val bool) TracerOption {
 	}
 }
 
-// EnableSpanPool ...
+// EnableSpanPool enables recycling finished spans through a sync.Pool to
+// reduce allocations. Recorders may hold on to the RawSpan they receive, as
+// its tags, logs and baggage are never reused. Do not use a Span after calling
+// Finish on it when this option is enabled.
 func EnableSpanPool(val bool) TracerOption {
 	return func(opts *TracerOptions) error {
 		opts.enableSpanPool = val
@@ -220,6 +295,109 @@ func WithMaxLogsPerSpan(limit int) TracerOption {
 	}
 }
 
+// WithMaxTagsPerSpan option. A limit of 0 disables the limit.
+func WithMaxTagsPerSpan(limit int) TracerOption {
+	return func(opts *TracerOptions) error {
+		if limit < 0 {
+			return errors.New("invalid MaxTagsPerSpan limit. Should be 0 or higher")
+		}
+		opts.maxTagsPerSpan = limit
+		return nil
+	}
+}
+
+// WithContextValidator option
+func WithContextValidator(validator ContextValidator) TracerOption {
+	return func(opts *TracerOptions) error {
+		opts.contextValidator = validator
+		return nil
+	}
+}
+
+// WithExtractHook option registers a hook invoked on every extracted
+// SpanContext. See DebugHeaderHook for an example.
+func WithExtractHook(hook ExtractHook) TracerOption {
+	return func(opts *TracerOptions) error {
+		opts.extractHook = hook
+		return nil
+	}
+}
+
+// DebugHeaderHook returns an ExtractHook forcing sampling and the debug flag
+// for requests carrying the given header, e.g. "X-Debug", with a value other
+// than "0" or "false". It inspects TextMap and HTTPHeaders carriers. Without
+// incoming trace state a new debug trace is started.
+func DebugHeaderHook(header string) ExtractHook {
+	return func(format, carrier interface{}, sc SpanContext) SpanContext {
+		reader, ok := carrier.(opentracing.TextMapReader)
+		if !ok {
+			return sc
+		}
+		var debug bool
+		_ = reader.ForeachKey(func(k, v string) error {
+			if strings.EqualFold(k, header) && v != "0" && !strings.EqualFold(v, "false") {
+				debug = true
+			}
+			return nil
+		})
+		if debug {
+			sc.Sampled = true
+			sc.Flags |= flag.Debug | flag.SamplingSet
+		}
+		return sc
+	}
+}
+
+// WithMaxSpanLifetime option makes the tracer finish spans which are still open
+// after d, e.g. because a Finish call is missing. Such spans are recorded with
+// the IncompleteTag set and a later Finish call on them is ignored. Spans
+// finished this way are never returned to the span pool.
+func WithMaxSpanLifetime(d time.Duration) TracerOption {
+	return func(opts *TracerOptions) error {
+		if d < 0 {
+			return errors.New("invalid MaxSpanLifetime. Should not be negative")
+		}
+		opts.maxSpanLifetime = d
+		return nil
+	}
+}
+
+// WithClock option replaces time.Now as the source of the current time. This
+// allows for deterministic span timing in tests.
+func WithClock(clock func() time.Time) TracerOption {
+	return func(opts *TracerOptions) error {
+		if clock == nil {
+			return errors.New("invalid clock. Should not be nil")
+		}
+		opts.clock = clock
+		return nil
+	}
+}
+
+// WithIDGenerator option replaces the random trace and span id generation.
+// The TraceID128Bit option has no effect on a custom IDGenerator.
+func WithIDGenerator(generator IDGenerator) TracerOption {
+	return func(opts *TracerOptions) error {
+		if generator == nil {
+			return errors.New("invalid IDGenerator. Should not be nil")
+		}
+		opts.idGenerator = generator
+		return nil
+	}
+}
+
+// WithBaggagePrefix option sets the prefix used for propagating baggage items
+// through TextMap and HTTPHeaders carriers. Defaults to "ot-baggage-".
+func WithBaggagePrefix(prefix string) TracerOption {
+	return func(opts *TracerOptions) error {
+		if prefix == "" {
+			return errors.New("invalid baggage prefix. Should not be empty")
+		}
+		opts.baggagePrefix = prefix
+		return nil
+	}
+}
+
 // NewTracer creates a new OpenTracing compatible Zipkin Tracer.
 func NewTracer(recorder SpanRecorder, options ...TracerOption) (opentracing.Tracer, error) {
 	opts := &TracerOptions{
@@ -234,7 +412,11 @@ func NewTracer(recorder SpanRecorder, options ...TracerOption) (opentracing.Trac
 		debugMode:                  false,
 		traceID128Bit:              false,
 		maxLogsPerSpan:             10000,
+		maxTagsPerSpan:             0,
 		observer:                   nil,
+		clock:                      time.Now,
+		baggagePrefix:              prefixBaggage,
+		respectParentSampling:      true,
 	}
 	for _, o := range options {
 		err := o(opts)
@@ -242,7 +424,13 @@ func NewTracer(recorder SpanRecorder, options ...TracerOption) (opentracing.Trac
 			return nil, err
 		}
 	}
+	if opts.idGenerator == nil {
+		opts.idGenerator = randomIDGenerator{traceID128Bit: opts.traceID128Bit}
+	}
 	rval := &tracerImpl{options: *opts}
+	if opts.maxSpanLifetime > 0 {
+		rval.reaper = newSpanReaper(opts.maxSpanLifetime, opts.clock)
+	}
 	rval.textPropagator = &textMapPropagator{rval}
 	rval.binaryPropagator = &binaryPropagator{rval}
 	rval.accessorPropagator = &accessorPropagator{rval}
@@ -251,10 +439,15 @@ func NewTracer(recorder SpanRecorder, options ...TracerOption) (opentracing.Trac
 
 // Implements the `Tracer` interface.
 type tracerImpl struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	spansSampled uint64
+	spansDropped uint64
+
 	options            TracerOptions
 	textPropagator     *textMapPropagator
 	binaryPropagator   *binaryPropagator
 	accessorPropagator *accessorPropagator
+	reaper             *spanReaper
 }
 
 func (t *tracerImpl) StartSpan(
@@ -284,7 +477,7 @@ func (t *tracerImpl) startSpanWithOptions(
 	// Start time.
 	startTime := opts.StartTime
 	if startTime.IsZero() {
-		startTime = time.Now()
+		startTime = t.options.clock()
 	}
 
 	// Tags.
@@ -298,14 +491,15 @@ func (t *tracerImpl) startSpanWithOptions(
 		sp.observer, _ = t.options.observer.OnStartSpan(sp, operationName, opts)
 	}
 
-	// Look for a parent in the list of References.
-	//
-	// TODO: would be nice if basictracer did something with all
-	// References, not just the first one.
+	// Look for a parent in the list of References. The first ChildOf or
+	// FollowsFrom reference becomes the parent, the remaining ones are recorded
+	// as links below.
+	parentRef := -1
 ReferencesLoop:
-	for _, ref := range opts.References {
+	for i, ref := range opts.References {
 		switch ref.Type {
 		case opentracing.ChildOfRef:
+			parentRef = i
 			refCtx := ref.ReferencedContext.(SpanContext)
 			sp.raw.Context.TraceID = refCtx.TraceID
 			sp.raw.Context.ParentSpanID = &refCtx.SpanID
@@ -319,7 +513,7 @@ ReferencesLoop:
 				sp.raw.Context.ParentSpanID = refCtx.ParentSpanID
 				sp.raw.Context.Owner = false
 			} else {
-				sp.raw.Context.SpanID = randomID()
+				sp.raw.Context.SpanID = t.options.idGenerator.SpanID()
 				sp.raw.Context.ParentSpanID = &refCtx.SpanID
 				sp.raw.Context.Owner = true
 			}
@@ -332,6 +526,7 @@ ReferencesLoop:
 			}
 			break ReferencesLoop
 		case opentracing.FollowsFromRef:
+			parentRef = i
 			refCtx := ref.ReferencedContext.(SpanContext)
 			sp.raw.Context.TraceID = refCtx.TraceID
 			sp.raw.Context.ParentSpanID = &refCtx.SpanID
@@ -339,7 +534,7 @@ ReferencesLoop:
 			sp.raw.Context.Flags = refCtx.Flags
 			sp.raw.Context.Flags &^= flag.IsRoot // unset IsRoot flag if needed
 
-			sp.raw.Context.SpanID = randomID()
+			sp.raw.Context.SpanID = t.options.idGenerator.SpanID()
 			sp.raw.Context.ParentSpanID = &refCtx.SpanID
 			sp.raw.Context.Owner = true
 
@@ -352,20 +547,56 @@ ReferencesLoop:
 			break ReferencesLoop
 		}
 	}
+	for i, ref := range opts.References {
+		if refCtx, ok := ref.ReferencedContext.(SpanContext); ok && i != parentRef && refCtx.IsValid() {
+			sp.raw.Links = append(sp.raw.Links, SpanLink{Type: ref.Type, Context: refCtx})
+		}
+	}
 	if sp.raw.Context.TraceID.Empty() {
 		// No parent Span found; allocate new trace and span ids and determine
-		// the Sampled status.
-		if t.options.traceID128Bit {
-			sp.raw.Context.TraceID.High = randomID()
-		}
-		sp.raw.Context.TraceID.Low, sp.raw.Context.SpanID = randomID2()
-		sp.raw.Context.Sampled = t.options.shouldSample(sp.raw.Context.TraceID.Low)
-		sp.raw.Context.Flags = flag.IsRoot
+		// the Sampled status. A referenced but empty SpanContext (e.g. the
+		// result of an extraction without trace state) must not leave a parent.
+		// A debug flag on such a context, e.g. set by an ExtractHook, forces
+		// the new trace to be sampled.
+		debug := sp.raw.Context.Flags & flag.Debug
+		sp.raw.Context.ParentSpanID = nil
+		sp.raw.Context.TraceID = t.options.idGenerator.TraceID()
+		sp.raw.Context.SpanID = t.options.idGenerator.SpanID()
+		sp.raw.Context.Sampled = t.options.debugMode || debug != 0 ||
+			t.options.shouldSample(sp.raw.Context.TraceID.Low)
+		sp.raw.Context.Flags = flag.IsRoot | flag.SamplingSet | debug
 		sp.raw.Context.Owner = true
+	} else if !sp.raw.Context.Sampled &&
+		sp.raw.Context.Flags&(flag.SamplingSet|flag.Debug) == 0 {
+		// The parent deferred the sampling decision, e.g. an upstream request
+		// without X-B3-Sampled header; make it locally. An explicit upstream
+		// decision is always honored.
+		sp.raw.Context.Sampled = t.options.debugMode ||
+			t.options.shouldSample(sp.raw.Context.TraceID.Low)
+		sp.raw.Context.Flags |= flag.SamplingSet
 	}
 	if t.options.debugMode {
 		sp.raw.Context.Flags |= flag.Debug
 	}
+	if value, ok := tags[DebugTag]; ok {
+		if debug, _ := value.(bool); debug {
+			sp.raw.Context.Flags |= flag.Debug
+			sp.raw.Context.Sampled = true
+		}
+		// the caller's tags are left unchanged
+		spanTags := make(opentracing.Tags, len(tags)-1)
+		for k, v := range tags {
+			if k != DebugTag {
+				spanTags[k] = v
+			}
+		}
+		tags = spanTags
+	}
+	if sp.raw.Context.Sampled {
+		atomic.AddUint64(&t.spansSampled, 1)
+	} else {
+		atomic.AddUint64(&t.spansDropped, 1)
+	}
 	return t.startSpanInternal(
 		sp,
 		operationName,
@@ -374,6 +605,32 @@ ReferencesLoop:
 	)
 }
 
+// SpanCounters exposes the sampling outcome of the spans started by a tracer,
+// e.g. to monitor the rate admitted by a Sampler. The tracer returned by
+// NewTracer implements it.
+type SpanCounters interface {
+	// SpansStarted returns the number of spans started.
+	SpansStarted() uint64
+	// SpansSampled returns the number of spans started as sampled, or
+	// sampled later on through ForceSampler.
+	SpansSampled() uint64
+	// SpansDropped returns the number of spans started as unsampled and not
+	// sampled later on.
+	SpansDropped() uint64
+}
+
+func (t *tracerImpl) SpansStarted() uint64 {
+	return t.SpansSampled() + t.SpansDropped()
+}
+
+func (t *tracerImpl) SpansSampled() uint64 {
+	return atomic.LoadUint64(&t.spansSampled)
+}
+
+func (t *tracerImpl) SpansDropped() uint64 {
+	return atomic.LoadUint64(&t.spansDropped)
+}
+
 func (t *tracerImpl) startSpanInternal(
 	sp *spanImpl,
 	operationName string,
@@ -387,11 +644,16 @@ func (t *tracerImpl) startSpanInternal(
 	sp.raw.Operation = operationName
 	sp.raw.Start = startTime
 	sp.raw.Duration = -1
-	sp.raw.Tags = tags
+	if !sp.trim() {
+		sp.raw.Tags = tags
+	}
 
 	if t.options.debugAssertSingleGoroutine {
 		sp.SetTag(debugGoroutineIDTag, curGoroutineID())
 	}
+	if t.reaper != nil {
+		t.reaper.add(sp)
+	}
 	defer sp.onCreate(operationName)
 	return sp
 }
@@ -415,26 +677,74 @@ func (t *tracerImpl) Inject(sc opentracing.SpanContext, format interface{}, carr
 }
 
 func (t *tracerImpl) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	var (
+		sc  opentracing.SpanContext
+		err error
+	)
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
-		return t.textPropagator.Extract(carrier)
+		sc, err = t.textPropagator.Extract(carrier)
 	case opentracing.Binary:
-		return t.binaryPropagator.Extract(carrier)
+		sc, err = t.binaryPropagator.Extract(carrier)
+	default:
+		if _, ok := format.(delegatorType); !ok {
+			return nil, opentracing.ErrUnsupportedFormat
+		}
+		sc, err = t.accessorPropagator.Extract(carrier)
 	}
-	if _, ok := format.(delegatorType); ok {
-		return t.accessorPropagator.Extract(carrier)
+	if err != nil {
+		return nil, err
+	}
+	ctx := t.validateContext(sc.(SpanContext))
+	if t.options.extractHook != nil {
+		ctx = t.options.extractHook(format, carrier, ctx)
+	}
+	if !t.options.respectParentSampling && ctx.Sampled &&
+		ctx.Flags&flag.Debug == 0 && !ctx.TraceID.Empty() {
+		// The local sampler gets the final say on upstream sampled traces;
+		// spans joining the context inherit the outcome.
+		ctx.Sampled = t.options.debugMode || t.options.shouldSample(ctx.TraceID.Low)
 	}
-	return nil, opentracing.ErrUnsupportedFormat
+	return ctx, nil
+}
+
+// validateContext runs the configured ContextValidator on an extracted
+// SpanContext. A rejected context is replaced by an empty SpanContext so spans
+// joining it start a fresh trace.
+func (t *tracerImpl) validateContext(sc SpanContext) SpanContext {
+	if t.options.contextValidator == nil {
+		return sc
+	}
+	if err := t.options.contextValidator(sc); err != nil {
+		_ = t.options.logger.Log(
+			"msg", "rejected extracted span context",
+			"traceId", sc.TraceID.ToHex(),
+			"err", err.Error(),
+		)
+		return SpanContext{}
+	}
+	return sc
 }
 
 func (t *tracerImpl) Options() TracerOptions {
 	return t.options
 }
 
-// WithObserver assigns an initialized observer to opts.observer
-func WithObserver(observer otobserver.Observer) TracerOption {
+// WithObserver assigns an initialized observer to opts.observer. The option
+// can be provided multiple times to register multiple observers, which are
+// invoked in registration order. Observers are notified synchronously of a
+// span's finish before the span is handed to the recorder.
+func WithObserver(obs otobserver.Observer) TracerOption {
 	return func(opts *TracerOptions) error {
-		opts.observer = observer
+		switch o := opts.observer.(type) {
+		case nil:
+			opts.observer = obs
+		case observer:
+			o.observers = append(o.observers, obs)
+			opts.observer = o
+		default:
+			opts.observer = observer{observers: []otobserver.Observer{o, obs}}
+		}
 		return nil
 	}
 }
@@ -11,16 +11,21 @@ type TraceID struct {
 	Low  uint64
 }
 
-// TraceIDFromHex returns the TraceID from a Hex string.
+// TraceIDFromHex returns the TraceID from a Hex string. The string must hold
+// either 16 hex characters for a 64-bit or 32 hex characters for a 128-bit
+// TraceID, the latter being split into the High and Low halves.
 func TraceIDFromHex(h string) (t TraceID, err error) {
-	if len(h) > 16 {
-		if t.High, err = strconv.ParseUint(h[0:len(h)-16], 16, 64); err != nil {
+	switch len(h) {
+	case 32:
+		if t.High, err = strconv.ParseUint(h[0:16], 16, 64); err != nil {
 			return
 		}
-		t.Low, err = strconv.ParseUint(h[len(h)-16:], 16, 64)
-		return
+		t.Low, err = strconv.ParseUint(h[16:], 16, 64)
+	case 16:
+		t.Low, err = strconv.ParseUint(h, 16, 64)
+	default:
+		err = fmt.Errorf("invalid trace id length %d. Should be 16 or 32 hex characters", len(h))
 	}
-	t.Low, err = strconv.ParseUint(h, 16, 64)
 	return
 }
 
@@ -11,3 +11,35 @@ func TestTraceID(t *testing.T) {
 	}
 
 }
+
+func TestTraceIDFromHex(t *testing.T) {
+	for _, test := range []struct {
+		hex     string
+		want    TraceID
+		wantErr bool
+	}{
+		{hex: "0123456789abcdef", want: TraceID{Low: 0x0123456789abcdef}},
+		{hex: "0000000000000001fedcba9876543210", want: TraceID{High: 1, Low: 0xfedcba9876543210}},
+		{hex: "0123456789abcdef0", wantErr: true},
+		{hex: "123", wantErr: true},
+		{hex: "", wantErr: true},
+		{hex: "0123456789abcdefg123456789abcdef", wantErr: true},
+	} {
+		have, err := TraceIDFromHex(test.hex)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: want error, have %+v", test.hex, have)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.hex, err)
+		}
+		if test.want != have {
+			t.Errorf("%q: want %+v, have %+v", test.hex, test.want, have)
+		}
+		if want, have := test.hex, have.ToHex(); want != have {
+			t.Errorf("%q: hex round trip: have %q", test.hex, have)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
 )
 
 var (
@@ -18,8 +20,29 @@ func randomID() uint64 {
 	return uint64(seededIDGen.Int63())
 }
 
-func randomID2() (uint64, uint64) {
-	seededIDLock.Lock()
-	defer seededIDLock.Unlock()
-	return uint64(seededIDGen.Int63()), uint64(seededIDGen.Int63())
+// IDGenerator generates trace and span ids for new spans. Implementations
+// must be safe for concurrent use.
+type IDGenerator interface {
+	// TraceID returns the trace id for a new root span. Setting the High word
+	// results in a 128 bit trace id.
+	TraceID() types.TraceID
+	// SpanID returns the span id for a new span.
+	SpanID() uint64
+}
+
+// randomIDGenerator is the default IDGenerator backed by seededIDGen.
+type randomIDGenerator struct {
+	traceID128Bit bool
+}
+
+func (g randomIDGenerator) TraceID() (id types.TraceID) {
+	if g.traceID128Bit {
+		id.High = randomID()
+	}
+	id.Low = randomID()
+	return
+}
+
+func (g randomIDGenerator) SpanID() uint64 {
+	return randomID()
 }
@@ -2,17 +2,35 @@ package zipkintracer
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 	"net"
 	"strconv"
 	"strings"
 
+	opentracing "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
 )
 
 // makeEndpoint takes the hostport and service name that represent this Zipkin
 // service, and returns an endpoint that's embedded into the Zipkin core Span
-// type. It will return a nil endpoint if the input parameters are malformed.
-func makeEndpoint(hostport, serviceName string) (ep *zipkincore.Endpoint) {
+// type. If the input parameters are malformed the address of the endpoint is
+// left undefined.
+func makeEndpoint(hostport, serviceName string) *zipkincore.Endpoint {
+	ep, _ := resolveEndpoint(hostport, serviceName)
+	return ep
+}
+
+// endpointDefined returns whether ep holds an address or a port.
+func endpointDefined(ep *zipkincore.Endpoint) bool {
+	return ep.GetIpv4() != 0 || len(ep.GetIpv6()) > 0 || ep.GetPort() != 0
+}
+
+// resolveEndpoint is like makeEndpoint but also returns the error which left
+// the address of the endpoint undefined.
+func resolveEndpoint(hostport, serviceName string) (ep *zipkincore.Endpoint, err error) {
 	ep = zipkincore.NewEndpoint()
 
 	// Set the ServiceName
@@ -70,3 +88,168 @@ func makeEndpoint(hostport, serviceName string) (ep *zipkincore.Endpoint) {
 	ep.Ipv6 = []byte(addr16)
 	return
 }
+
+// Tags overriding the local endpoint of a single span, e.g. in a sidecar
+// recording spans on behalf of several services. Unset parts of the endpoint
+// are taken from the recorder's endpoint.
+const (
+	LocalEndpointServiceNameTag = "zipkin.localEndpoint.serviceName"
+	LocalEndpointIPv4Tag        = "zipkin.localEndpoint.ipv4"
+	LocalEndpointPortTag        = "zipkin.localEndpoint.port"
+)
+
+// isLocalEndpointTag reports whether key is one of the local endpoint override
+// tags, which are not recorded as binary annotations.
+func isLocalEndpointTag(key string) bool {
+	return key == LocalEndpointServiceNameTag || key == LocalEndpointIPv4Tag || key == LocalEndpointPortTag
+}
+
+// localEndpoint returns the local endpoint of a span, i.e. local overridden by
+// the local endpoint tags of the span. The IPv4 address may be tagged as
+// dotted string or uint32, the port as any integer type or decimal string.
+// Unusable tag values are ignored and reported as error.
+func localEndpoint(tags opentracing.Tags, local *zipkincore.Endpoint) (*zipkincore.Endpoint, error) {
+	serviceName, hasService := tags[LocalEndpointServiceNameTag]
+	ipv4, hasIPv4 := tags[LocalEndpointIPv4Tag]
+	port, hasPort := tags[LocalEndpointPortTag]
+	if !hasService && !hasIPv4 && !hasPort {
+		return local, nil
+	}
+
+	ep := zipkincore.NewEndpoint()
+	ep.ServiceName = local.GetServiceName()
+	ep.Ipv4 = local.GetIpv4()
+	ep.Port = local.GetPort()
+	ep.Ipv6 = local.GetIpv6()
+	var err error
+	if hasService {
+		if s, ok := serviceName.(string); ok {
+			ep.ServiceName = s
+		} else {
+			err = fmt.Errorf("invalid %s tag value %v (%T)", LocalEndpointServiceNameTag, serviceName, serviceName)
+		}
+	}
+	if hasIPv4 {
+		switch v := ipv4.(type) {
+		case uint32:
+			ep.Ipv4 = int32(v)
+		case string:
+			if ip := net.ParseIP(v).To4(); ip != nil {
+				ep.Ipv4 = int32(binary.BigEndian.Uint32(ip))
+			} else {
+				err = fmt.Errorf("invalid %s tag value %v (%T)", LocalEndpointIPv4Tag, ipv4, ipv4)
+			}
+		default:
+			err = fmt.Errorf("invalid %s tag value %v (%T)", LocalEndpointIPv4Tag, ipv4, ipv4)
+		}
+	}
+	if hasPort {
+		if p, ok := parsePort(port); ok {
+			ep.Port = int16(uint16(p))
+		} else {
+			err = fmt.Errorf("invalid %s tag value %v (%T)", LocalEndpointPortTag, port, port)
+		}
+	}
+	return ep, err
+}
+
+// peerHost returns the host of the remote endpoint as tagged on a span. The
+// peer.ipv4 and peer.ipv6 tags are preferred over peer.hostname. If none of
+// them is set, the address of the local endpoint is returned. A non string
+// peer.hostname tag is ignored and reported as error.
+func peerHost(tags opentracing.Tags, local *zipkincore.Endpoint) (string, error) {
+	switch ip := tags[string(otext.PeerHostIPv4)].(type) {
+	case uint32:
+		addr := make(net.IP, 4)
+		binary.BigEndian.PutUint32(addr, ip)
+		return addr.String(), nil
+	case string:
+		if ip != "" {
+			return ip, nil
+		}
+	}
+	if ip, ok := tags[string(otext.PeerHostIPv6)].(string); ok && ip != "" {
+		return ip, nil
+	}
+	var err error
+	if value, ok := tags[string(otext.PeerHostname)]; ok {
+		if host, ok := value.(string); ok {
+			return host, nil
+		}
+		err = fmt.Errorf("invalid %s tag value %v (%T)", otext.PeerHostname, value, value)
+	}
+	if local.GetIpv4() > 0 {
+		ip := make([]byte, 4)
+		binary.BigEndian.PutUint32(ip, uint32(local.GetIpv4()))
+		return net.IP(ip).To4().String(), err
+	}
+	return net.IP(local.GetIpv6()).String(), err
+}
+
+// peerService returns the service name of the remote endpoint as tagged on a
+// span. If the peer.service tag is not set or isn't a string, the service name
+// of the local endpoint is returned, in the latter case together with an error.
+func peerService(tags opentracing.Tags, local *zipkincore.Endpoint) (string, error) {
+	value, ok := tags[string(otext.PeerService)]
+	if !ok {
+		return local.GetServiceName(), nil
+	}
+	if serviceName, ok := value.(string); ok {
+		return serviceName, nil
+	}
+	return local.GetServiceName(), fmt.Errorf("invalid %s tag value %v (%T)", otext.PeerService, value, value)
+}
+
+// peerPort returns the port of the remote endpoint as tagged on a span. The
+// peer.port tag may hold any integer type or a decimal string. If the tag is
+// not set or holds an unusable value, the port of the local endpoint is
+// returned, in the latter case together with an error.
+func peerPort(tags opentracing.Tags, local *zipkincore.Endpoint) (string, error) {
+	localPort := strconv.FormatUint(uint64(uint16(local.GetPort())), 10)
+	value, ok := tags[string(otext.PeerPort)]
+	if !ok {
+		return localPort, nil
+	}
+	port, ok := parsePort(value)
+	if !ok {
+		return localPort, fmt.Errorf("invalid %s tag value %v (%T)", otext.PeerPort, value, value)
+	}
+	return strconv.FormatInt(port, 10), nil
+}
+
+// parsePort returns the port held by a tag value of any integer type or a
+// decimal string.
+func parsePort(value interface{}) (int64, bool) {
+	var port int64 = -1
+	switch v := value.(type) {
+	case int:
+		port = int64(v)
+	case int8:
+		port = int64(v)
+	case int16:
+		port = int64(v)
+	case int32:
+		port = int64(v)
+	case int64:
+		port = v
+	case uint:
+		if v <= math.MaxUint16 {
+			port = int64(v)
+		}
+	case uint8:
+		port = int64(v)
+	case uint16:
+		port = int64(v)
+	case uint32:
+		port = int64(v)
+	case uint64:
+		if v <= math.MaxUint16 {
+			port = int64(v)
+		}
+	case string:
+		if p, err := strconv.ParseUint(v, 10, 16); err == nil {
+			port = int64(p)
+		}
+	}
+	return port, port >= 0 && port <= math.MaxUint16
+}
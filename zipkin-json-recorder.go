@@ -1,13 +1,19 @@
 package zipkintracer
 
 import (
-	"encoding/binary"
+	"encoding/base64"
 	"fmt"
+	opentracing "github.com/opentracing/opentracing-go"
 	otext "github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
 	"net"
+	"os"
+	"runtime"
+	"sort"
 	"strconv"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/flag"
 	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
@@ -20,12 +26,83 @@ var (
 
 // JSONRecorder implements the SpanRecorder interface.
 type JSONRecorder struct {
-	collector    AgnosticCollector
-	debug        bool
-	endpoint     *zipkincore.Endpoint
-	materializer func(logFields []log.Field) ([]byte, error)
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	sequence uint64
+
+	collector     AgnosticCollector
+	debug         bool
+	endpoint      *zipkincore.Endpoint
+	materializer  func(logFields []log.Field) ([]byte, error)
+	errHandler    func(err error)
+	matErrHandler func(err error)
+	clock         func() time.Time
+	logger        Logger
+	minDuration   time.Duration
+	keepSpanKind  bool
+	processTags   []processTag
+	constantTags  []processTag
+	versionTags   []processTag
+	emitSequence  bool
+	maxLogSize    int
+	validate      func(sp RawSpan, issues []string)
+	normalizeName func(string) string
+	sortBinary    bool
+	normalizeKey  func(string) string
+	schema        string
+	strTimestamps bool
+	noLocalComp   bool
+	annotateKind  func(sp RawSpan) []*CoreAnnotation
+	orphanPolicy  OrphanPolicy
+	process       func(sp *RawSpan)
+	durationNanos bool
+}
+
+// processTag is a tag added to every span by the recorder, see
+// JSONWithProcessTags and JSONWithConstantTags.
+type processTag struct {
+	key, value string
 }
 
+// ClockSequenceTag holds the sequence number added by
+// JSONWithMonotonicSequence.
+const ClockSequenceTag = "clock.sequence"
+
+// Keys of the process tags populated by JSONWithProcessTags.
+const (
+	ProcessHostnameTag       = "host.name"
+	ProcessPIDTag            = "process.pid"
+	ProcessRuntimeVersionTag = "process.runtime.version"
+)
+
+// DurationNanosTag holds the duration in nanoseconds added by
+// JSONWithNanosecondDuration.
+const DurationNanosTag = "duration.ns"
+
+// SchemaVersionTag holds the schema version added by JSONWithSchemaVersion.
+const SchemaVersionTag = "zipkin.schema"
+
+// Keys of the version tags populated by JSONWithServiceVersion.
+const (
+	ServiceVersionTag = "service.version"
+	BuildSHATag       = "build.sha"
+)
+
+// OrphanPolicy decides how the JSONRecorder handles orphaned spans, i.e. spans
+// with a parent ID but without trace ID, e.g. created from a malformed upstream
+// context. Reported as is, they carry a zero trace ID and corrupt the trace
+// tree.
+type OrphanPolicy int
+
+// Available orphan policies.
+const (
+	// KeepOrphans records orphaned spans like any other span, with a zero
+	// trace ID. They are reported to the handler set by JSONWithValidation.
+	KeepOrphans OrphanPolicy = iota
+	// DropOrphans disposes orphaned spans. They are reported to the handler
+	// set by JSONWithValidation before being disposed.
+	DropOrphans
+)
+
 // JSONRecorderOption allows for functional options.
 type JSONRecorderOption func(r *JSONRecorder)
 
@@ -36,6 +113,15 @@ func JSONWithLogFmtMaterializer() JSONRecorderOption {
 	}
 }
 
+// JSONWithLogFmtSepMaterializer will convert OpenTracing Log fields to a LogFmt
+// like representation using the provided separators and terminator. See
+// MaterializeWithLogFmtSep.
+func JSONWithLogFmtSepMaterializer(kvSep, fieldSep, terminator string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.materializer = MaterializeWithLogFmtSep(kvSep, fieldSep, terminator)
+	}
+}
+
 // JSONWithJSONMaterializer will convert OpenTracing Log fields to a JSON representation.
 func JSONWithJSONMaterializer() JSONRecorderOption {
 	return func(r *JSONRecorder) {
@@ -50,6 +136,301 @@ func JSONWithStrictMaterializer() JSONRecorderOption {
 	}
 }
 
+// JSONWithProtobufMaterializer will convert OpenTracing Log fields to a
+// protobuf encoded representation. See MaterializeWithProtobuf for the schema.
+// As JSON strings can't hold arbitrary bytes, the encoded message is stored
+// base64 encoded in the annotation value.
+func JSONWithProtobufMaterializer() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.materializer = base64Materializer(MaterializeWithProtobuf)
+	}
+}
+
+// JSONWithMsgPackMaterializer will convert OpenTracing Log fields to a msgpack
+// encoded map. See MaterializeWithMsgPack. As JSON strings can't hold arbitrary
+// bytes, the encoded map is stored base64 encoded in the annotation value.
+func JSONWithMsgPackMaterializer() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.materializer = base64Materializer(MaterializeWithMsgPack)
+	}
+}
+
+// base64Materializer wraps a materializer producing binary output so its
+// output can be stored in JSON strings.
+func base64Materializer(materializer func([]log.Field) ([]byte, error)) func([]log.Field) ([]byte, error) {
+	return func(logFields []log.Field) ([]byte, error) {
+		b, err := materializer(logFields)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
+		base64.StdEncoding.Encode(out, b)
+		return out, nil
+	}
+}
+
+// JSONWithMaterializerErrHandler sets a handler which is called whenever the
+// materializer fails to convert OpenTracing Log fields. The failing log is left
+// out while the span and its remaining annotations are still recorded.
+func JSONWithMaterializerErrHandler(handler func(err error)) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.matErrHandler = handler
+	}
+}
+
+// JSONWithErrHandler sets a handler which is called for errors encountered
+// while converting a span, such as unusable tag values. The span is still
+// recorded, falling back to defaults where needed.
+func JSONWithErrHandler(handler func(err error)) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.errHandler = handler
+	}
+}
+
+// JSONWithClock replaces time.Now as the source of the current time, used to
+// timestamp annotations which have no time set.
+func JSONWithClock(clock func() time.Time) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.clock = clock
+	}
+}
+
+// JSONWithEndpoint sets the local endpoint used in the span annotations. It
+// replaces the endpoint otherwise resolved from the hostPort and serviceName
+// passed to NewJSONRecorder, which are then ignored. This allows advertising
+// an address different from the bound one, e.g. when running behind NAT.
+func JSONWithEndpoint(ep *zipkincore.Endpoint) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.endpoint = ep
+	}
+}
+
+// JSONWithMinDuration sets the smallest duration reported for a span, shorter
+// and negative durations are raised to it. It defaults to one microsecond, the
+// resolution of Zipkin timestamps, so every timed span has a duration. A floor
+// of 0 reports the measured duration truncated to microseconds, negative ones
+// as 0. Note that Zipkin treats a zero duration as unknown.
+func JSONWithMinDuration(d time.Duration) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.minDuration = d
+	}
+}
+
+// JSONWithSpanKindAnnotation keeps the span.kind tag of spans which are not
+// client or server spans, e.g. producer and consumer spans, as a binary
+// annotation. By default only the Zipkin annotations derived from the span
+// kind are recorded.
+func JSONWithSpanKindAnnotation() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.keepSpanKind = true
+	}
+}
+
+// JSONWithProcessTags adds tags describing the recording process as binary
+// annotations to every span. The hostname, process ID and Go version are
+// populated under the ProcessHostnameTag, ProcessPIDTag and
+// ProcessRuntimeVersionTag keys and may be overridden or extended by tags.
+// Tags set on a span take precedence over process tags of the same key.
+func JSONWithProcessTags(tags map[string]string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		all := map[string]string{
+			ProcessPIDTag:            strconv.Itoa(os.Getpid()),
+			ProcessRuntimeVersionTag: runtime.Version(),
+		}
+		if hostname, err := os.Hostname(); err == nil {
+			all[ProcessHostnameTag] = hostname
+		}
+		for k, v := range tags {
+			all[k] = v
+		}
+		r.processTags = sortedTags(all)
+	}
+}
+
+// JSONWithConstantTags adds tags as binary annotations to every span, e.g. the
+// tenant of a service in a multi-tenant platform. Tags set on a span take
+// precedence over constant tags of the same key, constant tags over process
+// tags.
+func JSONWithConstantTags(tags map[string]string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.constantTags = sortedTags(tags)
+	}
+}
+
+// JSONWithServiceVersion adds the version and the git SHA of the build of the
+// service as ServiceVersionTag and BuildSHATag binary annotations to every
+// span, so traces can be correlated with releases. Empty values are left out.
+// Tags set on a span take precedence.
+func JSONWithServiceVersion(version, sha string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.versionTags = nil
+		if version != "" {
+			r.versionTags = append(r.versionTags, processTag{key: ServiceVersionTag, value: version})
+		}
+		if sha != "" {
+			r.versionTags = append(r.versionTags, processTag{key: BuildSHATag, value: sha})
+		}
+	}
+}
+
+// JSONWithNanosecondDuration adds a DurationNanosTag binary annotation holding
+// the duration of the span in nanoseconds to every span reporting a duration.
+// The Zipkin duration is in microseconds, which loses the precision of very
+// short spans, e.g. it is raised to one microsecond for shorter spans. The
+// annotation reflects the measured duration, unaffected by
+// JSONWithMinDuration, and is left out for negative durations.
+func JSONWithNanosecondDuration() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.durationNanos = true
+	}
+}
+
+// JSONWithSchemaVersion stamps every span with a SchemaVersionTag binary
+// annotation holding version, so consumers of the payload can tell which
+// encoding produced it. The marker is carried per span as the v1 JSON batch is
+// a plain array without room for top level fields. It takes precedence over a
+// span tag of the same key.
+func JSONWithSchemaVersion(version string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.schema = version
+	}
+}
+
+// sortedTags returns tags ordered by key.
+func sortedTags(tags map[string]string) []processTag {
+	sorted := make([]processTag, 0, len(tags))
+	for k, v := range tags {
+		sorted = append(sorted, processTag{key: k, value: v})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].key < sorted[j].key
+	})
+	return sorted
+}
+
+// JSONWithMonotonicSequence adds a ClockSequenceTag binary annotation to every
+// span holding a number incremented for each span recorded. Unlike timestamps
+// it is not affected by wall clock adjustments, so tooling can order the spans
+// recorded by a process even if its clock is skewed or stepped.
+func JSONWithMonotonicSequence() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.emitSequence = true
+	}
+}
+
+// JSONWithMaxLogSize splits materialized log annotations larger than size bytes
+// into multiple annotations sharing the log timestamp, so no single value
+// exceeds the limit of the collector. The chunks are prefixed with their
+// index, "log.0=", "log.1=", and so on, which counts towards the limit, and
+// can be reassembled by concatenating their values in index order. UTF-8
+// sequences are never split; if size cannot hold the prefix and a character,
+// every chunk holds a single character. Chunking is disabled by default.
+func JSONWithMaxLogSize(size int) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.maxLogSize = size
+	}
+}
+
+// JSONWithValidation checks every sampled span for defects, such as an empty
+// operation name, a zero trace ID, a parent ID without trace ID or a start
+// time in the future, and calls handler with the issues found. The span is
+// recorded regardless. It is meant to surface instrumentation bugs during
+// development.
+func JSONWithValidation(handler func(sp RawSpan, issues []string)) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.validate = handler
+	}
+}
+
+// JSONWithSpanProcessor sets a function rewriting or enriching every sampled
+// span before it is converted, e.g. to add computed tags, drop noisy tags or
+// rename operations. The processor receives its own copy of the tags, which it
+// may modify freely.
+func JSONWithSpanProcessor(process func(sp *RawSpan)) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.process = process
+	}
+}
+
+// JSONWithOrphanPolicy sets how spans with a parent ID but without trace ID
+// are handled. The default is KeepOrphans.
+func JSONWithOrphanPolicy(policy OrphanPolicy) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.orphanPolicy = policy
+	}
+}
+
+// JSONWithNameNormalizer sets a function mapping operation names to the span
+// names reported to Zipkin, e.g. to collapse "/users/123" into "/users/:id" and
+// keep the cardinality of Zipkin's span name index low.
+func JSONWithNameNormalizer(normalize func(string) string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.normalizeName = normalize
+	}
+}
+
+// JSONWithSortedAnnotations sorts the binary annotations of every span by key,
+// making the recorded spans deterministic, e.g. for golden file tests. Their
+// order otherwise follows the iteration order of the span tags, which is random.
+// Timestamped annotations are not affected.
+func JSONWithSortedAnnotations() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.sortBinary = true
+	}
+}
+
+// JSONWithTagKeyNormalizer sets a function mapping tag keys to the binary
+// annotation keys reported to Zipkin, e.g. to canonicalize "http.statusCode"
+// into "http.status_code". If several tags of a span map onto the same key, the
+// value of the tag whose original key sorts last wins.
+func JSONWithTagKeyNormalizer(normalize func(string) string) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.normalizeKey = normalize
+	}
+}
+
+// JSONWithKindAnnotator sets a function deriving additional timestamped
+// annotations from a span, e.g. cache.hit or cache.miss annotations of cache
+// spans from a tag. The annotations returned are appended to the standard
+// annotations of the span. Annotations without host are attributed to the
+// local endpoint.
+func JSONWithKindAnnotator(annotate func(sp RawSpan) []*CoreAnnotation) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.annotateKind = annotate
+	}
+}
+
+// JSONWithoutLocalComponent leaves out the LOCAL_COMPONENT binary annotation
+// added to local spans, i.e. spans without a client, server, producer or
+// consumer span kind. Zipkin derives the service of a span from the endpoints
+// of its annotations, so local spans without any tags are no longer attributed
+// to the service.
+func JSONWithoutLocalComponent() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.noLocalComp = true
+	}
+}
+
+// JSONWithStringTimestamps encodes the timestamps and durations of the spans as
+// JSON strings rather than numbers, for consumers which would lose precision
+// parsing 64-bit microsecond values as floating point numbers, e.g. JavaScript.
+// Only the JSON encoding of the JSONHTTPCollector is affected.
+func JSONWithStringTimestamps() JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.strTimestamps = true
+	}
+}
+
+// JSONWithLogger sets the logger used for diagnostics of the recorder, such as
+// endpoints which could not be resolved. Errors which have no handler set
+// through JSONWithErrHandler or JSONWithMaterializerErrHandler are logged here
+// as well. By default diagnostics are discarded.
+func JSONWithLogger(logger Logger) JSONRecorderOption {
+	return func(r *JSONRecorder) {
+		r.logger = logger
+	}
+}
+
 // NewJSONRecorder creates a new Zipkin Recorder backed by the provided Collector.
 //
 // hostPort and serviceName allow you to set the default Zipkin endpoint
@@ -70,12 +451,17 @@ func NewJSONRecorder(c AgnosticCollector, debug bool, hostPort, serviceName stri
 	r := &JSONRecorder{
 		collector:    c,
 		debug:        debug,
-		endpoint:     makeEndpoint(hostPort, serviceName),
 		materializer: MaterializeWithLogFmt,
+		clock:        time.Now,
+		logger:       NewNopLogger(),
+		minDuration:  time.Microsecond,
 	}
 	for _, opts := range options {
 		opts(r)
 	}
+	if r.endpoint == nil {
+		r.endpoint = makeEndpoint(hostPort, serviceName)
+	}
 	return r
 }
 
@@ -85,101 +471,372 @@ func (r *JSONRecorder) RecordSpan(sp RawSpan) {
 	if !sp.Context.Sampled {
 		return
 	}
+	if r.process != nil {
+		// the tags may be shared with other recorders
+		tags := make(opentracing.Tags, len(sp.Tags))
+		for k, v := range sp.Tags {
+			tags[k] = v
+		}
+		sp.Tags = tags
+		r.process(&sp)
+	}
+	if r.validate != nil {
+		if issues := validateSpan(sp, r.clock()); len(issues) > 0 {
+			r.validate(sp, issues)
+		}
+	}
+	if r.orphanPolicy == DropOrphans && sp.Context.TraceID.Empty() && sp.Context.ParentSpanID != nil {
+		r.logger.Log("msg", "disposing span with parent id but without trace id", "span", sp.Context.SpanIDString())
+		return
+	}
+	if sp.Start.IsZero() {
+		// avoid timestamps far before the epoch for spans without start time.
+		sp.Start = r.clock()
+	}
+	endpoint, err := localEndpoint(sp.Tags, r.endpoint)
+	r.handleErr(err)
+	name := sp.Operation
+	if r.normalizeName != nil {
+		name = r.normalizeName(name)
+	}
 	span := &CoreSpan{
-		Name:    sp.Operation,
-		ID:      fmt.Sprintf("%08x", sp.Context.SpanID),
-		TraceID: fmt.Sprintf("%08x", sp.Context.TraceID.Low),
+		Name:    name,
+		ID:      sp.Context.SpanIDString(),
+		TraceID: sp.Context.TraceIDString(),
 		Debug:   r.debug || (sp.Context.Flags&flag.Debug == flag.Debug),
+
+		partial:          sp.Partial,
+		stringTimestamps: r.strTimestamps,
 	}
 
 	if sp.Context.TraceID.High > 0 {
-		span.TraceIDHigh = fmt.Sprintf("%08x", sp.Context.TraceID.High)
-		span.TraceID = span.TraceIDHigh + span.TraceID
+		span.TraceIDHigh = fmt.Sprintf("%016x", sp.Context.TraceID.High)
 	}
 
 	if sp.Context.ParentSpanID != nil {
-		span.ParentID = fmt.Sprintf("%08x", *sp.Context.ParentSpanID)
+		span.ParentID = fmt.Sprintf("%016x", *sp.Context.ParentSpanID)
 	}
 
-	// only send timestamp and duration if this process owns the current span.
-	if sp.Context.Owner {
+	// only send timestamp and duration if this process owns the current span
+	// and it finished.
+	if sp.Context.Owner && !sp.Partial {
 		timestamp := sp.Start.UnixNano() / 1e3
-		duration := sp.Duration.Nanoseconds() / 1e3
-		// since we always time our spans we will round up to 1 microsecond if the
-		// span took less.
-		if duration == 0 {
-			duration = 1
+		duration := sp.Duration
+		// since we always time our spans we will round up to the configured
+		// floor if the span took less or has a negative duration.
+		if duration < r.minDuration {
+			duration = r.minDuration
+		}
+		if duration < 0 {
+			duration = 0
 		}
 		span.Timestamp = timestamp
-		span.Duration = duration
+		span.Duration = duration.Nanoseconds() / 1e3
+		if r.durationNanos && sp.Duration >= 0 {
+			annotateBinaryCore(span, DurationNanosTag, strconv.FormatInt(sp.Duration.Nanoseconds(), 10), endpoint)
+		}
 	}
 
-	if kind, ok := sp.Tags[string(otext.SpanKind)]; ok {
+	// the annotations derived from the span kind of partial spans are reported
+	// once the span finished.
+	// RPC annotations logged as events are recorded at the logged time instead
+	// of being derived from the span kind.
+	logged := loggedRPCAnnotations(sp.Logs)
+	annotateRPC := func(timestamp time.Time, value string) {
+		if !logged[value] {
+			r.annotateCore(span, timestamp, value, endpoint)
+		}
+	}
+	if kind, ok := sp.Tags[string(otext.SpanKind)]; ok && !sp.Partial {
 		switch kind {
 		case otext.SpanKindRPCClient, otext.SpanKindRPCClientEnum:
-			annotateCore(span, sp.Start, zipkincore.CLIENT_SEND, r.endpoint)
-			annotateCore(span, sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV, r.endpoint)
+			annotateRPC(sp.Start, zipkincore.CLIENT_SEND)
+			annotateRPC(sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV)
 		case otext.SpanKindRPCServer, otext.SpanKindRPCServerEnum:
-			annotateCore(span, sp.Start, zipkincore.SERVER_RECV, r.endpoint)
-			annotateCore(span, sp.Start.Add(sp.Duration), zipkincore.SERVER_SEND, r.endpoint)
+			annotateRPC(sp.Start, zipkincore.SERVER_RECV)
+			annotateRPC(sp.Start.Add(sp.Duration), zipkincore.SERVER_SEND)
 		case SpanKindResource:
-			serviceName, ok := sp.Tags[string(otext.PeerService)]
-			if !ok {
-				serviceName = r.endpoint.GetServiceName()
+			// unusable peer tags fall back to the local endpoint.
+			serviceName, err := peerService(sp.Tags, endpoint)
+			r.handleErr(err)
+			host, err := peerHost(sp.Tags, endpoint)
+			r.handleErr(err)
+			sPort, err := peerPort(sp.Tags, endpoint)
+			r.handleErr(err)
+			re, err := resolveEndpoint(net.JoinHostPort(host, sPort), serviceName)
+			if err != nil {
+				r.logger.Log("msg", "endpoint creation failed", "host", host, "port", sPort, "err", err.Error())
 			}
-			host, ok := sp.Tags[string(otext.PeerHostname)].(string)
-			if !ok {
-				if r.endpoint.GetIpv4() > 0 {
-					ip := make([]byte, 4)
-					binary.BigEndian.PutUint32(ip, uint32(r.endpoint.GetIpv4()))
-					host = net.IP(ip).To4().String()
-				} else {
-					ip := r.endpoint.GetIpv6()
-					host = net.IP(ip).String()
-				}
+			if endpointDefined(re) {
+				annotateBinaryCore(span, zipkincore.SERVER_ADDR, serviceName, re)
 			}
-			var sPort string
-			port, ok := sp.Tags[string(otext.PeerPort)]
-			if !ok {
-				sPort = strconv.FormatInt(int64(r.endpoint.GetPort()), 10)
-			} else {
-				sPort = strconv.FormatInt(int64(port.(uint16)), 10)
+			annotateRPC(sp.Start, zipkincore.CLIENT_SEND)
+			annotateRPC(sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV)
+			if r.keepSpanKind {
+				annotateBinaryCore(span, string(otext.SpanKind), kind, endpoint)
 			}
-			re := makeEndpoint(net.JoinHostPort(host, sPort), serviceName.(string))
-			if re != nil {
-				annotateBinaryCore(span, zipkincore.SERVER_ADDR, serviceName, re)
-			} else {
-				fmt.Printf("endpoint creation failed: host: %q port: %q", host, sPort)
+		case otext.SpanKindProducerEnum:
+			r.annotateCore(span, sp.Start, MessageSend, endpoint)
+			if r.keepSpanKind {
+				annotateBinaryCore(span, string(otext.SpanKind), kind, endpoint)
+			}
+		case otext.SpanKindConsumerEnum:
+			r.annotateCore(span, sp.Start, MessageRecv, endpoint)
+			if r.keepSpanKind {
+				annotateBinaryCore(span, string(otext.SpanKind), kind, endpoint)
 			}
-			annotateCore(span, sp.Start, zipkincore.CLIENT_SEND, r.endpoint)
-			annotateCore(span, sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV, r.endpoint)
 		default:
-			annotateBinaryCore(span, zipkincore.LOCAL_COMPONENT, r.endpoint.GetServiceName(), r.endpoint)
+			if !r.noLocalComp {
+				annotateBinaryCore(span, zipkincore.LOCAL_COMPONENT, endpoint.GetServiceName(), endpoint)
+			}
+			if r.keepSpanKind {
+				annotateBinaryCore(span, string(otext.SpanKind), kind, endpoint)
+			}
 		}
-		delete(sp.Tags, string(otext.SpanKind))
-	} else {
-		annotateBinaryCore(span, zipkincore.LOCAL_COMPONENT, r.endpoint.GetServiceName(), r.endpoint)
+	} else if !ok && !r.noLocalComp && len(logged) == 0 {
+		annotateBinaryCore(span, zipkincore.LOCAL_COMPONENT, endpoint.GetServiceName(), endpoint)
 	}
 
-	for key, value := range sp.Tags {
-		annotateBinaryCore(span, key, value, r.endpoint)
+	// the OpenTracing error conventions map onto a single error annotation,
+	// which makes Zipkin highlight the span.
+	var (
+		isError  bool
+		errorMsg string
+		tags     = r.normalizeTags(sp.Tags)
+	)
+	for key, value := range tags {
+		if key == string(otext.Error) {
+			isError = value == true || value == "true"
+			continue
+		}
+		if key == string(otext.SpanKind) || key == SchemaVersionTag && r.schema != "" || isLocalEndpointTag(key) {
+			// see the tag loop of Recorder.RecordSpan
+			continue
+		}
+		annotateBinaryCore(span, key, value, endpoint)
+	}
+	linkAnnotations(sp.Links, func(key, value string) {
+		annotateBinaryCore(span, key, value, endpoint)
+	})
+	if r.emitSequence {
+		seq := atomic.AddUint64(&r.sequence, 1)
+		annotateBinaryCore(span, ClockSequenceTag, strconv.FormatUint(seq, 10), endpoint)
+	}
+	if r.schema != "" {
+		annotateBinaryCore(span, SchemaVersionTag, r.schema, endpoint)
+	}
+	for _, tag := range r.versionTags {
+		if _, ok := tags[tag.key]; !ok {
+			annotateBinaryCore(span, tag.key, tag.value, endpoint)
+		}
+	}
+	for _, tag := range r.constantTags {
+		if _, ok := tags[tag.key]; !ok {
+			annotateBinaryCore(span, tag.key, tag.value, endpoint)
+		}
+	}
+	for _, tag := range r.processTags {
+		if _, ok := tags[tag.key]; !ok && !r.hasConstantTag(tag.key) {
+			annotateBinaryCore(span, tag.key, tag.value, endpoint)
+		}
+	}
+
+	for _, spLog := range sp.Logs {
+		if msg, ok := logErrorMessage(spLog.Fields); ok {
+			isError, errorMsg = true, msg
+		}
+		if len(spLog.Fields) == 1 && spLog.Fields[0].Key() == "event" {
+			// proper Zipkin annotation
+			r.annotateCore(span, spLog.Timestamp, fmt.Sprintf("%+v", spLog.Fields[0].Value()), endpoint)
+			continue
+		}
+		// OpenTracing Log with key-value pair(s). Try to materialize using the
+		// materializer chosen for the recorder.
+		logs, err := r.materializer(spLog.Fields)
+		if err != nil {
+			if r.matErrHandler != nil {
+				r.matErrHandler(err)
+			} else {
+				r.logger.Log("msg", "materialization of log fields failed", "err", err.Error())
+			}
+			continue
+		}
+		if r.maxLogSize > 0 && len(logs) > r.maxLogSize {
+			for _, chunk := range chunkLog(logs, r.maxLogSize) {
+				r.annotateCore(span, spLog.Timestamp, chunk, endpoint)
+			}
+			continue
+		}
+		r.annotateCore(span, spLog.Timestamp, string(logs), endpoint)
+	}
+
+	if isError {
+		if errorMsg == "" {
+			errorMsg = "true"
+		}
+		annotateBinaryCore(span, zipkincore.ERROR, errorMsg, endpoint)
+	}
+
+	if r.annotateKind != nil {
+		for _, a := range r.annotateKind(sp) {
+			if a.Host == nil {
+				host := coreEndpoint(endpoint)
+				a.Host = &host
+			}
+			span.Annotations = append(span.Annotations, a)
+		}
+	}
+
+	if r.sortBinary {
+		sort.SliceStable(span.BinaryAnnotations, func(i, j int) bool {
+			return span.BinaryAnnotations[i].Key < span.BinaryAnnotations[j].Key
+		})
 	}
 
 	_ = r.collector.Collect(span)
 }
 
+// loggedRPCAnnotations returns the RPC core annotations, i.e. cs, cr, sr and
+// ss, logged as event by the span.
+func loggedRPCAnnotations(logs []opentracing.LogRecord) map[string]bool {
+	var logged map[string]bool
+	for _, spLog := range logs {
+		if len(spLog.Fields) != 1 || spLog.Fields[0].Key() != "event" {
+			continue
+		}
+		switch value := fmt.Sprintf("%+v", spLog.Fields[0].Value()); value {
+		case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV, zipkincore.SERVER_RECV, zipkincore.SERVER_SEND:
+			if logged == nil {
+				logged = make(map[string]bool)
+			}
+			logged[value] = true
+		}
+	}
+	return logged
+}
+
+// validateSpan returns the defects of sp, see JSONWithValidation.
+func validateSpan(sp RawSpan, now time.Time) []string {
+	var issues []string
+	if sp.Operation == "" {
+		issues = append(issues, "empty operation name")
+	}
+	if sp.Context.TraceID.Empty() {
+		if sp.Context.ParentSpanID != nil {
+			issues = append(issues, "parent id set without trace id")
+		} else {
+			issues = append(issues, "zero trace id")
+		}
+	}
+	if sp.Start.After(now) {
+		issues = append(issues, fmt.Sprintf("start time %s is in the future", sp.Start.Format(time.RFC3339Nano)))
+	}
+	return issues
+}
+
+// normalizeTags returns tags with their keys normalized, see
+// JSONWithTagKeyNormalizer.
+func (r *JSONRecorder) normalizeTags(tags opentracing.Tags) opentracing.Tags {
+	if r.normalizeKey == nil || len(tags) == 0 {
+		return tags
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	normalized := make(opentracing.Tags, len(tags))
+	for _, key := range keys {
+		normalized[r.normalizeKey(key)] = tags[key]
+	}
+	return normalized
+}
+
+// hasConstantTag reports whether a constant tag of key is set.
+func (r *JSONRecorder) hasConstantTag(key string) bool {
+	for _, tag := range r.constantTags {
+		if tag.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// handleErr passes a non nil err to the recorder's error handler, if any.
+func (r *JSONRecorder) handleErr(err error) {
+	if err == nil {
+		return
+	}
+	if r.errHandler != nil {
+		r.errHandler(err)
+		return
+	}
+	r.logger.Log("msg", "span conversion failed", "err", err.Error())
+}
+
+// logErrorMessage returns the error message of a log following the OpenTracing
+// error conventions, i.e. holding an error or error.object field or an error
+// event.
+func logErrorMessage(fields []log.Field) (msg string, ok bool) {
+	var message string
+	for _, field := range fields {
+		switch field.Key() {
+		case "error", "error.object":
+			msg, ok = fmt.Sprint(field.Value()), true
+		case "event":
+			ok = ok || field.Value() == "error"
+		case "message":
+			message = fmt.Sprint(field.Value())
+		}
+	}
+	if msg == "" {
+		msg = message
+	}
+	return msg, ok
+}
+
 // annotateCore annotates the span with the given value.
-func annotateCore(span *CoreSpan, timestamp time.Time, value string, host *zipkincore.Endpoint) {
+func (r *JSONRecorder) annotateCore(span *CoreSpan, timestamp time.Time, value string, host *zipkincore.Endpoint) {
 	if timestamp.IsZero() {
-		timestamp = time.Now()
+		timestamp = r.clock()
 	}
+	coreHost := coreEndpoint(host)
 	span.Annotations = append(span.Annotations, &CoreAnnotation{
 		Timestamp: timestamp.UnixNano() / 1e3,
 		Value:     value,
-		Host:      &CoreEndpoint{ServiceName: host.ServiceName, Port: host.Port, Ipv4: fmt.Sprintf("%d", host.Ipv4), Ipv6: string(host.Ipv6)},
+		Host:      &coreHost,
 	})
 }
 
+// coreEndpoint converts host into its JSON representation.
+func coreEndpoint(host *zipkincore.Endpoint) CoreEndpoint {
+	return CoreEndpoint{ServiceName: host.ServiceName, Port: host.Port, Ipv4: fmt.Sprintf("%d", host.Ipv4), Ipv6: string(host.Ipv6)}
+}
+
+// chunkLog splits b into "log.<index>=" prefixed chunks of at most size bytes
+// without splitting UTF-8 sequences. A sequence which does not fit next to the
+// prefix forms a chunk of its own.
+func chunkLog(b []byte, size int) []string {
+	var chunks []string
+	for i := 0; len(b) > 0; i++ {
+		prefix := fmt.Sprintf("log.%d=", i)
+		n := size - len(prefix)
+		if n >= len(b) {
+			n = len(b)
+		} else {
+			for n > 0 && !utf8.RuneStart(b[n]) {
+				n--
+			}
+		}
+		if n <= 0 {
+			_, n = utf8.DecodeRune(b)
+		}
+		chunks = append(chunks, prefix+string(b[:n]))
+		b = b[n:]
+	}
+	return chunks
+}
+
 // annotateBinaryCore annotates the span with the given value.
 func annotateBinaryCore(span *CoreSpan, key string, value interface{}, host *zipkincore.Endpoint) {
 	if b, ok := value.(bool); ok {
@@ -192,6 +849,6 @@ func annotateBinaryCore(span *CoreSpan, key string, value interface{}, host *zip
 	span.BinaryAnnotations = append(span.BinaryAnnotations, &CoreBinaryAnnotation{
 		Key:      key,
 		Value:    fmt.Sprintf("%+v", value),
-		Endpoint: CoreEndpoint{ServiceName: host.ServiceName, Port: host.Port, Ipv4: fmt.Sprintf("%d", host.Ipv4), Ipv6: string(host.Ipv6)},
+		Endpoint: coreEndpoint(host),
 	})
 }
@@ -0,0 +1,1713 @@
+package zipkintracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/thrift/gen-go/zipkincore"
+	"github.com/openzipkin-contrib/zipkin-go-opentracing/types"
+)
+
+type stubAgnosticCollector struct {
+	spans []*CoreSpan
+	err   error
+}
+
+func (c *stubAgnosticCollector) Collect(span *CoreSpan) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.spans = append(c.spans, span)
+	return nil
+}
+
+func (c *stubAgnosticCollector) Close() error {
+	return nil
+}
+
+func annotationValues(span *CoreSpan) []string {
+	values := make([]string, 0, len(span.Annotations))
+	for _, annotation := range span.Annotations {
+		values = append(values, annotation.Value)
+	}
+	return values
+}
+
+func TestJSONRecorderLogAnnotations(t *testing.T) {
+	var (
+		base = time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+		now  = base
+	)
+	// every reading of the clock advances it by 1ms
+	clock := func() time.Time {
+		t := now
+		now = now.Add(time.Millisecond)
+		return t
+	}
+
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithLogFmtMaterializer()),
+		WithClock(clock),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	span := tracer.StartSpan("op")
+	span.LogFields(log.String("event", "started"))
+	span.LogFields(log.String("user", "alice"), log.Int("attempt", 2))
+	span.LogKV("event", "retry", "backoff", "10ms")
+	span.Finish()
+
+	if want, have := 1, len(c.spans); want != have {
+		t.Fatalf("collected spans: want %d, have %d", want, have)
+	}
+	want := []string{
+		"started",
+		"user=alice attempt=2",
+		"event=retry backoff=10ms",
+	}
+	if have := annotationValues(c.spans[0]); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	// the span started at base, every log took the next reading of the clock
+	for i, annotation := range c.spans[0].Annotations {
+		if want, have := base.Add(time.Duration(i+1)*time.Millisecond).UnixNano()/1e3, annotation.Timestamp; want != have {
+			t.Errorf("%q: timestamp: want %d, have %d", annotation.Value, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderMaterializerErrHandler(t *testing.T) {
+	errUnencodable := errors.New("unencodable log field")
+	materializer := func(logFields []log.Field) ([]byte, error) {
+		for _, field := range logFields {
+			if field.Key() == "bad" {
+				return nil, errUnencodable
+			}
+		}
+		return MaterializeWithLogFmt(logFields)
+	}
+
+	var handled []error
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc",
+		func(r *JSONRecorder) { r.materializer = materializer },
+		JSONWithMaterializerErrHandler(func(err error) { handled = append(handled, err) }),
+	)
+
+	now := time.Now()
+	recorder.RecordSpan(RawSpan{
+		Context:   SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Operation: "op",
+		Start:     now,
+		Duration:  time.Millisecond,
+		Logs: []opentracing.LogRecord{
+			{Timestamp: now, Fields: []log.Field{log.String("event", "start")}},
+			{Timestamp: now, Fields: []log.Field{log.String("bad", "x"), log.Int("n", 1)}},
+			{Timestamp: now, Fields: []log.Field{log.String("good", "y"), log.Int("n", 2)}},
+		},
+	})
+
+	if want, have := 1, len(handled); want != have {
+		t.Fatalf("handled errors: want %d, have %d", want, have)
+	}
+	if want, have := errUnencodable, handled[0]; want != have {
+		t.Errorf("handled error: want %v, have %v", want, have)
+	}
+	if want, have := 1, len(c.spans); want != have {
+		t.Fatalf("collected spans: want %d, have %d", want, have)
+	}
+	values := annotationValues(c.spans[0])
+	if want, have := 2, len(values); want != have {
+		t.Fatalf("annotations: want %d, have %d (%v)", want, have, values)
+	}
+	if want, have := "start", values[0]; want != have {
+		t.Errorf("annotation: want %q, have %q", want, have)
+	}
+	if want, have := "good=y n=2", values[1]; want != have {
+		t.Errorf("annotation: want %q, have %q", want, have)
+	}
+}
+
+func TestJSONRecorderClock(t *testing.T) {
+	var (
+		base = time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+		now  = base
+	)
+	// every reading of the clock advances it by 1.5ms
+	clock := func() time.Time {
+		t := now
+		now = now.Add(1500 * time.Microsecond)
+		return t
+	}
+
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithClock(clock)),
+		WithClock(clock),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	span := tracer.StartSpan("op")
+	span.LogKV("event", "halfway")
+	span.Finish()
+
+	if want, have := 1, len(c.spans); want != have {
+		t.Fatalf("collected spans: want %d, have %d", want, have)
+	}
+	baseMicros := base.UnixNano() / 1e3
+	if want, have := baseMicros, c.spans[0].Timestamp; want != have {
+		t.Errorf("timestamp: want %d, have %d", want, have)
+	}
+	if want, have := int64(3000), c.spans[0].Duration; want != have {
+		t.Errorf("duration: want %d, have %d", want, have)
+	}
+	if want, have := 1, len(c.spans[0].Annotations); want != have {
+		t.Fatalf("annotations: want %d, have %d", want, have)
+	}
+	if want, have := baseMicros+1500, c.spans[0].Annotations[0].Timestamp; want != have {
+		t.Errorf("annotation timestamp: want %d, have %d", want, have)
+	}
+
+	// logs without timestamp fall back to the recorder clock
+	now = base
+	c.spans = nil
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithClock(clock)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true},
+		Start:   base,
+		Logs: []opentracing.LogRecord{
+			{Fields: []log.Field{log.String("event", "untimed")}},
+		},
+	})
+	if want, have := baseMicros, c.spans[0].Annotations[0].Timestamp; want != have {
+		t.Errorf("annotation timestamp: want %d, have %d", want, have)
+	}
+
+	// the thrift recorder uses its clock for spans and logs without time
+	now = base
+	tc := &stubCollector{}
+	NewRecorder(tc, false, "0.0.0.0:0", "svc", WithRecorderClock(clock)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 3, Sampled: true, Owner: true},
+		Logs: []opentracing.LogRecord{
+			{Fields: []log.Field{log.String("event", "untimed")}},
+			{Fields: []log.Field{log.String("k", "v")}},
+		},
+	})
+	if want, have := 1, len(tc.spans); want != have {
+		t.Fatalf("thrift: collected spans: want %d, have %d", want, have)
+	}
+	if want, have := baseMicros, *tc.spans[0].Timestamp; want != have {
+		t.Errorf("thrift: timestamp: want %d, have %d", want, have)
+	}
+	for i, annotation := range tc.spans[0].Annotations {
+		if want, have := baseMicros+int64(i+1)*1500, annotation.Timestamp; want != have {
+			t.Errorf("thrift: %q: timestamp: want %d, have %d", annotation.Value, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderTraceID128Bit(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc"),
+		TraceID128Bit(true),
+		WithLogger(&nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	root := tracer.StartSpan("root")
+	rootCtx := root.Context().(SpanContext)
+	if rootCtx.TraceID.High == 0 {
+		t.Errorf("expected 128 bit trace id for root span, have %s", rootCtx.TraceID.ToHex())
+	}
+	child := tracer.StartSpan("child", opentracing.ChildOf(rootCtx))
+	if want, have := rootCtx.TraceID, child.Context().(SpanContext).TraceID; want != have {
+		t.Errorf("child trace id: want %s, have %s", want.ToHex(), have.ToHex())
+	}
+	child.Finish()
+	root.Finish()
+
+	// upstream 64 bit traces keep their width
+	upstream := SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true}
+	joined := tracer.StartSpan("joined", opentracing.ChildOf(upstream))
+	if have := joined.Context().(SpanContext).TraceID.High; have != 0 {
+		t.Errorf("expected 64 bit trace id for joined span, have high word %x", have)
+	}
+	joined.Finish()
+
+	if want, have := 3, len(c.spans); want != have {
+		t.Fatalf("collected spans: want %d, have %d", want, have)
+	}
+	for _, span := range c.spans[:2] {
+		if want, have := 32, len(span.TraceID); want != have {
+			t.Errorf("%s: trace id length: want %d, have %d (%s)", span.Name, want, have, span.TraceID)
+		}
+		if want, have := rootCtx.TraceID.ToHex(), span.TraceID; want != have {
+			t.Errorf("%s: trace id: want %s, have %s", span.Name, want, have)
+		}
+	}
+	if want, have := "0000000000000001", c.spans[2].TraceID; want != have {
+		t.Errorf("joined trace id: want %s, have %s", want, have)
+	}
+	if want, have := "0000000000000002", c.spans[2].ParentID; want != have {
+		t.Errorf("joined parent id: want %s, have %s", want, have)
+	}
+}
+
+func TestJSONRecorderClientServerSameSpan(t *testing.T) {
+	for _, shared := range []bool{true, false} {
+		c := &stubAgnosticCollector{}
+		client, _ := NewTracer(NewJSONRecorder(c, false, "10.0.0.1:0", "client"), WithLogger(&nopLogger{}))
+		server, _ := NewTracer(
+			NewJSONRecorder(c, false, "10.0.0.2:80", "server"),
+			ClientServerSameSpan(shared),
+			WithLogger(&nopLogger{}),
+		)
+
+		// simulate an RPC from client to server
+		clientSpan := client.StartSpan("rpc", ext.SpanKindRPCClient)
+		carrier := opentracing.HTTPHeadersCarrier{}
+		if err := client.Inject(clientSpan.Context(), opentracing.HTTPHeaders, carrier); err != nil {
+			t.Fatalf("Inject failed: %+v", err)
+		}
+		wireCtx, err := server.Extract(opentracing.HTTPHeaders, carrier)
+		if err != nil {
+			t.Fatalf("Extract failed: %+v", err)
+		}
+		server.StartSpan("rpc", ext.RPCServerOption(wireCtx)).Finish()
+		clientSpan.Finish()
+
+		if want, have := 2, len(c.spans); want != have {
+			t.Fatalf("shared=%t: collected spans: want %d, have %d", shared, want, have)
+		}
+		serverCore, clientCore := c.spans[0], c.spans[1]
+		if want, have := clientCore.TraceID, serverCore.TraceID; want != have {
+			t.Errorf("shared=%t: trace id: want %s, have %s", shared, want, have)
+		}
+		if want, have := []string{"cs", "cr"}, annotationValues(clientCore); !reflect.DeepEqual(want, have) {
+			t.Errorf("shared=%t: client annotations: want %v, have %v", shared, want, have)
+		}
+		if want, have := []string{"sr", "ss"}, annotationValues(serverCore); !reflect.DeepEqual(want, have) {
+			t.Errorf("shared=%t: server annotations: want %v, have %v", shared, want, have)
+		}
+		if clientCore.Timestamp == 0 || clientCore.Duration == 0 {
+			t.Errorf("shared=%t: expected client to report timestamp and duration", shared)
+		}
+
+		if shared {
+			if want, have := clientCore.ID, serverCore.ID; want != have {
+				t.Errorf("shared span id: want %s, have %s", want, have)
+			}
+			if want, have := clientCore.ParentID, serverCore.ParentID; want != have {
+				t.Errorf("shared parent id: want %q, have %q", want, have)
+			}
+			// only the client side owns the span timing
+			if serverCore.Timestamp != 0 || serverCore.Duration != 0 {
+				t.Errorf("shared server span must not report timestamp and duration")
+			}
+			continue
+		}
+		if serverCore.ID == clientCore.ID {
+			t.Errorf("expected server child span, have shared span id %s", serverCore.ID)
+		}
+		if want, have := clientCore.ID, serverCore.ParentID; want != have {
+			t.Errorf("server parent id: want %s, have %s", want, have)
+		}
+		if serverCore.Timestamp == 0 || serverCore.Duration == 0 {
+			t.Errorf("expected server child span to report timestamp and duration")
+		}
+	}
+}
+
+func TestJSONRecorderWithEndpoint(t *testing.T) {
+	ep := zipkincore.NewEndpoint()
+	ep.ServiceName = "advertised"
+	ep.Ipv4 = 0x0a000001 // 10.0.0.1
+	ep.Port = 9411
+
+	c := &stubAgnosticCollector{}
+	// the hostPort must not be resolved if an endpoint is provided
+	recorder := NewJSONRecorder(c, false, "bound.invalid:80", "bound", JSONWithEndpoint(ep))
+	if want, have := ep, recorder.(*JSONRecorder).endpoint; want != have {
+		t.Fatalf("endpoint: want %+v, have %+v", want, have)
+	}
+
+	recorder.RecordSpan(RawSpan{
+		Context:   SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Operation: "op",
+		Start:     time.Now(),
+		Tags:      opentracing.Tags{string(ext.SpanKind): ext.SpanKindRPCServerEnum},
+	})
+	if want, have := 1, len(c.spans); want != have {
+		t.Fatalf("collected spans: want %d, have %d", want, have)
+	}
+	want := CoreEndpoint{ServiceName: "advertised", Ipv4: "167772161", Port: 9411}
+	for _, annotation := range c.spans[0].Annotations {
+		if have := *annotation.Host; want != have {
+			t.Errorf("%s host: want %+v, have %+v", annotation.Value, want, have)
+		}
+	}
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if have := annotation.Endpoint; want != have {
+			t.Errorf("%s endpoint: want %+v, have %+v", annotation.Key, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderResourcePeerIP(t *testing.T) {
+	for _, tc := range []struct {
+		tags opentracing.Tags
+		want string
+	}{
+		// 192.168.1.20
+		{tags: opentracing.Tags{string(ext.PeerHostIPv4): uint32(0xc0a80114)}, want: "-1062731500"},
+		{tags: opentracing.Tags{string(ext.PeerHostIPv4): "192.168.1.20"}, want: "-1062731500"},
+		// peer IP tags have precedence over the hostname
+		{tags: opentracing.Tags{string(ext.PeerHostIPv4): "192.168.1.20", string(ext.PeerHostname): "10.0.0.9"}, want: "-1062731500"},
+		{tags: opentracing.Tags{string(ext.PeerHostname): "10.0.0.9"}, want: "167772169"},
+		// fall back to the local endpoint
+		{tags: opentracing.Tags{}, want: "167772161"},
+	} {
+		c := &stubAgnosticCollector{}
+		recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc")
+		tc.tags[string(ext.SpanKind)] = SpanKindResource
+		tc.tags[string(ext.PeerService)] = "db"
+		tc.tags[string(ext.PeerPort)] = uint16(5432)
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+			Start:   time.Now(),
+			Tags:    tc.tags,
+		})
+
+		var sa *CoreBinaryAnnotation
+		for _, annotation := range c.spans[0].BinaryAnnotations {
+			if annotation.Key == zipkincore.SERVER_ADDR {
+				sa = annotation
+			}
+		}
+		if sa == nil {
+			t.Fatalf("%v: missing SERVER_ADDR annotation", tc.tags)
+		}
+		want := CoreEndpoint{ServiceName: "db", Ipv4: tc.want, Port: 5432}
+		if have := sa.Endpoint; want != have {
+			t.Errorf("%v: want %+v, have %+v", tc.tags, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderResourcePeerPort(t *testing.T) {
+	for _, tc := range []struct {
+		port    interface{}
+		want    int16
+		wantErr bool
+	}{
+		{port: int(5432), want: 5432},
+		{port: int8(53), want: 53},
+		{port: int16(5432), want: 5432},
+		{port: int32(5432), want: 5432},
+		{port: int64(5432), want: 5432},
+		{port: uint(5432), want: 5432},
+		{port: uint8(53), want: 53},
+		{port: uint16(5432), want: 5432},
+		{port: uint32(5432), want: 5432},
+		{port: uint64(5432), want: 5432},
+		{port: "5432", want: 5432},
+		// invalid values fall back to the local port
+		{port: "postgres", want: 80, wantErr: true},
+		{port: int(-1), want: 80, wantErr: true},
+		{port: int8(-1), want: 80, wantErr: true},
+		{port: int16(-1), want: 80, wantErr: true},
+		{port: uint(70000), want: 80, wantErr: true},
+		{port: uint32(70000), want: 80, wantErr: true},
+		{port: uint64(70000), want: 80, wantErr: true},
+		{port: 5432.0, want: 80, wantErr: true},
+	} {
+		var errs []error
+		c := &stubAgnosticCollector{}
+		recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc",
+			JSONWithErrHandler(func(err error) { errs = append(errs, err) }))
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+			Start:   time.Now(),
+			Tags: opentracing.Tags{
+				string(ext.SpanKind):     SpanKindResource,
+				string(ext.PeerHostIPv4): "192.168.1.20",
+				string(ext.PeerPort):     tc.port,
+			},
+		})
+
+		if want, have := tc.wantErr, len(errs) == 1; want != have {
+			t.Errorf("%#v: want error %t, have %v", tc.port, want, errs)
+		}
+		for _, annotation := range c.spans[0].BinaryAnnotations {
+			if annotation.Key != zipkincore.SERVER_ADDR {
+				continue
+			}
+			if want, have := tc.want, annotation.Endpoint.Port; want != have {
+				t.Errorf("%#v: want port %d, have %d", tc.port, want, have)
+			}
+		}
+	}
+}
+
+func TestJSONRecorderResourceInvalidPeerTags(t *testing.T) {
+	var errs []error
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc",
+		JSONWithErrHandler(func(err error) { errs = append(errs, err) }))
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags: opentracing.Tags{
+			string(ext.SpanKind):     SpanKindResource,
+			string(ext.PeerHostname): 42,
+			string(ext.PeerService):  struct{}{},
+		},
+	})
+
+	if want, have := 2, len(errs); want != have {
+		t.Errorf("errors: want %d, have %v", want, errs)
+	}
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if annotation.Key != zipkincore.SERVER_ADDR {
+			continue
+		}
+		// fall back to the local endpoint
+		want := CoreEndpoint{ServiceName: "svc", Ipv4: "167772161", Port: 80}
+		if have := annotation.Endpoint; want != have {
+			t.Errorf("want %+v, have %+v", want, have)
+		}
+		if want, have := "svc", annotation.Value; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+
+	// the thrift recorder logs the errors
+	var logged [][]interface{}
+	logger := LoggerFunc(func(keyvals ...interface{}) error {
+		logged = append(logged, keyvals)
+		return nil
+	})
+	NewRecorder(&stubCollector{}, false, "10.0.0.1:80", "svc", WithRecorderLogger(logger)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags: opentracing.Tags{
+			string(ext.SpanKind):     SpanKindResource,
+			string(ext.PeerHostname): 42,
+			string(ext.PeerService):  struct{}{},
+			string(ext.PeerPort):     "postgres",
+		},
+	})
+	if want, have := 3, len(logged); want != have {
+		t.Fatalf("thrift: log records: want %d, have %v", want, logged)
+	}
+	for _, keyvals := range logged {
+		if want, have := "span conversion failed", keyvals[1]; want != have {
+			t.Errorf("thrift: msg: want %q, have %q", want, have)
+		}
+	}
+
+	// as are logs which fail to materialize
+	logged = nil
+	tc := &stubCollector{}
+	NewRecorder(tc, false, "10.0.0.1:80", "svc", WithStrictMaterializer(), WithRecorderLogger(logger)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Logs: []opentracing.LogRecord{
+			{Timestamp: time.Now(), Fields: []log.Field{log.String("k", "v")}},
+		},
+	})
+	if want, have := 1, len(logged); want != have {
+		t.Fatalf("thrift: materialization: log records: want %d, have %v", want, logged)
+	}
+	if want, have := errEventLogNotFound.Error(), logged[0][3]; want != have {
+		t.Errorf("thrift: materialization: err: want %q, have %q", want, have)
+	}
+	if want, have := 0, len(tc.spans[0].Annotations); want != have {
+		t.Errorf("thrift: materialization: annotations: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONRecorderLogger(t *testing.T) {
+	var logged [][]interface{}
+	logger := LoggerFunc(func(keyvals ...interface{}) error {
+		logged = append(logged, keyvals)
+		return nil
+	})
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc", JSONWithLogger(logger))
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags: opentracing.Tags{
+			string(ext.SpanKind):     SpanKindResource,
+			string(ext.PeerHostname): "invalid host!",
+			string(ext.PeerPort):     "3306",
+			string(ext.PeerService):  "db",
+		},
+	})
+
+	if want, have := 1, len(logged); want != have {
+		t.Fatalf("log records: want %d, have %v", want, logged)
+	}
+	keyvals := logged[0]
+	if want, have := 8, len(keyvals); want != have {
+		t.Fatalf("keyvals: want %d, have %v", want, keyvals)
+	}
+	if want, have := "endpoint creation failed", keyvals[1]; want != have {
+		t.Errorf("msg: want %q, have %q", want, have)
+	}
+	if want, have := "invalid host!", keyvals[3]; want != have {
+		t.Errorf("host: want %q, have %q", want, have)
+	}
+	if msg, ok := keyvals[7].(string); !ok || msg == "" {
+		t.Errorf("err: want error message, have %#v", keyvals[7])
+	}
+
+	// the span is still annotated with an undefined address
+	saCount := 0
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if annotation.Key != zipkincore.SERVER_ADDR {
+			continue
+		}
+		saCount++
+		want := CoreEndpoint{ServiceName: "db", Ipv4: "0", Port: 3306}
+		if have := annotation.Endpoint; want != have {
+			t.Errorf("want %+v, have %+v", want, have)
+		}
+	}
+	if want, have := 1, saCount; want != have {
+		t.Errorf("SERVER_ADDR annotations: want %d, have %d", want, have)
+	}
+
+	// without peer address and port no SERVER_ADDR annotation is recorded
+	c.spans = nil
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithLogger(logger)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 3, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags: opentracing.Tags{
+			string(ext.SpanKind):     SpanKindResource,
+			string(ext.PeerHostname): "invalid host!",
+		},
+	})
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if annotation.Key == zipkincore.SERVER_ADDR {
+			t.Errorf("want no SERVER_ADDR annotation, have %+v", annotation.Endpoint)
+		}
+	}
+	tc := &stubCollector{}
+	NewRecorder(tc, false, "0.0.0.0:0", "svc", WithRecorderLogger(logger)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 3, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags: opentracing.Tags{
+			string(ext.SpanKind):     SpanKindResource,
+			string(ext.PeerHostname): "invalid host!",
+		},
+	})
+	for _, annotation := range tc.spans[0].BinaryAnnotations {
+		if annotation.Key == zipkincore.SERVER_ADDR {
+			t.Errorf("thrift: want no SERVER_ADDR annotation, have %+v", annotation.Host)
+		}
+	}
+}
+
+func TestJSONRecorderSpanKindAnnotation(t *testing.T) {
+	binaryAnnotation := func(span *CoreSpan, key string) (string, bool) {
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key == key {
+				return annotation.Value, true
+			}
+		}
+		return "", false
+	}
+	record := func(kind interface{}, options ...JSONRecorderOption) *CoreSpan {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "10.0.0.1:80", "svc", options...).RecordSpan(RawSpan{
+			Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+			Start:   time.Now(),
+			Tags:    opentracing.Tags{string(ext.SpanKind): kind},
+		})
+		return c.spans[0]
+	}
+
+	// by default the span kind is dropped
+	if value, ok := binaryAnnotation(record(ext.SpanKindProducerEnum), string(ext.SpanKind)); ok {
+		t.Errorf("default: want no span.kind annotation, have %q", value)
+	}
+
+	for _, kind := range []interface{}{ext.SpanKindProducerEnum, ext.SpanKindConsumerEnum, SpanKindResource} {
+		have, _ := binaryAnnotation(record(kind, JSONWithSpanKindAnnotation()), string(ext.SpanKind))
+		if want := fmt.Sprint(kind); want != have {
+			t.Errorf("%s: span.kind: want %q, have %q", kind, want, have)
+		}
+	}
+	span := record(ext.SpanKindEnum("batch"), JSONWithSpanKindAnnotation())
+	if _, ok := binaryAnnotation(span, zipkincore.LOCAL_COMPONENT); !ok {
+		t.Error("batch: want lc annotation to be kept")
+	}
+
+	// client and server kinds are represented by the core annotations
+	if value, ok := binaryAnnotation(record(ext.SpanKindRPCClientEnum, JSONWithSpanKindAnnotation()), string(ext.SpanKind)); ok {
+		t.Errorf("client: want no span.kind annotation, have %q", value)
+	}
+}
+
+func TestJSONRecorderMessagingSpans(t *testing.T) {
+	start := time.Now()
+	for _, test := range []struct {
+		kind ext.SpanKindEnum
+		want string
+	}{
+		{ext.SpanKindProducerEnum, MessageSend},
+		{ext.SpanKindConsumerEnum, MessageRecv},
+	} {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "10.0.0.1:80", "svc").RecordSpan(RawSpan{
+			Context:  SpanContext{SpanID: 2, Sampled: true, Owner: true},
+			Start:    start,
+			Duration: time.Millisecond,
+			Tags:     opentracing.Tags{string(ext.SpanKind): test.kind},
+		})
+		span := c.spans[0]
+		if want, have := 1, len(span.Annotations); want != have {
+			t.Fatalf("%s: want %d annotation, have %d", test.kind, want, have)
+		}
+		annotation := span.Annotations[0]
+		if want, have := test.want, annotation.Value; want != have {
+			t.Errorf("%s: annotation: want %q, have %q", test.kind, want, have)
+		}
+		if want, have := start.UnixNano()/1e3, annotation.Timestamp; want != have {
+			t.Errorf("%s: timestamp: want %d, have %d", test.kind, want, have)
+		}
+		if want, have := "svc", annotation.Host.ServiceName; want != have {
+			t.Errorf("%s: service name: want %q, have %q", test.kind, want, have)
+		}
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key == zipkincore.LOCAL_COMPONENT || annotation.Key == string(ext.SpanKind) {
+				t.Errorf("%s: unexpected binary annotation %q", test.kind, annotation.Key)
+			}
+		}
+	}
+}
+
+func TestJSONRecorderProcessTags(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc", JSONWithProcessTags(map[string]string{
+		"region":      "eu-west-1",
+		"deployment":  "canary",
+		ProcessPIDTag: "override",
+	}))
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags:    opentracing.Tags{"deployment": "blue"},
+	})
+
+	values := map[string][]string{}
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		values[annotation.Key] = append(values[annotation.Key], annotation.Value)
+	}
+	hostname, _ := os.Hostname()
+	for key, want := range map[string]string{
+		"region":                 "eu-west-1",
+		"deployment":             "blue",
+		ProcessPIDTag:            "override",
+		ProcessHostnameTag:       hostname,
+		ProcessRuntimeVersionTag: runtime.Version(),
+	} {
+		if have := values[key]; len(have) != 1 || have[0] != want {
+			t.Errorf("%s: want [%s], have %v", key, want, have)
+		}
+	}
+
+	// without overrides the process ID is populated
+	c = &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "10.0.0.1:80", "svc", JSONWithProcessTags(nil)).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+	})
+	var pid string
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if annotation.Key == ProcessPIDTag {
+			pid = annotation.Value
+		}
+	}
+	if want, have := strconv.Itoa(os.Getpid()), pid; want != have {
+		t.Errorf("pid: want %q, have %q", want, have)
+	}
+}
+
+func TestJSONRecorderMonotonicSequence(t *testing.T) {
+	sequence := func(span *CoreSpan) string {
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key == ClockSequenceTag {
+				return annotation.Value
+			}
+		}
+		return ""
+	}
+
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc", JSONWithMonotonicSequence())
+	for i := 0; i < 3; i++ {
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{SpanID: uint64(i + 1), Sampled: true, Owner: true},
+			// wall clock stepping backwards doesn't affect the sequence
+			Start: time.Now().Add(-time.Duration(i) * time.Hour),
+		})
+	}
+	for i, span := range c.spans {
+		if want, have := strconv.Itoa(i+1), sequence(span); want != have {
+			t.Errorf("span %d: sequence: want %q, have %q", i, want, have)
+		}
+	}
+
+	// opt-in only
+	c = &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "10.0.0.1:80", "svc").RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 1, Sampled: true, Owner: true},
+		Start:   time.Now(),
+	})
+	if have := sequence(c.spans[0]); have != "" {
+		t.Errorf("default: want no sequence, have %q", have)
+	}
+}
+
+func TestJSONRecorderMaxLogSize(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc",
+		JSONWithMaxLogSize(10),
+		JSONWithLogFmtMaterializer(),
+	)
+	timestamp := time.Now()
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 1, Sampled: true, Owner: true},
+		Start:   timestamp,
+		Logs: []opentracing.LogRecord{
+			{Timestamp: timestamp, Fields: []log.Field{log.String("payload", "abcdefghijklmnopqrstuvwxyz")}},
+			{Timestamp: timestamp, Fields: []log.Field{log.String("k", "small")}},
+		},
+	})
+
+	values := annotationValues(c.spans[0])
+	want := []string{
+		"log.0=payl",
+		"log.1=oad=",
+		"log.2=abcd",
+		"log.3=efgh",
+		"log.4=ijkl",
+		"log.5=mnop",
+		"log.6=qrst",
+		"log.7=uvwx",
+		"log.8=yz",
+		"k=small",
+	}
+	if !reflect.DeepEqual(want, values) {
+		t.Errorf("want %q, have %q", want, values)
+	}
+	for _, annotation := range c.spans[0].Annotations {
+		if want, have := timestamp.UnixNano()/1e3, annotation.Timestamp; want != have {
+			t.Errorf("%q: timestamp: want %d, have %d", annotation.Value, want, have)
+		}
+		if len(annotation.Value) > 10 {
+			t.Errorf("%q: want at most 10 bytes, have %d", annotation.Value, len(annotation.Value))
+		}
+	}
+
+	// UTF-8 sequences are kept intact
+	have := chunkLog([]byte("aé€b"), 9)
+	if want := []string{"log.0=aé", "log.1=€", "log.2=b"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("utf-8 chunks: want %q, have %q", want, have)
+	}
+
+	// limits smaller than the prefix still make progress
+	have = chunkLog([]byte("ab"), 3)
+	if want := []string{"log.0=a", "log.1=b"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("small limit: want %q, have %q", want, have)
+	}
+}
+
+func TestJSONRecorderOmitEmpty(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc")
+	parentID := uint64(1)
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{
+			TraceID:      types.TraceID{Low: 1},
+			SpanID:       2,
+			ParentSpanID: &parentID,
+			Sampled:      true,
+			Owner:        false,
+		},
+		Operation: "child",
+		Start:     time.Now(),
+		Duration:  time.Second,
+	})
+
+	b, err := json.Marshal(c.spans[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"timestamp", "duration", "annotations", "traceIdHigh", "debug"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("want no %q key, have %s", key, b)
+		}
+	}
+	if want, have := "0000000000000001", fields["parentId"]; want != have {
+		t.Errorf("parentId: want %q, have %v", want, have)
+	}
+}
+
+func TestJSONRecorderZeroStart(t *testing.T) {
+	base := time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return base }
+
+	for _, duration := range []time.Duration{0, time.Millisecond, -time.Millisecond} {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithClock(clock)).RecordSpan(RawSpan{
+			Context:  SpanContext{SpanID: 2, Sampled: true, Owner: true},
+			Duration: duration,
+			Tags:     opentracing.Tags{string(ext.SpanKind): ext.SpanKindRPCClientEnum},
+		})
+
+		span := c.spans[0]
+		if want, have := base.UnixNano()/1e3, span.Timestamp; want != have {
+			t.Errorf("duration %s: timestamp: want %d, have %d", duration, want, have)
+		}
+		want := duration.Nanoseconds() / 1e3
+		if want <= 0 {
+			want = 1
+		}
+		if have := span.Duration; want != have {
+			t.Errorf("duration %s: duration: want %d, have %d", duration, want, have)
+		}
+		for _, annotation := range span.Annotations {
+			if annotation.Timestamp < span.Timestamp-1e6 {
+				t.Errorf("duration %s: %s: timestamp %d before span start", duration, annotation.Value, annotation.Timestamp)
+			}
+		}
+	}
+}
+
+func TestJSONRecorderMinDuration(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		options  []JSONRecorderOption
+		duration time.Duration
+		want     int64
+	}{
+		{"default floor", nil, 0, 1},
+		{"default floor sub microsecond", nil, 500 * time.Nanosecond, 1},
+		{"disabled floor", []JSONRecorderOption{JSONWithMinDuration(0)}, 0, 0},
+		{"disabled floor negative", []JSONRecorderOption{JSONWithMinDuration(0)}, -time.Millisecond, 0},
+		{"disabled floor sub microsecond", []JSONRecorderOption{JSONWithMinDuration(0)}, 500 * time.Nanosecond, 0},
+		{"custom floor", []JSONRecorderOption{JSONWithMinDuration(time.Millisecond)}, 10 * time.Microsecond, 1000},
+		{"custom floor exceeded", []JSONRecorderOption{JSONWithMinDuration(time.Millisecond)}, 2 * time.Millisecond, 2000},
+	} {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", test.options...).RecordSpan(RawSpan{
+			Context:  SpanContext{SpanID: 2, Sampled: true, Owner: true},
+			Start:    time.Now(),
+			Duration: test.duration,
+		})
+		if want, have := test.want, c.spans[0].Duration; want != have {
+			t.Errorf("%s: duration: want %d, have %d", test.name, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderErrorAnnotation(t *testing.T) {
+	errorAnnotations := func(span *CoreSpan) []string {
+		var values []string
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key == zipkincore.ERROR {
+				values = append(values, annotation.Value)
+			}
+		}
+		return values
+	}
+
+	for _, test := range []struct {
+		name  string
+		apply func(opentracing.Span)
+		want  []string
+	}{
+		{"error tag", func(span opentracing.Span) { ext.Error.Set(span, true) }, []string{"true"}},
+		{"error log", func(span opentracing.Span) { span.LogFields(log.Error(errors.New("boom"))) }, []string{"boom"}},
+		{"error tag and log", func(span opentracing.Span) {
+			ext.Error.Set(span, true)
+			span.LogFields(log.String("event", "error"), log.String("message", "failed"))
+		}, []string{"failed"}},
+		{"no error", func(span opentracing.Span) {
+			ext.Error.Set(span, false)
+			span.LogFields(log.String("message", "fine"))
+		}, nil},
+	} {
+		c := &stubAgnosticCollector{}
+		tracer, err := NewTracer(
+			NewJSONRecorder(c, false, "0.0.0.0:0", "svc"),
+			WithLogger(&nopLogger{}),
+		)
+		if err != nil {
+			t.Fatalf("Unable to create Tracer: %+v", err)
+		}
+		span := tracer.StartSpan("op")
+		test.apply(span)
+		span.Finish()
+
+		if want, have := test.want, errorAnnotations(c.spans[0]); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %v, have %v", test.name, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderValidation(t *testing.T) {
+	base := time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return base }
+	parentID := uint64(1)
+	valid := SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true, Owner: true}
+
+	for _, test := range []struct {
+		name   string
+		span   RawSpan
+		issues []string
+	}{
+		{"valid", RawSpan{Context: valid, Operation: "op", Start: base}, nil},
+		{"empty operation", RawSpan{Context: valid, Start: base}, []string{"empty operation name"}},
+		{"zero trace id", RawSpan{
+			Context:   SpanContext{SpanID: 2, Sampled: true},
+			Operation: "op",
+			Start:     base,
+		}, []string{"zero trace id"}},
+		{"parent without trace id", RawSpan{
+			Context:   SpanContext{SpanID: 2, ParentSpanID: &parentID, Sampled: true},
+			Operation: "op",
+			Start:     base,
+		}, []string{"parent id set without trace id"}},
+		{"future start", RawSpan{Context: valid, Operation: "op", Start: base.Add(time.Second)}, []string{
+			"start time 2017-04-01T12:00:01Z is in the future",
+		}},
+	} {
+		var (
+			called bool
+			issues []string
+		)
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc",
+			JSONWithClock(clock),
+			JSONWithValidation(func(sp RawSpan, i []string) { called, issues = true, i }),
+		).RecordSpan(test.span)
+
+		if want, have := test.issues != nil, called; want != have {
+			t.Errorf("%s: handler called: want %t, have %t", test.name, want, have)
+		}
+		if want, have := test.issues, issues; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: issues: want %q, have %q", test.name, want, have)
+		}
+		if want, have := 1, len(c.spans); want != have {
+			t.Errorf("%s: recorded spans: want %d, have %d", test.name, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderNameNormalizer(t *testing.T) {
+	numeric := regexp.MustCompile(`/[0-9]+(/|$)`)
+	normalize := func(name string) string {
+		return numeric.ReplaceAllString(name, "/:id$1")
+	}
+
+	for _, test := range []struct {
+		operation, name string
+	}{
+		{"GET /users/123", "GET /users/:id"},
+		{"GET /users/123/orders/456/items", "GET /users/:id/orders/:id/items"},
+		{"GET /users/me", "GET /users/me"},
+	} {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithNameNormalizer(normalize)).RecordSpan(RawSpan{
+			Context:   SpanContext{SpanID: 1, Sampled: true},
+			Operation: test.operation,
+		})
+		if want, have := test.name, c.spans[0].Name; want != have {
+			t.Errorf("%s: want %q, have %q", test.operation, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderSortedAnnotations(t *testing.T) {
+	start := time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+	record := func() []byte {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithSortedAnnotations()).RecordSpan(RawSpan{
+			Context:   SpanContext{SpanID: 1, Sampled: true, Owner: true},
+			Operation: "op",
+			Start:     start,
+			Duration:  time.Second,
+			Tags: opentracing.Tags{
+				string(ext.SpanKind): ext.SpanKindRPCServerEnum,
+				"zeta":               1,
+				"alpha":              2,
+				"mu":                 3,
+				"beta":               4,
+				"error":              true,
+			},
+			Logs: []opentracing.LogRecord{
+				{Timestamp: start.Add(time.Millisecond), Fields: []log.Field{log.String("event", "first")}},
+				{Timestamp: start.Add(2 * time.Millisecond), Fields: []log.Field{log.String("event", "second")}},
+			},
+		})
+
+		span := c.spans[0]
+		var keys []string
+		for _, annotation := range span.BinaryAnnotations {
+			keys = append(keys, annotation.Key)
+		}
+		if want := []string{"alpha", "beta", "error", "mu", "zeta"}; !reflect.DeepEqual(want, keys) {
+			t.Errorf("binary annotations: want %v, have %v", want, keys)
+		}
+		var values []string
+		for _, annotation := range span.Annotations {
+			values = append(values, annotation.Value)
+		}
+		if want := []string{"sr", "ss", "first", "second"}; !reflect.DeepEqual(want, values) {
+			t.Errorf("annotations: want %v, have %v", want, values)
+		}
+
+		b, err := json.Marshal(span)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	want := record()
+	for i := 0; i < 10; i++ {
+		if have := record(); string(want) != string(have) {
+			t.Fatalf("run %d: want %s, have %s", i, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderConstantTags(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc",
+		JSONWithConstantTags(map[string]string{
+			"tenant":           "acme",
+			"zone":             "a",
+			ProcessHostnameTag: "acme-host",
+		}),
+		JSONWithProcessTags(nil),
+	)
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 1, Sampled: true, Owner: true},
+		Start:   time.Now(),
+	})
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true, Owner: true},
+		Start:   time.Now(),
+		Tags:    opentracing.Tags{"zone": "b"},
+	})
+
+	for i, zone := range []string{"a", "b"} {
+		values := map[string][]string{}
+		for _, annotation := range c.spans[i].BinaryAnnotations {
+			values[annotation.Key] = append(values[annotation.Key], annotation.Value)
+		}
+		for key, want := range map[string]string{
+			"tenant":           "acme",
+			"zone":             zone,
+			ProcessHostnameTag: "acme-host",
+		} {
+			if have := values[key]; len(have) != 1 || have[0] != want {
+				t.Errorf("span %d: %s: want [%s], have %v", i, key, want, have)
+			}
+		}
+	}
+}
+
+func TestJSONRecorderTagKeyNormalizer(t *testing.T) {
+	snakeCase := func(key string) string {
+		var b []rune
+		for _, r := range key {
+			if r >= 'A' && r <= 'Z' {
+				b = append(b, '_', r-'A'+'a')
+				continue
+			}
+			b = append(b, r)
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 10; i++ {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithTagKeyNormalizer(snakeCase)).RecordSpan(RawSpan{
+			Context: SpanContext{SpanID: 1, Sampled: true},
+			Tags: opentracing.Tags{
+				"http.statusCode":  404,
+				"http.status_code": 200,
+				"peerHost":         "db",
+			},
+		})
+
+		values := map[string][]string{}
+		for _, annotation := range c.spans[0].BinaryAnnotations {
+			values[annotation.Key] = append(values[annotation.Key], annotation.Value)
+		}
+		// "http.status_code" sorts after "http.statusCode"
+		if want, have := []string{"200"}, values["http.status_code"]; !reflect.DeepEqual(want, have) {
+			t.Fatalf("http.status_code: want %v, have %v", want, have)
+		}
+		if want, have := []string{"db"}, values["peer_host"]; !reflect.DeepEqual(want, have) {
+			t.Fatalf("peer_host: want %v, have %v", want, have)
+		}
+		if have, ok := values["http.statusCode"]; ok {
+			t.Fatalf("http.statusCode: want no annotation, have %v", have)
+		}
+	}
+}
+
+func TestJSONRecorderLinks(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	tracer, err := NewTracer(NewJSONRecorder(c, false, "0.0.0.0:0", "svc"), WithLogger(&nopLogger{}))
+	if err != nil {
+		t.Fatalf("Unable to create Tracer: %+v", err)
+	}
+
+	parent := tracer.StartSpan("parent")
+	producer := tracer.StartSpan("producer")
+	span := tracer.StartSpan("consumer",
+		opentracing.ChildOf(parent.Context()),
+		opentracing.FollowsFrom(producer.Context()),
+	)
+	span.Finish()
+
+	parentCtx := parent.Context().(SpanContext)
+	producerCtx := producer.Context().(SpanContext)
+	if want, have := parentCtx.SpanIDString(), c.spans[0].ParentID; want != have {
+		t.Errorf("parent id: want %s, have %s", want, have)
+	}
+	values := map[string]string{}
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		values[annotation.Key] = annotation.Value
+	}
+	for key, want := range map[string]string{
+		"link.0.traceId": producerCtx.TraceIDString(),
+		"link.0.spanId":  producerCtx.SpanIDString(),
+		"link.0.type":    "follows_from",
+	} {
+		if have := values[key]; want != have {
+			t.Errorf("%s: want %q, have %q", key, want, have)
+		}
+	}
+	if _, ok := values["link.1.spanId"]; ok {
+		t.Error("want a single link")
+	}
+
+	// a sole reference is the parent and no link
+	c.spans = nil
+	tracer.StartSpan("follower", opentracing.FollowsFrom(producer.Context())).Finish()
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if strings.HasPrefix(annotation.Key, "link.") {
+			t.Errorf("want no link annotation, have %s", annotation.Key)
+		}
+	}
+}
+
+func TestJSONRecorderServiceVersion(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithServiceVersion("1.4.2", "5f3a9c1"))
+	for i := 0; i < 2; i++ {
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{SpanID: uint64(i + 1), Sampled: true},
+		})
+	}
+	for i, span := range c.spans {
+		values := map[string][]string{}
+		for _, annotation := range span.BinaryAnnotations {
+			values[annotation.Key] = append(values[annotation.Key], annotation.Value)
+		}
+		for key, want := range map[string]string{
+			ServiceVersionTag: "1.4.2",
+			BuildSHATag:       "5f3a9c1",
+		} {
+			if have := values[key]; len(have) != 1 || have[0] != want {
+				t.Errorf("span %d: %s: want [%s], have %v", i, key, want, have)
+			}
+		}
+	}
+
+	// empty values are left out
+	c = &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithServiceVersion("1.4.2", "")).RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 1, Sampled: true},
+	})
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if annotation.Key == BuildSHATag {
+			t.Errorf("want no %s annotation, have %q", BuildSHATag, annotation.Value)
+		}
+	}
+}
+
+func TestJSONRecorderSchemaVersion(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithSchemaVersion("v1.2"))
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 1, Sampled: true},
+		Tags:    opentracing.Tags{SchemaVersionTag: "overridden"},
+	})
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 2, Sampled: true},
+	})
+
+	var buf bytes.Buffer
+	if err := encodeJSONBatch(&buf, c.spans); err != nil {
+		t.Fatal(err)
+	}
+	var payload []struct {
+		BinaryAnnotations []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"binaryAnnotations"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		t.Fatalf("unable to decode payload: %+v", err)
+	}
+	if want, have := 2, len(payload); want != have {
+		t.Fatalf("spans: want %d, have %d", want, have)
+	}
+	for i, span := range payload {
+		var values []string
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key == SchemaVersionTag {
+				values = append(values, annotation.Value)
+			}
+		}
+		if want, have := []string{"v1.2"}, values; !reflect.DeepEqual(want, have) {
+			t.Errorf("span %d: %s: want %v, have %v", i, SchemaVersionTag, want, have)
+		}
+	}
+
+	// no marker without version
+	c = &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc").RecordSpan(RawSpan{
+		Context: SpanContext{SpanID: 1, Sampled: true},
+	})
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		if annotation.Key == SchemaVersionTag {
+			t.Errorf("want no %s annotation, have %q", SchemaVersionTag, annotation.Value)
+		}
+	}
+}
+
+func TestJSONRecorderStringTimestamps(t *testing.T) {
+	// 2^53 + 1 microseconds cannot be represented as float64
+	const timestamp = 9007199254740993
+	for _, test := range []struct {
+		options             []JSONRecorderOption
+		timestamp, duration interface{}
+		annotationTimestamp interface{}
+	}{
+		{nil, json.Number("9007199254740993"), json.Number("1500"), json.Number("9007199254740993")},
+		{[]JSONRecorderOption{JSONWithStringTimestamps()}, "9007199254740993", "1500", "9007199254740993"},
+	} {
+		c := &stubAgnosticCollector{}
+		start := time.Unix(0, timestamp*1e3)
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", test.options...).RecordSpan(RawSpan{
+			Context:   SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true, Owner: true},
+			Operation: "op",
+			Start:     start,
+			Duration:  1500 * time.Microsecond,
+			Logs:      []opentracing.LogRecord{{Timestamp: start, Fields: []log.Field{log.String("event", "event")}}},
+		})
+
+		var buf bytes.Buffer
+		if err := encodeJSONBatch(&buf, c.spans); err != nil {
+			t.Fatal(err)
+		}
+		var payload []struct {
+			Timestamp   interface{} `json:"timestamp"`
+			Duration    interface{} `json:"duration"`
+			Annotations []struct {
+				Timestamp interface{} `json:"timestamp"`
+				Value     string      `json:"value"`
+			} `json:"annotations"`
+		}
+		dec := json.NewDecoder(&buf)
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		span := payload[0]
+		if want, have := test.timestamp, span.Timestamp; want != have {
+			t.Errorf("timestamp: want %#v, have %#v", want, have)
+		}
+		if want, have := test.duration, span.Duration; want != have {
+			t.Errorf("duration: want %#v, have %#v", want, have)
+		}
+		if want, have := 1, len(span.Annotations); want != have {
+			t.Fatalf("annotations: want %d, have %d", want, have)
+		}
+		if want, have := test.annotationTimestamp, span.Annotations[0].Timestamp; want != have {
+			t.Errorf("annotation timestamp: want %#v, have %#v", want, have)
+		}
+		if want, have := "event", span.Annotations[0].Value; want != have {
+			t.Errorf("annotation value: want %q, have %q", want, have)
+		}
+	}
+}
+
+func TestJSONRecorderWithoutLocalComponent(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithoutLocalComponent())
+	for _, tags := range []opentracing.Tags{
+		{"key": "value"},
+		{"key": "value", string(ext.SpanKind): "custom"},
+		{string(ext.SpanKind): ext.SpanKindRPCServerEnum},
+	} {
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true},
+			Tags:    tags,
+		})
+	}
+	if want, have := 3, len(c.spans); want != have {
+		t.Fatalf("spans: want %d, have %d", want, have)
+	}
+	for i, span := range c.spans {
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key == zipkincore.LOCAL_COMPONENT {
+				t.Errorf("span %d: want no %s annotation, have %q", i, zipkincore.LOCAL_COMPONENT, annotation.Value)
+			}
+		}
+	}
+	if want, have := 1, len(c.spans[0].BinaryAnnotations); want != have {
+		t.Errorf("local span: binary annotations: want %d, have %d", want, have)
+	}
+	// the span kind is still reflected by the core annotations
+	if want, have := 2, len(c.spans[2].Annotations); want != have {
+		t.Errorf("server span: annotations: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONRecorderLocalEndpointTags(t *testing.T) {
+	var errs []error
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "sidecar", JSONWithErrHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	record := func(tags opentracing.Tags) *CoreSpan {
+		c.spans = nil
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCServerEnum
+		recorder.RecordSpan(RawSpan{
+			Context: SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true},
+			Tags:    tags,
+			Logs:    []opentracing.LogRecord{{Timestamp: time.Now(), Fields: []log.Field{log.String("event", "event")}}},
+		})
+		return c.spans[0]
+	}
+	assertHosts := func(name string, span *CoreSpan, want CoreEndpoint) {
+		if want, have := 3, len(span.Annotations); want != have {
+			t.Fatalf("%s: annotations: want %d, have %d", name, want, have)
+		}
+		for _, annotation := range span.Annotations {
+			if have := *annotation.Host; want != have {
+				t.Errorf("%s: %s: want host %+v, have %+v", name, annotation.Value, want, have)
+			}
+		}
+		for _, annotation := range span.BinaryAnnotations {
+			if isLocalEndpointTag(annotation.Key) {
+				t.Errorf("%s: want no %s annotation", name, annotation.Key)
+			}
+			if have := annotation.Endpoint; want != have {
+				t.Errorf("%s: %s: want endpoint %+v, have %+v", name, annotation.Key, want, have)
+			}
+		}
+	}
+
+	span := record(opentracing.Tags{
+		LocalEndpointServiceNameTag: "backend",
+		LocalEndpointIPv4Tag:        "10.0.0.2",
+		LocalEndpointPortTag:        8080,
+		"key":                       "value",
+	})
+	assertHosts("override", span, CoreEndpoint{Ipv4: "167772162", Port: 8080, ServiceName: "backend"})
+
+	// unset parts fall back to the recorder endpoint
+	span = record(opentracing.Tags{LocalEndpointServiceNameTag: "backend", "key": "value"})
+	assertHosts("partial override", span, CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "backend"})
+
+	span = record(opentracing.Tags{"key": "value"})
+	assertHosts("fallback", span, CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "sidecar"})
+	if len(errs) > 0 {
+		t.Errorf("want no errors, have %v", errs)
+	}
+
+	// unusable values are reported and ignored
+	span = record(opentracing.Tags{LocalEndpointIPv4Tag: "not an ip", LocalEndpointServiceNameTag: "backend"})
+	assertHosts("invalid", span, CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "backend"})
+	if want, have := 1, len(errs); want != have {
+		t.Errorf("errors: want %d, have %v", want, errs)
+	}
+
+	// the thrift recorder logs unusable values
+	var logged [][]interface{}
+	tc := &stubCollector{}
+	NewRecorder(tc, false, "10.0.0.1:80", "sidecar", WithRecorderLogger(LoggerFunc(func(keyvals ...interface{}) error {
+		logged = append(logged, keyvals)
+		return nil
+	}))).RecordSpan(RawSpan{
+		Context:   SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true, Owner: true},
+		Operation: "op",
+		Start:     time.Now(),
+		Tags: opentracing.Tags{
+			string(ext.SpanKind):        ext.SpanKindRPCServerEnum,
+			LocalEndpointIPv4Tag:        "not an ip",
+			LocalEndpointServiceNameTag: "backend",
+		},
+	})
+	if want, have := 1, len(logged); want != have {
+		t.Fatalf("thrift: log records: want %d, have %v", want, logged)
+	}
+	for _, annotation := range tc.spans[0].Annotations {
+		if want, have := "backend", annotation.Host.GetServiceName(); want != have {
+			t.Errorf("thrift: %s: service name: want %q, have %q", annotation.Value, want, have)
+		}
+		if want, have := int32(167772161), annotation.Host.GetIpv4(); want != have {
+			t.Errorf("thrift: %s: ipv4: want %d, have %d", annotation.Value, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderKindAnnotator(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "10.0.0.1:80", "svc", JSONWithKindAnnotator(func(sp RawSpan) []*CoreAnnotation {
+		if sp.Operation != "cache.get" {
+			return nil
+		}
+		value := "cache.miss"
+		if sp.Tags["cache.hit"] == true {
+			value = "cache.hit"
+		}
+		return []*CoreAnnotation{{Timestamp: sp.Start.UnixNano() / 1e3, Value: value}}
+	}))
+	start := time.Unix(1500000000, 0)
+	for _, hit := range []bool{true, false} {
+		recorder.RecordSpan(RawSpan{
+			Context:   SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true},
+			Operation: "cache.get",
+			Start:     start,
+			Tags:      opentracing.Tags{string(ext.SpanKind): ext.SpanKindRPCClientEnum, "cache.hit": hit},
+		})
+	}
+	recorder.RecordSpan(RawSpan{
+		Context:   SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 3, Sampled: true},
+		Operation: "other",
+		Start:     start,
+	})
+
+	host := CoreEndpoint{Ipv4: "167772161", Port: 80, ServiceName: "svc"}
+	for i, want := range [][]string{
+		{zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV, "cache.hit"},
+		{zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV, "cache.miss"},
+		nil,
+	} {
+		var have []string
+		for _, annotation := range c.spans[i].Annotations {
+			have = append(have, annotation.Value)
+			if *annotation.Host != host {
+				t.Errorf("span %d: %s: want host %+v, have %+v", i, annotation.Value, host, *annotation.Host)
+			}
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("span %d: annotations: want %v, have %v", i, want, have)
+		}
+	}
+	if want, have := int64(1500000000000000), c.spans[0].Annotations[2].Timestamp; want != have {
+		t.Errorf("timestamp: want %d, have %d", want, have)
+	}
+}
+
+func TestJSONRecorderOrphanPolicy(t *testing.T) {
+	parentID := uint64(1)
+	orphan := RawSpan{
+		Context:   SpanContext{SpanID: 2, ParentSpanID: &parentID, Sampled: true},
+		Operation: "orphan",
+		Start:     time.Now(),
+	}
+	valid := RawSpan{
+		Context:   SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 3, ParentSpanID: &parentID, Sampled: true},
+		Operation: "valid",
+		Start:     time.Now(),
+	}
+
+	for _, test := range []struct {
+		name       string
+		options    []JSONRecorderOption
+		operations []string
+	}{
+		{"default", nil, []string{"orphan", "valid"}},
+		{"keep", []JSONRecorderOption{JSONWithOrphanPolicy(KeepOrphans)}, []string{"orphan", "valid"}},
+		{"drop", []JSONRecorderOption{JSONWithOrphanPolicy(DropOrphans)}, []string{"valid"}},
+	} {
+		var reported []string
+		c := &stubAgnosticCollector{}
+		options := append(test.options, JSONWithValidation(func(sp RawSpan, issues []string) {
+			reported = append(reported, sp.Operation)
+		}))
+		recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc", options...)
+		recorder.RecordSpan(orphan)
+		recorder.RecordSpan(valid)
+
+		var operations []string
+		for _, span := range c.spans {
+			operations = append(operations, span.Name)
+		}
+		if want, have := test.operations, operations; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: recorded: want %v, have %v", test.name, want, have)
+		}
+		// orphans are reported to the validation handler either way
+		if want, have := []string{"orphan"}, reported; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: reported: want %v, have %v", test.name, want, have)
+		}
+	}
+}
+
+func TestJSONRecorderSpanProcessor(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithSpanProcessor(func(sp *RawSpan) {
+		sp.Operation = strings.ToUpper(sp.Operation)
+		sp.Tags["computed"] = len(sp.Tags)
+		delete(sp.Tags, "noisy")
+	}))
+	tags := opentracing.Tags{"key": "value", "noisy": "value"}
+	recorder.RecordSpan(RawSpan{
+		Context:   SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true},
+		Operation: "get",
+		Tags:      tags,
+	})
+
+	if want, have := "GET", c.spans[0].Name; want != have {
+		t.Errorf("name: want %q, have %q", want, have)
+	}
+	values := map[string]string{}
+	for _, annotation := range c.spans[0].BinaryAnnotations {
+		values[annotation.Key] = annotation.Value
+	}
+	if want, have := map[string]string{"key": "value", "computed": "2", zipkincore.LOCAL_COMPONENT: "svc"}, values; !reflect.DeepEqual(want, have) {
+		t.Errorf("binary annotations: want %v, have %v", want, have)
+	}
+	// the tags of the recorded span are left untouched
+	if want, have := (opentracing.Tags{"key": "value", "noisy": "value"}), tags; !reflect.DeepEqual(want, have) {
+		t.Errorf("tags: want %v, have %v", want, have)
+	}
+}
+
+func TestJSONRecorderLoggedRPCAnnotations(t *testing.T) {
+	c := &stubAgnosticCollector{}
+	recorder := NewJSONRecorder(c, false, "0.0.0.0:0", "svc")
+	start := time.Unix(1500000000, 0)
+	sent := start.Add(5 * time.Millisecond)
+	recorder.RecordSpan(RawSpan{
+		Context:  SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true},
+		Start:    start,
+		Duration: 20 * time.Millisecond,
+		Tags:     opentracing.Tags{string(ext.SpanKind): ext.SpanKindRPCClientEnum},
+		Logs:     []opentracing.LogRecord{{Timestamp: sent, Fields: []log.Field{log.String("event", zipkincore.CLIENT_SEND)}}},
+	})
+	// spans without span kind are no local spans if they log RPC annotations
+	recorder.RecordSpan(RawSpan{
+		Context: SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 3, Sampled: true},
+		Start:   start,
+		Logs: []opentracing.LogRecord{
+			{Timestamp: start, Fields: []log.Field{log.String("event", zipkincore.SERVER_RECV)}},
+			{Timestamp: sent, Fields: []log.Field{log.String("event", zipkincore.SERVER_SEND)}},
+		},
+	})
+
+	for i, want := range []map[string]int64{
+		{zipkincore.CLIENT_SEND: 1500000000005000, zipkincore.CLIENT_RECV: 1500000000020000},
+		{zipkincore.SERVER_RECV: 1500000000000000, zipkincore.SERVER_SEND: 1500000000005000},
+	} {
+		have := map[string]int64{}
+		for _, annotation := range c.spans[i].Annotations {
+			if _, ok := have[annotation.Value]; ok {
+				t.Errorf("span %d: duplicate %s annotation", i, annotation.Value)
+			}
+			have[annotation.Value] = annotation.Timestamp
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("span %d: annotations: want %v, have %v", i, want, have)
+		}
+	}
+	for _, annotation := range c.spans[1].BinaryAnnotations {
+		if annotation.Key == zipkincore.LOCAL_COMPONENT {
+			t.Errorf("want no %s annotation", zipkincore.LOCAL_COMPONENT)
+		}
+	}
+}
+
+func TestJSONRecorderNanosecondDuration(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		options  []JSONRecorderOption
+		duration time.Duration
+		nanos    []string
+	}{
+		{"disabled", nil, 350 * time.Nanosecond, nil},
+		{"sub-microsecond", []JSONRecorderOption{JSONWithNanosecondDuration()}, 350 * time.Nanosecond, []string{"350"}},
+		{"milliseconds", []JSONRecorderOption{JSONWithNanosecondDuration()}, 2*time.Millisecond + 1, []string{"2000001"}},
+		{"negative", []JSONRecorderOption{JSONWithNanosecondDuration()}, -time.Microsecond, nil},
+	} {
+		c := &stubAgnosticCollector{}
+		NewJSONRecorder(c, false, "0.0.0.0:0", "svc", test.options...).RecordSpan(RawSpan{
+			Context:  SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true, Owner: true},
+			Start:    time.Now(),
+			Duration: test.duration,
+		})
+		var nanos []string
+		for _, annotation := range c.spans[0].BinaryAnnotations {
+			if annotation.Key == DurationNanosTag {
+				nanos = append(nanos, annotation.Value)
+			}
+		}
+		if want, have := test.nanos, nanos; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: %s: want %v, have %v", test.name, DurationNanosTag, want, have)
+		}
+	}
+
+	// the microsecond duration is unaffected
+	c := &stubAgnosticCollector{}
+	NewJSONRecorder(c, false, "0.0.0.0:0", "svc", JSONWithNanosecondDuration()).RecordSpan(RawSpan{
+		Context:  SpanContext{TraceID: types.TraceID{Low: 1}, SpanID: 2, Sampled: true, Owner: true},
+		Start:    time.Now(),
+		Duration: 350 * time.Nanosecond,
+	})
+	if want, have := int64(1), c.spans[0].Duration; want != have {
+		t.Errorf("duration: want %d, have %d", want, have)
+	}
+}
@@ -1,12 +1,11 @@
 package zipkintracer
 
 import (
-	"encoding/binary"
 	"fmt"
 	"net"
-	"strconv"
 	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
 	otext "github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
 
@@ -19,12 +18,41 @@ var (
 	SpanKindResource = otext.SpanKindEnum("resource")
 )
 
+// Zipkin annotations of messaging spans, recorded for spans of the producer
+// and consumer span kinds.
+const (
+	// MessageSend marks the start of sending a message to a broker.
+	MessageSend = "ms"
+	// MessageRecv marks the start of processing a message received from a
+	// broker.
+	MessageRecv = "mr"
+)
+
+// linkAnnotations calls annotate with the binary annotations describing the
+// links of a span: link.<n>.traceId, link.<n>.spanId and link.<n>.type, where
+// the type is either "child_of" or "follows_from".
+func linkAnnotations(links []SpanLink, annotate func(key, value string)) {
+	for i, link := range links {
+		prefix := fmt.Sprintf("link.%d.", i)
+		annotate(prefix+"traceId", link.Context.TraceIDString())
+		annotate(prefix+"spanId", link.Context.SpanIDString())
+		typ := "child_of"
+		if link.Type == opentracing.FollowsFromRef {
+			typ = "follows_from"
+		}
+		annotate(prefix+"type", typ)
+	}
+}
+
 // Recorder implements the SpanRecorder interface.
 type Recorder struct {
 	collector    Collector
 	debug        bool
 	endpoint     *zipkincore.Endpoint
 	materializer func(logFields []log.Field) ([]byte, error)
+	keepSpanKind bool
+	clock        func() time.Time
+	logger       Logger
 }
 
 // RecorderOption allows for functional options.
@@ -37,6 +65,15 @@ func WithLogFmtMaterializer() RecorderOption {
 	}
 }
 
+// WithLogFmtSepMaterializer will convert OpenTracing Log fields to a LogFmt
+// like representation using the provided separators and terminator. See
+// MaterializeWithLogFmtSep.
+func WithLogFmtSepMaterializer(kvSep, fieldSep, terminator string) RecorderOption {
+	return func(r *Recorder) {
+		r.materializer = MaterializeWithLogFmtSep(kvSep, fieldSep, terminator)
+	}
+}
+
 // WithJSONMaterializer will convert OpenTracing Log fields to a JSON representation.
 func WithJSONMaterializer() RecorderOption {
 	return func(r *Recorder) {
@@ -51,6 +88,41 @@ func WithStrictMaterializer() RecorderOption {
 	}
 }
 
+// WithProtobufMaterializer will convert OpenTracing Log fields to a protobuf
+// encoded representation. See MaterializeWithProtobuf for the schema.
+func WithProtobufMaterializer() RecorderOption {
+	return func(r *Recorder) {
+		r.materializer = MaterializeWithProtobuf
+	}
+}
+
+// WithSpanKindAnnotation keeps the span.kind tag of spans which are not client
+// or server spans, e.g. producer and consumer spans, as a binary annotation.
+// By default only the Zipkin annotations derived from the span kind are
+// recorded.
+func WithSpanKindAnnotation() RecorderOption {
+	return func(r *Recorder) {
+		r.keepSpanKind = true
+	}
+}
+
+// WithRecorderClock replaces time.Now as the source of the current time, used
+// to timestamp spans and annotations which have no time set.
+func WithRecorderClock(clock func() time.Time) RecorderOption {
+	return func(r *Recorder) {
+		r.clock = clock
+	}
+}
+
+// WithRecorderLogger sets the logger used for diagnostics of the recorder, such
+// as peer tags which could not be converted. By default diagnostics are
+// discarded.
+func WithRecorderLogger(logger Logger) RecorderOption {
+	return func(r *Recorder) {
+		r.logger = logger
+	}
+}
+
 // NewRecorder creates a new Zipkin Recorder backed by the provided Collector.
 //
 // hostPort and serviceName allow you to set the default Zipkin endpoint
@@ -73,6 +145,8 @@ func NewRecorder(c Collector, debug bool, hostPort, serviceName string, options
 		debug:        debug,
 		endpoint:     makeEndpoint(hostPort, serviceName),
 		materializer: MaterializeWithLogFmt,
+		clock:        time.Now,
+		logger:       NewNopLogger(),
 	}
 	for _, opts := range options {
 		opts(r)
@@ -86,6 +160,12 @@ func (r *Recorder) RecordSpan(sp RawSpan) {
 	if !sp.Context.Sampled {
 		return
 	}
+	if sp.Start.IsZero() {
+		// avoid timestamps far before the epoch for spans without start time.
+		sp.Start = r.clock()
+	}
+	endpoint, err := localEndpoint(sp.Tags, r.endpoint)
+	r.logErr(err)
 
 	var parentSpanID *int64
 	if sp.Context.ParentSpanID != nil {
@@ -107,86 +187,108 @@ func (r *Recorder) RecordSpan(sp RawSpan) {
 		ParentID:    parentSpanID,
 		Debug:       r.debug || (sp.Context.Flags&flag.Debug == flag.Debug),
 	}
-	// only send timestamp and duration if this process owns the current span.
-	if sp.Context.Owner {
+	// only send timestamp and duration if this process owns the current span
+	// and it finished.
+	if sp.Context.Owner && !sp.Partial {
 		timestamp := sp.Start.UnixNano() / 1e3
 		duration := sp.Duration.Nanoseconds() / 1e3
 		// since we always time our spans we will round up to 1 microsecond if the
-		// span took less.
-		if duration == 0 {
+		// span took less or has a negative duration.
+		if duration <= 0 {
 			duration = 1
 		}
 		span.Timestamp = &timestamp
 		span.Duration = &duration
 	}
-	if kind, ok := sp.Tags[string(otext.SpanKind)]; ok {
+	// the annotations derived from the span kind of partial spans are reported
+	// once the span finished.
+	if kind, ok := sp.Tags[string(otext.SpanKind)]; ok && !sp.Partial {
 		switch kind {
 		case otext.SpanKindRPCClient, otext.SpanKindRPCClientEnum:
-			annotate(span, sp.Start, zipkincore.CLIENT_SEND, r.endpoint)
-			annotate(span, sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV, r.endpoint)
+			annotate(span, sp.Start, zipkincore.CLIENT_SEND, endpoint)
+			annotate(span, sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV, endpoint)
 		case otext.SpanKindRPCServer, otext.SpanKindRPCServerEnum:
-			annotate(span, sp.Start, zipkincore.SERVER_RECV, r.endpoint)
-			annotate(span, sp.Start.Add(sp.Duration), zipkincore.SERVER_SEND, r.endpoint)
+			annotate(span, sp.Start, zipkincore.SERVER_RECV, endpoint)
+			annotate(span, sp.Start.Add(sp.Duration), zipkincore.SERVER_SEND, endpoint)
 		case SpanKindResource:
-			serviceName, ok := sp.Tags[string(otext.PeerService)]
-			if !ok {
-				serviceName = r.endpoint.GetServiceName()
+			// unusable peer tags fall back to the local endpoint.
+			serviceName, err := peerService(sp.Tags, endpoint)
+			r.logErr(err)
+			host, err := peerHost(sp.Tags, endpoint)
+			r.logErr(err)
+			sPort, err := peerPort(sp.Tags, endpoint)
+			r.logErr(err)
+			re, err := resolveEndpoint(net.JoinHostPort(host, sPort), serviceName)
+			if err != nil {
+				r.logger.Log("msg", "endpoint creation failed", "host", host, "port", sPort, "err", err.Error())
 			}
-			host, ok := sp.Tags[string(otext.PeerHostname)].(string)
-			if !ok {
-				if r.endpoint.GetIpv4() > 0 {
-					ip := make([]byte, 4)
-					binary.BigEndian.PutUint32(ip, uint32(r.endpoint.GetIpv4()))
-					host = net.IP(ip).To4().String()
-				} else {
-					ip := r.endpoint.GetIpv6()
-					host = net.IP(ip).String()
-				}
+			if endpointDefined(re) {
+				annotateBinary(span, zipkincore.SERVER_ADDR, serviceName, re)
 			}
-			var sPort string
-			port, ok := sp.Tags[string(otext.PeerPort)]
-			if !ok {
-				sPort = strconv.FormatInt(int64(r.endpoint.GetPort()), 10)
-			} else {
-				sPort = strconv.FormatInt(int64(port.(uint16)), 10)
+			annotate(span, sp.Start, zipkincore.CLIENT_SEND, endpoint)
+			annotate(span, sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV, endpoint)
+			if r.keepSpanKind {
+				annotateBinary(span, string(otext.SpanKind), kind, endpoint)
 			}
-			re := makeEndpoint(net.JoinHostPort(host, sPort), serviceName.(string))
-			if re != nil {
-				annotateBinary(span, zipkincore.SERVER_ADDR, serviceName, re)
-			} else {
-				fmt.Printf("endpoint creation failed: host: %q port: %q", host, sPort)
+		case otext.SpanKindProducerEnum:
+			annotate(span, sp.Start, MessageSend, endpoint)
+			if r.keepSpanKind {
+				annotateBinary(span, string(otext.SpanKind), kind, endpoint)
+			}
+		case otext.SpanKindConsumerEnum:
+			annotate(span, sp.Start, MessageRecv, endpoint)
+			if r.keepSpanKind {
+				annotateBinary(span, string(otext.SpanKind), kind, endpoint)
 			}
-			annotate(span, sp.Start, zipkincore.CLIENT_SEND, r.endpoint)
-			annotate(span, sp.Start.Add(sp.Duration), zipkincore.CLIENT_RECV, r.endpoint)
 		default:
-			annotateBinary(span, zipkincore.LOCAL_COMPONENT, r.endpoint.GetServiceName(), r.endpoint)
+			annotateBinary(span, zipkincore.LOCAL_COMPONENT, endpoint.GetServiceName(), endpoint)
+			if r.keepSpanKind {
+				annotateBinary(span, string(otext.SpanKind), kind, endpoint)
+			}
 		}
-		delete(sp.Tags, string(otext.SpanKind))
-	} else {
-		annotateBinary(span, zipkincore.LOCAL_COMPONENT, r.endpoint.GetServiceName(), r.endpoint)
+	} else if !ok {
+		annotateBinary(span, zipkincore.LOCAL_COMPONENT, endpoint.GetServiceName(), endpoint)
 	}
 
 	for key, value := range sp.Tags {
-		annotateBinary(span, key, value, r.endpoint)
+		if key == string(otext.SpanKind) || isLocalEndpointTag(key) {
+			// the span kind is reflected by the annotations, the tags are
+			// left unchanged as the span may be recorded by other recorders
+			continue
+		}
+		annotateBinary(span, key, value, endpoint)
 	}
+	linkAnnotations(sp.Links, func(key, value string) {
+		annotateBinary(span, key, value, endpoint)
+	})
 
 	for _, spLog := range sp.Logs {
+		if spLog.Timestamp.IsZero() {
+			spLog.Timestamp = r.clock()
+		}
 		if len(spLog.Fields) == 1 && spLog.Fields[0].Key() == "event" {
 			// proper Zipkin annotation
-			annotate(span, spLog.Timestamp, fmt.Sprintf("%+v", spLog.Fields[0].Value()), r.endpoint)
+			annotate(span, spLog.Timestamp, fmt.Sprintf("%+v", spLog.Fields[0].Value()), endpoint)
 			continue
 		}
 		// OpenTracing Log with key-value pair(s). Try to materialize using the
 		// materializer chosen for the recorder.
 		if logs, err := r.materializer(spLog.Fields); err != nil {
-			fmt.Printf("Materialization of OpenTracing LogFields failed: %+v", err)
+			r.logErr(err)
 		} else {
-			annotate(span, spLog.Timestamp, string(logs), r.endpoint)
+			annotate(span, spLog.Timestamp, string(logs), endpoint)
 		}
 	}
 	_ = r.collector.Collect(span)
 }
 
+// logErr logs err, if any, to the logger of the recorder.
+func (r *Recorder) logErr(err error) {
+	if err != nil {
+		r.logger.Log("msg", "span conversion failed", "err", err.Error())
+	}
+}
+
 // annotate annotates the span with the given value.
 func annotate(span *zipkincore.Span, timestamp time.Time, value string, host *zipkincore.Endpoint) {
 	if timestamp.IsZero() {